@@ -0,0 +1,62 @@
+// Package cmds provides CLI commands to interact with the goIAM backend.
+package cmds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
+	"github.com/spf13/cobra"
+)
+
+// KeysCmd returns the `keys` Cobra command, which manages the JWT signing keys.
+//
+// Unlike the other commands it does not call the API: it works directly on the key
+// store configured in the server's config file, so it must run where that store
+// (database or key directory) is reachable. Running servers pick up new keys on
+// their next reload.
+//
+// Subcommands:
+//   - rotate: generate a new signing key and retire the current one
+//
+// Flags:
+//
+//	-c, --config string   Path to the server's YAML config (default "config.yaml", or IAM_CONFIG_PATH)
+func KeysCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the JWT signing keys of the server",
+	}
+	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "config.yaml", "Path to the server's YAML config (overridable via IAM_CONFIG_PATH)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rotate",
+		Short: "Generate a new signing key and retire the current one",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.LoadConfig(configPath)
+			if err != nil {
+				fmt.Println("Failed to load config:", err)
+				os.Exit(1)
+			}
+
+			km, err := keys.NewManager(cfg, db.Init(cfg.Database, cfg.DatabaseDSN))
+			if err != nil {
+				fmt.Println("Failed to load signing keys:", err)
+				os.Exit(1)
+			}
+
+			k, err := km.Rotate()
+			if err != nil {
+				fmt.Println("Failed to rotate signing key:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("New signing key %s (%s) is active\n", k.KID, k.Algorithm)
+		},
+	})
+
+	return cmd
+}
@@ -131,7 +131,7 @@ func LoginCmd(apiURL *string) *cobra.Command {
 						fmt.Println("2FA verified.")
 						token := extractToken(vout)
 						if token != "" {
-							fmt.Printf("\n{\"token\": \"%s\"}\n", token)
+							fmt.Printf("\n{\"token\": \"%s\", \"refresh_token\": \"%s\"}\n", token, extractField(vout, "refresh_token"))
 						} else {
 							fmt.Println(string(vout))
 						}
@@ -149,6 +149,7 @@ func LoginCmd(apiURL *string) *cobra.Command {
 				token := extractToken(output)
 				if token != "" {
 					fmt.Println("Token:", token)
+					fmt.Println("Refresh token:", extractField(output, "refresh_token"))
 				} else {
 					fmt.Println(string(output))
 				}
@@ -172,10 +173,22 @@ func LoginCmd(apiURL *string) *cobra.Command {
 // Returns:
 //   - string: The extracted token value if present, otherwise empty.
 func extractToken(raw []byte) string {
-	var result map[string]string
+	return extractField(raw, "token")
+}
+
+// extractField parses the response body and returns the string value of the given JSON field.
+//
+// Parameters:
+//   - raw: Raw byte slice of the response body.
+//   - field: Name of the top-level JSON field.
+//
+// Returns:
+//   - string: The field value if present and a string, otherwise empty.
+func extractField(raw []byte, field string) string {
+	var result map[string]any
 	if err := json.Unmarshal(raw, &result); err == nil {
-		if token, ok := result["token"]; ok {
-			return token
+		if value, ok := result[field].(string); ok {
+			return value
 		}
 	}
 	return ""
@@ -0,0 +1,55 @@
+// Package cmds provides CLI commands to interact with the goIAM backend.
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// LogoutCmd returns the `logout` Cobra command, which revokes the current access token
+// on the server so it can no longer be used.
+//
+// Sends:
+//   - POST /s/auth/logout (or /s/auth/logout-all with --all)
+//
+// Flags:
+//
+//	--refresh-token string   Refresh token to revoke together with the access token (optional)
+//	--all                    Sign out of every device
+//	--token string           JWT token (global flag)
+func LogoutCmd(apiURL *string, token *string) *cobra.Command {
+	var refreshToken string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Revoke the current token (or every token with --all)",
+		Run: func(cmd *cobra.Command, args []string) {
+			path := "/s/auth/logout"
+			var payload map[string]any
+			if all {
+				path = "/s/auth/logout-all"
+			} else if refreshToken != "" {
+				payload = map[string]any{"refresh_token": refreshToken}
+			}
+
+			res, err := request(http.MethodPost, apiURL, path, payload, *token)
+			if err != nil {
+				fmt.Println("Request failed:", err)
+				return
+			}
+			defer res.Body.Close()
+
+			output, _ := io.ReadAll(res.Body)
+			fmt.Println(string(output))
+		},
+	}
+
+	cmd.Flags().StringVar(&refreshToken, "refresh-token", "", "Refresh token to revoke as well (optional)")
+	cmd.Flags().BoolVar(&all, "all", false, "Sign out of every device")
+
+	return cmd
+}
@@ -14,10 +14,13 @@ import (
 func RegisterCommands(root *cobra.Command, apiURL *string, token *string) {
 	root.AddCommand(RegisterCmd(apiURL, token))         // User registration command
 	root.AddCommand(LoginCmd(apiURL))                   // User login command
+	root.AddCommand(RefreshTokenCmd(apiURL))            // Refresh access token
+	root.AddCommand(LogoutCmd(apiURL, token))           // Revoke tokens
 	root.AddCommand(Setup2FACmd(apiURL, token))         // 2FA setup command
 	root.AddCommand(Verify2FACmd(apiURL, token))        // 2FA verification command
 	root.AddCommand(Disable2FACmd(apiURL, token))       // Disable 2FA command
 	root.AddCommand(RegenBackupCodesCmd(apiURL, token)) // Regenerate backup codes
 	root.AddCommand(UpdateProfileCmd(apiURL, token))    // Update user profile
 	root.AddCommand(UserAddCmd(apiURL, token))          // Add user
+	root.AddCommand(KeysCmd())                          // Rotate signing keys (local, no API call)
 }
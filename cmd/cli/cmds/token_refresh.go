@@ -0,0 +1,59 @@
+// Package cmds provides CLI commands to interact with the goIAM backend.
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// RefreshTokenCmd returns the `token-refresh` Cobra command,
+// which exchanges a refresh token for a new access token and refresh token.
+//
+// Sends:
+//   - POST /auth/token/refresh with {"refresh_token": "...", "device_id": "..."} in JSON body.
+//
+// Prints:
+//   - The new access token and refresh token. The old refresh token can no longer be used.
+//
+// Flags:
+//
+//	--refresh-token string   Refresh token returned by login (required)
+//	--device-id string       Device identifier used at login (optional)
+func RefreshTokenCmd(apiURL *string) *cobra.Command {
+	var refreshToken, device string
+
+	cmd := &cobra.Command{
+		Use:   "token-refresh",
+		Short: "Exchange a refresh token for a new access token",
+		Run: func(cmd *cobra.Command, args []string) {
+			payload := map[string]any{
+				"refresh_token": refreshToken,
+				"device_id":     device,
+			}
+
+			res, err := request(http.MethodPost, apiURL, "/auth/token/refresh", payload, "")
+			if err != nil {
+				fmt.Println("Request failed:", err)
+				return
+			}
+			defer res.Body.Close()
+			output, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != http.StatusOK {
+				fmt.Printf("Error: status %d\n%s\n", res.StatusCode, string(output))
+				return
+			}
+			fmt.Println("Token:", extractToken(output))
+			fmt.Println("Refresh token:", extractField(output, "refresh_token"))
+		},
+	}
+
+	cmd.Flags().StringVar(&refreshToken, "refresh-token", "", "Refresh token returned by login")
+	cmd.Flags().StringVar(&device, "device-id", "", "Device identifier used at login (optional)")
+	cmd.MarkFlagRequired("refresh-token")
+
+	return cmd
+}
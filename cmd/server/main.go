@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/javadmohebbi/goIAM/internal/api"
 	"github.com/javadmohebbi/goIAM/internal/config"
 	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
 	flag "github.com/spf13/pflag"
 )
 
@@ -22,7 +24,8 @@ import (
 //  3. Applies environment variable overrides for configuration values.
 //  4. Applies runtime overrides from CLI flags (port, debug).
 //  5. Initializes the database connection using GORM.
-//  6. Starts the HTTP server with the loaded configuration.
+//  6. Loads (or generates) JWT signing keys and starts scheduled key rotation.
+//  7. Starts the HTTP server with the loaded configuration.
 //
 // Environment Variables:
 //   - IAM_CONFIG_PATH: override config file location
@@ -38,6 +41,7 @@ import (
 //	-p, --port: port to bind the HTTP server to (default: 8080)
 //	           (can be overridden by IAM_PORT env var)
 //	-d, --debug: enable verbose debug output (default: false)
+//	--rotate-keys: generate a new signing key, retire the current one, and exit
 func Main() {
 	// Parse command-line flags
 	// These can be overridden by environment variables:
@@ -47,6 +51,7 @@ func Main() {
 	configPath := flag.StringP("config", "c", "config.yaml", "Path to YAML config (overridable via IAM_CONFIG_PATH)")
 	port := flag.IntP("port", "p", 8080, "Port to run the HTTP server on (overridable via IAM_PORT)")
 	debug := flag.BoolP("debug", "d", false, "Enable debug output (flag only)")
+	rotateKeys := flag.Bool("rotate-keys", false, "Rotate the JWT signing key and exit")
 	flag.Parse()
 
 	// Load configuration
@@ -63,9 +68,40 @@ func Main() {
 	// Initialize database
 	// db.Init(cfg.Database, cfg.DatabaseDSN)
 	_db := db.Init(cfg.Database, cfg.DatabaseDSN)
+	db.SetPolicyCacheTTL(cfg.Policy.CacheTTL)
+	for service, verbs := range cfg.Policy.Actions {
+		db.RegisterActions(service, verbs...)
+	}
+
+	// Load signing keys (generates the first key if none exists)
+	km, err := keys.NewManager(cfg, _db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load signing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	// One-off key rotation from the command line;
+	// running servers pick up the new key on their next reload
+	if *rotateKeys {
+		k, err := km.Rotate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate signing key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("New signing key %s (%s) is active\n", k.KID, k.Algorithm)
+		return
+	}
+
+	// Reload keys every minute and rotate them on the configured interval
+	km.StartRotation(time.Minute)
+	defer km.StopRotation()
 
 	// creating new API server instance
-	_api := api.New(cfg, _db)
+	_api, err := api.New(cfg, _db, km)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize API: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Signal handeling
 	sigCh := make(chan os.Signal, 1)
@@ -1,24 +1,26 @@
 package api
 
 import (
-	"time"
-
 	"github.com/gofiber/fiber/v3"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/javadmohebbi/goIAM/internal/auth"
 	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
 )
 
 // handle2FAVerifyInput represents the expected JSON structure for 2FA verification.
 type handle2FAVerifyInput struct {
-	Code string `json:"code"` // required TOTP code
+	Code     string `json:"code"`      // required TOTP code
+	DeviceID string `json:"device_id"` // optional, binds the refresh token to this device
 }
 
 // handle2FASetup returns a handler that creates and stores a TOTP secret,
 // and returns it to the client for use in authenticator apps.
 func (a *API) handle2FASetup() fiber.Handler {
 	return func(c fiber.Ctx) error {
-		user := c.Locals("user").(db.User)
+		user, ok := c.Locals("user").(db.User)
+		if !ok {
+			return fiber.ErrUnauthorized
+		}
 
 		key, qrURL, err := auth.GenerateTOTPSecret(user.Username, "goIAM")
 		if err != nil {
@@ -38,10 +40,13 @@ func (a *API) handle2FASetup() fiber.Handler {
 }
 
 // handle2FAVerify verifies the TOTP code and enables 2FA for the user,
-// issuing a new long-lived token on success.
+// issuing a new access token and refresh token on success.
 func (a *API) handle2FAVerify() fiber.Handler {
 	return func(c fiber.Ctx) error {
-		user := c.Locals("user").(db.User)
+		user, ok := c.Locals("user").(db.User)
+		if !ok {
+			return fiber.ErrUnauthorized
+		}
 
 		var body handle2FAVerifyInput
 		if err := c.Bind().Body(&body); err != nil {
@@ -61,21 +66,14 @@ func (a *API) handle2FAVerify() fiber.Handler {
 			return fiber.NewError(fiber.StatusInternalServerError, "failed to update user")
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub":  user.ID,
-			"name": user.Username,
-			"2fa":  true, // tells middleware that 2FA is verified
-			"exp":  time.Now().Add(24 * time.Hour).Unix(),
-		})
-		signed, err := token.SignedString([]byte(a.cfg.JWTSecret))
+		// tells middleware that 2FA is verified
+		tokens, err := a.issueTokens(c, user, deviceID(c, body.DeviceID), true)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "failed to create token")
 		}
 
-		return c.JSON(fiber.Map{
-			"message": "2FA verified and enabled",
-			"token":   signed,
-		})
+		tokens["message"] = "2FA verified and enabled"
+		return c.JSON(tokens)
 	}
 }
 
@@ -86,9 +84,13 @@ type handle2FADisableInput struct {
 }
 
 // handle2FADisable disables TOTP-based 2FA and deletes all backup codes.
+// Users with registered security keys keep requiring 2FA, see db.User.Disable2FA.
 func (a *API) handle2FADisable() fiber.Handler {
 	return func(c fiber.Ctx) error {
-		user := c.Locals("user").(db.User)
+		user, ok := c.Locals("user").(db.User)
+		if !ok {
+			return fiber.ErrUnauthorized
+		}
 
 		var body handle2FADisableInput
 		if err := c.Bind().Body(&body); err != nil {
@@ -101,14 +103,19 @@ func (a *API) handle2FADisable() fiber.Handler {
 			}
 		}
 
-		user.TOTPSecret = ""
-		user.Requires2FA = false
-		a.iamDB.Where("user_id = ?", user.ID).Delete(&db.BackupCode{})
-
-		if err := a.iamDB.Save(&user).Error; err != nil {
+		err := a.iamDB.Transaction(func(tx *gorm.DB) error {
+			if err := user.Disable2FA(tx); err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&db.BackupCode{}).Error
+		})
+		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "failed to disable 2FA")
 		}
 
+		if user.Requires2FA {
+			return c.JSON(fiber.Map{"message": "TOTP disabled, 2FA stays enabled by the registered security keys"})
+		}
 		return c.JSON(fiber.Map{"message": "2FA disabled"})
 	}
 }
@@ -117,7 +124,10 @@ func (a *API) handle2FADisable() fiber.Handler {
 // and invalidates all previously issued codes.
 func (a *API) handleBackupCodes() fiber.Handler {
 	return func(c fiber.Ctx) error {
-		user := c.Locals("user").(db.User)
+		user, ok := c.Locals("user").(db.User)
+		if !ok {
+			return fiber.ErrUnauthorized
+		}
 
 		codes, hashes, err := auth.GenerateBackupCodes(8)
 		if err != nil {
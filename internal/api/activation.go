@@ -0,0 +1,206 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/smtpclient"
+	"gorm.io/gorm"
+)
+
+// activationRequestedMessage is returned for every resend request, whether or not
+// an account matched, so the endpoint cannot be used to enumerate accounts.
+const activationRequestedMessage = "If the account exists and is not verified yet, you will receive a new email"
+
+// handleActivate redeems a token from an activation or verification email.
+//
+// Activation tokens are sent to users created by an administrator: the user sets their
+// password, and the account is activated and its email marked as verified.
+// Verification tokens only mark the email as verified; the password is ignored.
+func (a *API) handleActivate(c fiber.Ctx) error {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"` // required for activation tokens
+	}
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Token == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "token is required")
+	}
+
+	var activated bool
+	err := a.iamDB.Transaction(func(tx *gorm.DB) error {
+		evt, err := db.ConsumeEmailVerificationToken(tx, auth.HashToken(strings.TrimSpace(body.Token)))
+		if err != nil {
+			return err
+		}
+
+		var user db.User
+		if err := tx.First(&user, evt.UserID).Error; err != nil {
+			return err
+		}
+		// The email changed after the token was sent
+		if user.Email != evt.Email {
+			return gorm.ErrRecordNotFound
+		}
+
+		updates := map[string]any{"email_verified": true}
+		if evt.Activation {
+			if !a.validation.ValidatePassword(body.Password) {
+				return fiber.NewError(fiber.StatusBadRequest,
+					fmt.Sprintf("password must be at least %d characters and match the password rules", a.cfg.Validation.PasswordMinLength))
+			}
+			hash, err := auth.HashPassword(body.Password)
+			if err != nil {
+				return err
+			}
+			updates["password_hash"] = hash
+			updates["is_active"] = true
+			activated = true
+		}
+
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return db.InvalidateEmailVerificationTokens(tx, user.ID)
+	})
+	if err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return fe
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid or expired token")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to activate account")
+	}
+
+	if activated {
+		return c.JSON(fiber.Map{"message": "account activated"})
+	}
+	return c.JSON(fiber.Map{"message": "email verified"})
+}
+
+// handleResendActivation sends a new activation or verification email to users whose
+// email is not verified yet. Earlier tokens of those users stop working.
+//
+// Like password reset requests, the response is the same whether or not an account matched.
+func (a *API) handleResendActivation(c fiber.Ctx) error {
+	var body struct {
+		Username string `json:"username"` // username or email is required
+		Email    string `json:"email"`
+	}
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+
+	var users []db.User
+	var err error
+	query := scopeToTenant(c, a.iamDB)
+	switch {
+	case body.Username != "":
+		err = query.Where("username = ? AND email_verified = ?", body.Username, false).Find(&users).Error
+	case body.Email != "":
+		err = query.Where("email = ? AND email_verified = ?", body.Email, false).Find(&users).Error
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "username or email is required")
+	}
+	if err != nil {
+		log.Printf("activation resend lookup failed: %v", err)
+	}
+
+	for _, user := range users {
+		if user.Email == "" {
+			continue
+		}
+		// Inactive users only get a new email if they never activated their account;
+		// users deactivated by an administrator must not be able to reactivate themselves
+		activation := !user.IsActive
+		if activation {
+			pending, err := db.PendingActivation(a.iamDB, user.ID)
+			if err != nil || !pending {
+				continue
+			}
+		}
+		a.sendActivationEmailAsync(user, activation)
+	}
+
+	return c.JSON(fiber.Map{"message": activationRequestedMessage})
+}
+
+// sendActivationEmailAsync sends an activation or verification email in the background
+// and logs failures.
+func (a *API) sendActivationEmailAsync(u db.User, activation bool) {
+	go func() {
+		if err := a.sendActivationEmail(u, activation); err != nil {
+			log.Printf("failed to send activation email to user %d: %v", u.ID, err)
+		}
+	}()
+}
+
+// sendActivationEmail generates an email verification token, populates an email template
+// with the provided user information and configuration, and sends it.
+//
+// Parameters:
+//   - u: the user whose email should be verified
+//   - activation: whether the token also activates the account (create-account.html)
+//     or only verifies the email (verify-email.html)
+//
+// Behavior:
+//   - Uses the user's FirstName if available, otherwise falls back to Username
+//   - Invalidates earlier tokens of the user, then stores the hash of a random single-use
+//     token that expires after token.activation_ttl
+//   - Replaces placeholders in the HTML template and sends the email
+func (a *API) sendActivationEmail(u db.User, activation bool) error {
+	// Choose the name to personalize the email
+	_name := u.Username
+	if u.FirstName != "" {
+		_name = u.FirstName
+	}
+
+	// Generate a unique token; only its hash is stored
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := db.InvalidateEmailVerificationTokens(tx, u.ID); err != nil {
+			return err
+		}
+		return tx.Create(&db.EmailVerificationToken{
+			UserID:     u.ID,
+			TokenHash:  auth.HashToken(token),
+			Email:      u.Email,
+			Activation: activation,
+			ExpiresAt:  time.Now().Add(a.cfg.Token.ActivationTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Prepare template placeholders
+	placeholders := map[string]string{
+		"Name":    _name,
+		"AppName": a.cfg.AppName,
+		"Year":    fmt.Sprintf("%d", time.Now().Year()),
+		"Token":   token,
+	}
+
+	subject, tmplt := "Verify Your Email", "verify-email.html"
+	if activation {
+		subject, tmplt = "Activate Your Account", "create-account.html"
+	}
+
+	// Send the email using HTML template
+	return smtpclient.SendEmailFromHTMLTemplate(a.cfg, subject,
+		[]string{u.Email}, filepath.Join(a.cfg.SMTP.TemplateDir, tmplt), placeholders)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+func TestActivate(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	var org db.Organization
+	if err := a.iamDB.Where("slug = ?", "acme").First(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	hash, err := auth.HashPassword("Secret123x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		activation   bool
+		emailChanged bool // the user's email changed after the token was sent
+		ttl          time.Duration
+		password     string
+		wantStatus   int
+		wantActive   bool
+		wantVerified bool
+		wantPassword string // password the user can log in with afterwards, if any
+	}{
+		{"activation", true, false, time.Hour, "NewSecret456y", http.StatusOK, true, true, "NewSecret456y"},
+		{"activation without password", true, false, time.Hour, "", http.StatusBadRequest, false, false, ""},
+		{"activation with weak password", true, false, time.Hour, "short", http.StatusBadRequest, false, false, ""},
+		{"activation after email change", true, true, time.Hour, "NewSecret456y", http.StatusBadRequest, false, false, ""},
+		{"expired activation", true, false, -time.Minute, "NewSecret456y", http.StatusBadRequest, false, false, ""},
+		{"verification ignores the password", false, false, time.Hour, "NewSecret456y", http.StatusOK, true, true, "Secret123x"},
+		{"verification after email change", false, true, time.Hour, "", http.StatusBadRequest, true, false, "Secret123x"},
+	}
+	for i, tt := range tests {
+		user := db.User{
+			Username:       fmt.Sprintf("user%d", i),
+			Email:          fmt.Sprintf("user%d@example.test", i),
+			OrganizationID: org.ID,
+		}
+		if !tt.activation {
+			user.PasswordHash = hash
+		}
+		if err := a.iamDB.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		// Users created by an administrator stay inactive until activated
+		if tt.activation {
+			if err := a.iamDB.Model(&user).Update("is_active", false).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		token, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		evt := db.EmailVerificationToken{
+			UserID:     user.ID,
+			TokenHash:  auth.HashToken(token),
+			Email:      user.Email,
+			Activation: tt.activation,
+			ExpiresAt:  time.Now().Add(tt.ttl),
+		}
+		if tt.emailChanged {
+			evt.Email = "old-" + user.Email
+		}
+		if err := a.iamDB.Create(&evt).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		status, res := doJSON(t, app, http.MethodPost, "/auth/activate", map[string]any{
+			"token": token, "password": tt.password,
+		}, "")
+		if status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+
+		if err := a.iamDB.First(&user, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if user.IsActive != tt.wantActive || user.EmailVerified != tt.wantVerified {
+			t.Errorf("%s: active %v, verified %v, want %v, %v", tt.name, user.IsActive, user.EmailVerified, tt.wantActive, tt.wantVerified)
+		}
+		if tt.wantPassword != "" {
+			status, res := doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+				"username": user.Username, "password": tt.wantPassword, "organization": "acme",
+			}, "")
+			if status != http.StatusOK {
+				t.Errorf("%s: login: %d %v", tt.name, status, res)
+			}
+		}
+
+		// Tokens are single-use
+		if status == http.StatusOK {
+			if status, res := doJSON(t, app, http.MethodPost, "/auth/activate", map[string]any{
+				"token": token, "password": "Other789z",
+			}, ""); status != http.StatusBadRequest {
+				t.Errorf("%s: token reused: got %d %v", tt.name, status, res)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Creating or updating a principal must not attach policies, roles or groups the
+// caller could not attach through the dedicated routes.
+
+func TestServiceAccountAttachmentsRequireAttachActions(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+	fullAccess := policyIDBySlug(t, a, app, admin, "full-access")
+
+	creator := loginAsLimitedUser(t, a, app, admin, "bob", "service_account:create", "service_account:update", "service_account:read")
+
+	status, res := doJSON(t, app, http.MethodPost, "/s/service-accounts", map[string]any{
+		"name": "escalate", "policy_ids": []uint{fullAccess},
+	}, creator)
+	if status != http.StatusForbidden {
+		t.Fatalf("create with policy_ids: got %d %v, want 403", status, res)
+	}
+
+	status, res = doJSON(t, app, http.MethodPost, "/s/service-accounts", map[string]any{"name": "job"}, creator)
+	if status != http.StatusCreated {
+		t.Fatalf("create without attachments: %d %v", status, res)
+	}
+	id := uint(res["service_account"].(map[string]any)["id"].(float64))
+	path := fmt.Sprintf("/s/service-accounts/%d", id)
+
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{fullAccess}}, creator); status != http.StatusForbidden {
+		t.Fatalf("update with policy_ids: got %d %v, want 403", status, res)
+	}
+	// Leaving the attachments unchanged needs no attach action
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"description": "nightly", "policy_ids": []uint{}}, creator); status != http.StatusOK {
+		t.Fatalf("update without new attachments: %d %v", status, res)
+	}
+
+	attacher := loginAsLimitedUser(t, a, app, admin, "carol", "service_account:update", "service_account:attach_policy")
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{fullAccess}}, attacher); status != http.StatusOK {
+		t.Fatalf("update with service_account:attach_policy: %d %v", status, res)
+	}
+	// Removing the policy again requires service_account:detach_policy
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{}}, attacher); status != http.StatusForbidden {
+		t.Fatalf("detach without service_account:detach_policy: got %d %v, want 403", status, res)
+	}
+}
+
+func TestGroupPolicyIDsRequireAttachActions(t *testing.T) {
+	testPolicyIDsRequireAttachActions(t, "group", "/s/groups")
+}
+
+func TestRolePolicyIDsRequireAttachActions(t *testing.T) {
+	testPolicyIDsRequireAttachActions(t, "role", "/s/roles")
+}
+
+// testPolicyIDsRequireAttachActions checks that policy_ids on create and update of the
+// given resource type require <resource>:attach_policy and <resource>:detach_policy.
+func testPolicyIDsRequireAttachActions(t *testing.T, resource, base string) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+	fullAccess := policyIDBySlug(t, a, app, admin, "full-access")
+
+	creator := loginAsLimitedUser(t, a, app, admin, "bob", resource+":create", resource+":update")
+
+	status, res := doJSON(t, app, http.MethodPost, base, map[string]any{
+		"name": "Escalate", "policy_ids": []uint{fullAccess},
+	}, creator)
+	if status != http.StatusForbidden {
+		t.Fatalf("create with policy_ids: got %d %v, want 403", status, res)
+	}
+
+	status, res = doJSON(t, app, http.MethodPost, base, map[string]any{"name": "Ops"}, creator)
+	if status != http.StatusCreated {
+		t.Fatalf("create without policies: %d %v", status, res)
+	}
+	path := fmt.Sprintf("%s/%d", base, uint(res["id"].(float64)))
+
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{fullAccess}}, creator); status != http.StatusForbidden {
+		t.Fatalf("update with policy_ids: got %d %v, want 403", status, res)
+	}
+
+	attacher := loginAsLimitedUser(t, a, app, admin, "carol", resource+":update", resource+":attach_policy")
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{fullAccess}}, attacher); status != http.StatusOK {
+		t.Fatalf("update with %s:attach_policy: %d %v", resource, status, res)
+	}
+	// Unchanged policies need no attach action, removing them requires detach_policy
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"description": "on call", "policy_ids": []uint{fullAccess}}, creator); status != http.StatusOK {
+		t.Fatalf("update with unchanged policy_ids: %d %v", status, res)
+	}
+	if status, res := doJSON(t, app, http.MethodPatch, path, map[string]any{"policy_ids": []uint{}}, attacher); status != http.StatusForbidden {
+		t.Fatalf("detach without %s:detach_policy: got %d %v, want 403", resource, status, res)
+	}
+}
+
+func TestInvitationRolesAndGroupsRequireAssignActions(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+
+	status, role := doJSON(t, app, http.MethodPost, "/s/roles", map[string]any{"name": "Admins"}, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("create role: %d %v", status, role)
+	}
+	status, group := doJSON(t, app, http.MethodPost, "/s/groups", map[string]any{"name": "Admins"}, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("create group: %d %v", status, group)
+	}
+	roleIDs := []uint{uint(role["id"].(float64))}
+	groupIDs := []uint{uint(group["id"].(float64))}
+
+	inviter := loginAsLimitedUser(t, a, app, admin, "bob", "invitation:create")
+	for name, body := range map[string]map[string]any{
+		"role_ids":  {"email": "bob2@example.test", "role_ids": roleIDs},
+		"group_ids": {"email": "bob2@example.test", "group_ids": groupIDs},
+	} {
+		if status, res := doJSON(t, app, http.MethodPost, "/s/org/invitations", body, inviter); status != http.StatusForbidden {
+			t.Errorf("invite with %s: got %d %v, want 403", name, status, res)
+		}
+	}
+	if status, res := doJSON(t, app, http.MethodPost, "/s/org/invitations", map[string]any{"email": "dave@example.test"}, inviter); status != http.StatusCreated {
+		t.Fatalf("invite without roles or groups: %d %v", status, res)
+	}
+
+	assigner := loginAsLimitedUser(t, a, app, admin, "carol", "invitation:create", "role:assign", "group:add_member")
+	status, res := doJSON(t, app, http.MethodPost, "/s/org/invitations", map[string]any{
+		"email": "erin@example.test", "role_ids": roleIDs, "group_ids": groupIDs,
+	}, assigner)
+	if status != http.StatusCreated {
+		t.Fatalf("invite with role:assign and group:add_member: %d %v", status, res)
+	}
+}
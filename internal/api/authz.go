@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// maxAuthzBatch limits the number of checks evaluated by one batch request.
+const maxAuthzBatch = 100
+
+// authzSubject identifies the principal an authorization check is evaluated for.
+type authzSubject struct {
+	Type string `json:"type"` // "user" (default) or "service_account"
+	ID   uint   `json:"id"`   // required
+}
+
+// authzCheckInput represents one authorization check.
+type authzCheckInput struct {
+	Subject  *authzSubject     `json:"subject"`  // optional, defaults to the caller
+	Action   string            `json:"action"`   // required, e.g. "invoice:read"
+	Resource string            `json:"resource"` // required, e.g. "org:1:invoice:42"
+	Context  db.RequestContext `json:"context"`  // optional request attributes (source_ip, mfa, current_time) for statement conditions
+}
+
+// authzBatchInput represents the expected JSON structure for a batch of checks.
+type authzBatchInput struct {
+	Checks []authzCheckInput `json:"checks"`
+}
+
+// authzStatementView identifies the statement that decided a check.
+type authzStatementView struct {
+	PolicyID    uint   `json:"policy_id"`
+	PolicyName  string `json:"policy_name"`
+	StatementID uint   `json:"statement_id"`
+	Effect      string `json:"effect"`
+}
+
+// authzCheckResult is the result of one authorization check.
+//
+// Decision is "allow", "explicit_deny" (a Deny statement matched) or
+// "implicit_deny" (no Allow statement matched).
+type authzCheckResult struct {
+	Allowed   bool                `json:"allowed"`
+	Decision  string              `json:"decision"`
+	Statement *authzStatementView `json:"matched_statement,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// newAuthzCheckResult converts a policy decision into its JSON representation.
+func newAuthzCheckResult(d db.Decision) authzCheckResult {
+	res := authzCheckResult{Allowed: d.Allowed, Decision: "implicit_deny"}
+	if d.Statement != nil {
+		res.Statement = &authzStatementView{
+			PolicyID:    d.Policy.ID,
+			PolicyName:  d.Policy.Name,
+			StatementID: d.Statement.ID,
+			Effect:      d.Statement.Effect,
+		}
+		res.Decision = "explicit_deny"
+		if d.Allowed {
+			res.Decision = "allow"
+		}
+	}
+	return res
+}
+
+// handleAuthzCheck evaluates whether a subject may perform an action on a resource,
+// so other services can delegate authorization decisions to goIAM.
+//
+// The subject must belong to the caller's organization; without a subject the
+// caller itself is checked. Checks for inactive subjects are always denied.
+func (a *API) handleAuthzCheck(c fiber.Ctx) error {
+	caller, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body authzCheckInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if body.Action == "" || body.Resource == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "action and resource are required")
+	}
+
+	subject, err := a.loadAuthzSubject(caller, body.Subject)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(authzCheck(subject, body.Action, body.Resource, body.Context))
+}
+
+// handleAuthzCheckBatch evaluates up to maxAuthzBatch checks in one call.
+//
+// Results are returned in the order of the checks. An invalid check (unknown
+// subject, missing action or resource) is reported as denied with an error
+// instead of failing the whole batch.
+func (a *API) handleAuthzCheckBatch(c fiber.Ctx) error {
+	caller, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body authzBatchInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if len(body.Checks) == 0 || len(body.Checks) > maxAuthzBatch {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("checks must contain between 1 and %d entries", maxAuthzBatch))
+	}
+
+	// Each subject is loaded only once per batch
+	subjects := map[authzSubject]db.Principal{}
+
+	results := make([]authzCheckResult, 0, len(body.Checks))
+	for _, check := range body.Checks {
+		if check.Action == "" || check.Resource == "" {
+			results = append(results, authzCheckResult{Decision: "implicit_deny", Error: "action and resource are required"})
+			continue
+		}
+
+		key := authzSubject{Type: caller.PrincipalType(), ID: caller.PrincipalID()}
+		if check.Subject != nil {
+			key = *check.Subject
+		}
+		subject, ok := subjects[key]
+		if !ok {
+			var err error
+			if subject, err = a.loadAuthzSubject(caller, &key); err != nil {
+				results = append(results, authzCheckResult{Decision: "implicit_deny", Error: err.Error()})
+				continue
+			}
+			subjects[key] = subject
+		}
+
+		results = append(results, authzCheck(subject, check.Action, check.Resource, check.Context))
+	}
+
+	return c.JSON(fiber.Map{"results": results})
+}
+
+// authzCheck evaluates a check for a loaded subject. Inactive users and service accounts
+// cannot use their permissions, so every check for them is denied.
+func authzCheck(subject db.Principal, action, resource string, ctx db.RequestContext) authzCheckResult {
+	active := true
+	switch p := subject.(type) {
+	case db.User:
+		active = p.IsActive
+	case db.ServiceAccount:
+		active = p.IsActive
+	}
+	if !active {
+		return authzCheckResult{Decision: "implicit_deny", Error: "subject is inactive"}
+	}
+	return newAuthzCheckResult(db.Authorize(subject, action, resource, ctx))
+}
+
+// loadAuthzSubject loads the subject of a check with its policies, limited to the
+// caller's organization. A nil subject refers to the caller.
+func (a *API) loadAuthzSubject(caller db.Principal, s *authzSubject) (db.Principal, error) {
+	if s == nil {
+		s = &authzSubject{Type: caller.PrincipalType(), ID: caller.PrincipalID()}
+	}
+	if s.Type == "" {
+		s.Type = db.PrincipalUser
+	}
+	if s.Type != db.PrincipalUser && s.Type != db.PrincipalServiceAccount {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "subject type must be user or service_account")
+	}
+
+	subject, err := db.LoadPrincipal(a.iamDB, s.Type, s.ID, caller.PrincipalOrgID())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "subject not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load subject")
+	}
+	return subject, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+func TestAuthzCheckDeniesInactiveSubject(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+	loginAsLimitedUser(t, a, app, admin, "bob", "invoice:read")
+
+	var bob db.User
+	if err := a.iamDB.Where("username = ?", "bob").First(&bob).Error; err != nil {
+		t.Fatal(err)
+	}
+	check := map[string]any{
+		"subject":  map[string]any{"type": "user", "id": bob.ID},
+		"action":   "invoice:read",
+		"resource": "org:1:invoice:42",
+	}
+
+	if status, res := doJSON(t, app, http.MethodPost, "/s/authz/check", check, admin); status != http.StatusOK || res["allowed"] != true {
+		t.Fatalf("active subject: %d %v", status, res)
+	}
+
+	if err := a.iamDB.Model(&bob).Update("is_active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	status, res := doJSON(t, app, http.MethodPost, "/s/authz/check", check, admin)
+	if status != http.StatusOK || res["allowed"] != false || res["decision"] != "implicit_deny" {
+		t.Fatalf("inactive subject: got %d %v, want denied", status, res)
+	}
+
+	status, res = doJSON(t, app, http.MethodPost, "/s/authz/check/batch", map[string]any{"checks": []any{check}}, admin)
+	results, _ := res["results"].([]any)
+	if status != http.StatusOK || len(results) != 1 || results[0].(map[string]any)["allowed"] != false {
+		t.Fatalf("inactive subject in batch: got %d %v, want denied", status, res)
+	}
+}
+
+func TestAuthzCheckDenyWithoutMFAAppliesWhenContextOmitsMFA(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+	loginAsLimitedUser(t, a, app, admin, "bob", "invoice:read")
+
+	status, res := doJSON(t, app, http.MethodPost, "/s/policies", map[string]any{
+		"name": "RequireMFA",
+		"document": map[string]any{
+			"Statement": []map[string]any{{
+				"Effect": "Deny", "Action": "invoice:*", "Resource": "*",
+				"Condition": map[string]any{"Bool": map[string]any{"mfa": "false"}},
+			}},
+		},
+	}, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("create policy: %d %v", status, res)
+	}
+	var bob db.User
+	if err := a.iamDB.Where("username = ?", "bob").First(&bob).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.iamDB.Model(&bob).Association("Policies").Append(&db.Policy{Model: gorm.Model{ID: uint(res["id"].(float64))}}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := map[string]any{
+		"subject":  map[string]any{"type": "user", "id": bob.ID},
+		"action":   "invoice:read",
+		"resource": "org:1:invoice:42",
+	}
+	for _, ctx := range []map[string]any{nil, {"source_ip": "10.1.2.3"}, {"mfa": "false"}} {
+		check["context"] = ctx
+		if status, res := doJSON(t, app, http.MethodPost, "/s/authz/check", check, admin); status != http.StatusOK || res["decision"] != "explicit_deny" {
+			t.Errorf("context %v: got %d %v, want explicit_deny", ctx, status, res)
+		}
+	}
+
+	check["context"] = map[string]any{"mfa": "true"}
+	if status, res := doJSON(t, app, http.MethodPost, "/s/authz/check", check, admin); status != http.StatusOK || res["allowed"] != true {
+		t.Errorf("context with mfa: got %d %v, want allow", status, res)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// federationStateTTL is how long a login started at an upstream provider can take.
+const federationStateTTL = 10 * time.Minute
+
+// federationCookie holds the state of a federated login in the browser, binding the
+// callback to the browser that started the login.
+const federationCookie = "goiam_federation_state"
+
+// federatedProvider returns the configured provider with federation support named by
+// the :provider route parameter, or 404.
+//
+// On a tenant's domain, only providers logging users in to that tenant are available.
+func (a *API) federatedProvider(c fiber.Ctx) (FederatedProvider, error) {
+	name := c.Params("provider")
+	for _, p := range a.providers {
+		fp, ok := p.(FederatedProvider)
+		if !ok || !p.Capabilities().Federation || p.Name() != name {
+			continue
+		}
+		if tenant, ok := c.Locals("tenant").(db.Organization); ok && tenant.Slug != fp.Organization() {
+			break
+		}
+		return fp, nil
+	}
+	return nil, fiber.NewError(fiber.StatusNotFound, "unknown identity provider")
+}
+
+// federationCookiePath scopes the state cookie to the routes of one provider.
+func federationCookiePath(provider string) string {
+	return "/auth/federation/" + provider
+}
+
+// handleFederationStart redirects the browser to an upstream identity provider to log in.
+//
+// Query parameters:
+//   - device_id: optional device the refresh token is bound to
+//
+// The state, nonce and PKCE verifier of the login are stored hashed or server-side;
+// the state is also set in an HttpOnly cookie checked by the callback.
+func (a *API) handleFederationStart(c fiber.Ctx) error {
+	p, err := a.federatedProvider(c)
+	if err != nil {
+		return err
+	}
+
+	state, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to start login")
+	}
+	nonce, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to start login")
+	}
+	verifier, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to start login")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	target, err := p.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		log.Printf("%s: %v", p.Name(), err)
+		return fiber.NewError(fiber.StatusBadGateway, "identity provider is unavailable")
+	}
+
+	expiresAt := time.Now().Add(federationStateTTL)
+	if err := a.iamDB.Create(&db.FederationState{
+		StateHash:    auth.HashToken(state),
+		Provider:     p.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		DeviceID:     deviceID(c, c.Query("device_id")),
+		ExpiresAt:    expiresAt,
+	}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to start login")
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     federationCookie,
+		Value:    state,
+		Path:     federationCookiePath(p.Name()),
+		Expires:  expiresAt,
+		Secure:   c.Secure(),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode, // sent on the top-level redirect back from the provider
+	})
+	return c.Redirect().Status(fiber.StatusFound).To(target)
+}
+
+// handleFederationCallback completes a login at an upstream identity provider.
+//
+// Query parameters (set by the provider):
+//   - code: authorization code
+//   - state: must match the state cookie set by handleFederationStart
+//   - error, error_description: the login failed or was cancelled at the provider
+//
+// Responds like /auth/login: with tokens, or a 2FA challenge for users requiring 2FA.
+func (a *API) handleFederationCallback(c fiber.Ctx) error {
+	p, err := a.federatedProvider(c)
+	if err != nil {
+		return err
+	}
+
+	state := c.Query("state")
+	cookie := c.Cookies(federationCookie)
+	// The state is single-use, so the cookie is cleared whatever the outcome
+	c.Cookie(&fiber.Cookie{
+		Name:     federationCookie,
+		Path:     federationCookiePath(p.Name()),
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Secure(),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if upstreamErr := c.Query("error"); upstreamErr != "" {
+		msg := "login failed at identity provider: " + upstreamErr
+		if desc := c.Query("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		return fiber.NewError(fiber.StatusBadRequest, msg)
+	}
+	code := c.Query("code")
+	if code == "" || state == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "code and state are required")
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid or expired login state")
+	}
+
+	fs, err := db.ConsumeFederationState(a.iamDB, auth.HashToken(state), p.Name())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid or expired login state")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to complete login")
+	}
+
+	user, err := p.Exchange(c, code, fs.CodeVerifier, fs.Nonce)
+	if err != nil {
+		return err
+	}
+	return a.completeLogin(c, user, "", fs.DeviceID)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFederationCallbackChecksStateCookie(t *testing.T) {
+	_, app, iss := newOIDCTestAPI(t)
+
+	claimsFor := func(login federatedLogin) jwt.MapClaims {
+		claims := iss.claims("upstream-state", login.params.Get("nonce"))
+		claims["email"], claims["email_verified"] = "state@example.com", true
+		return claims
+	}
+
+	login := startFederatedLogin(t, app, iss)
+	other := startFederatedLogin(t, app, iss)
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie *http.Cookie
+	}{
+		{"no cookie", login.params.Get("state"), nil},
+		{"cookie of another login", login.params.Get("state"), other.cookie},
+		{"state of another login", other.params.Get("state"), login.cookie},
+		{"unknown state", "forged-state", &http.Cookie{Name: federationCookie, Value: "forged-state"}},
+	}
+	for _, tt := range tests {
+		code := iss.issue(t, claimsFor(login), iss.key)
+		if status, res := login.callback(t, app, code, tt.state, tt.cookie); status != http.StatusBadRequest {
+			t.Errorf("%s: got %d %v, want 400", tt.name, status, res)
+		}
+	}
+
+	// The matching state and cookie complete the login, once
+	code := iss.issue(t, claimsFor(login), iss.key)
+	if status, res := login.callback(t, app, code, login.params.Get("state"), login.cookie); status != http.StatusOK {
+		t.Fatalf("matching state and cookie: %d %v", status, res)
+	}
+	code = iss.issue(t, claimsFor(login), iss.key)
+	if status, res := login.callback(t, app, code, login.params.Get("state"), login.cookie); status != http.StatusBadRequest {
+		t.Errorf("replayed state: got %d %v, want 400", status, res)
+	}
+}
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// handleGroupInput represents the expected JSON structure for creating or updating a group.
+// Empty fields are left unchanged on update; a nil policy list is left unchanged.
+type handleGroupInput struct {
+	Name        string `json:"name"`        // required on create
+	Slug        string `json:"slug"`        // optional, generated from the name if empty
+	Description string `json:"description"` // optional
+	PolicyIDs   []uint `json:"policy_ids"`  // optional, attached policies
+}
+
+// groupView is the JSON representation of a group.
+type groupView struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	PolicyIDs   []uint    `json:"policy_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// memberView is the JSON representation of a user in a group membership or role assignment list.
+type memberView struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// newGroupView converts a group with preloaded policies into its JSON representation.
+func newGroupView(g db.Group) groupView {
+	v := groupView{
+		ID:          g.ID,
+		Name:        g.Name,
+		Slug:        g.Slug,
+		Description: g.Description,
+		PolicyIDs:   []uint{},
+		CreatedAt:   g.CreatedAt,
+	}
+	for _, p := range g.Policies {
+		v.PolicyIDs = append(v.PolicyIDs, p.ID)
+	}
+	return v
+}
+
+// newMemberView converts a user into a membership list entry.
+func newMemberView(u db.User) memberView {
+	return memberView{ID: u.ID, Username: u.Username, Email: u.Email}
+}
+
+// handleCreateGroup creates a group in the caller's organization.
+func (a *API) handleCreateGroup(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handleGroupInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	slug, err := validSlug(body.Slug, body.Name)
+	if err != nil {
+		return err
+	}
+	if err := a.checkAttachAccess(c, nil, body.PolicyIDs, "group:attach_policy", "group:detach_policy", "org:{org_id}:group"); err != nil {
+		return err
+	}
+
+	group := db.Group{
+		Name:           strings.TrimSpace(body.Name),
+		Slug:           slug,
+		Description:    body.Description,
+		OrganizationID: principal.PrincipalOrgID(),
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return replacePolicies(tx, &group, body.PolicyIDs, group.OrganizationID)
+	})
+	if err != nil {
+		return groupError(err, "failed to create group")
+	}
+
+	if err := a.iamDB.Preload("Policies").First(&group, group.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load group")
+	}
+	return c.Status(fiber.StatusCreated).JSON(newGroupView(group))
+}
+
+// handleListGroups lists the groups of the caller's organization, paginated
+// with the page and page_size query parameters.
+func (a *API) handleListGroups(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	query := a.iamDB.Model(&db.Group{}).Where("organization_id = ?", principal.PrincipalOrgID())
+	page, err := paginate(c, query, newGroupView, "Policies")
+	if err != nil {
+		return listError(err, "failed to list groups")
+	}
+	return c.JSON(page)
+}
+
+// handleGetGroup returns a group of the caller's organization by ID or slug.
+func (a *API) handleGetGroup(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newGroupView(*group))
+}
+
+// handleUpdateGroup updates the name, slug, description or policies of a group.
+func (a *API) handleUpdateGroup(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var body handleGroupInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	updates := map[string]any{}
+	if strings.TrimSpace(body.Name) != "" {
+		updates["name"] = strings.TrimSpace(body.Name)
+	}
+	if body.Slug != "" {
+		slug, err := validSlug(body.Slug, "")
+		if err != nil {
+			return err
+		}
+		updates["slug"] = slug
+	}
+	if body.Description != "" {
+		updates["description"] = body.Description
+	}
+	if err := a.checkAttachAccess(c, policyIDs(group.Policies), body.PolicyIDs,
+		"group:attach_policy", "group:detach_policy", "org:{org_id}:group"); err != nil {
+		return err
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(group).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return replacePolicies(tx, group, body.PolicyIDs, group.OrganizationID)
+	})
+	if err != nil {
+		return groupError(err, "failed to update group")
+	}
+
+	if err := a.iamDB.Preload("Policies").First(group, group.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load group")
+	}
+	return c.JSON(newGroupView(*group))
+}
+
+// handleDeleteGroup deletes a group. Its members lose the policies attached to it.
+func (a *API) handleDeleteGroup(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Users").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(group).Association("Policies").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM service_account_groups WHERE group_id = ?", group.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete group")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleListGroupMembers lists the users in a group, paginated.
+func (a *API) handleListGroupMembers(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+
+	query := a.iamDB.Model(&db.User{}).
+		Where("id IN (?)", a.iamDB.Table("user_groups").Select("user_id").Where("group_id = ?", group.ID))
+	page, err := paginate(c, query, newMemberView)
+	if err != nil {
+		return listError(err, "failed to list group members")
+	}
+	return c.JSON(page)
+}
+
+// handleAddGroupMember adds a user of the same organization to a group.
+func (a *API) handleAddGroupMember(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+	user, err := a.loadMember(c, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(group).Association("Users").Append(user); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to add group member")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleRemoveGroupMember removes a user from a group.
+func (a *API) handleRemoveGroupMember(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+	user, err := a.loadMember(c, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(group).Association("Users").Delete(user); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to remove group member")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleAttachGroupPolicy attaches a policy of the same organization to a group.
+func (a *API) handleAttachGroupPolicy(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+	policy, err := a.loadAttachablePolicy(c, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(group).Association("Policies").Append(policy); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to attach policy")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleDetachGroupPolicy detaches a policy from a group.
+func (a *API) handleDetachGroupPolicy(c fiber.Ctx) error {
+	group, err := a.loadGroup(c)
+	if err != nil {
+		return err
+	}
+	policy, err := a.loadAttachablePolicy(c, group.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(group).Association("Policies").Delete(policy); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to detach policy")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadGroup loads the group identified by the :group route parameter (an ID or a slug)
+// within the caller's organization, with its policies preloaded.
+func (a *API) loadGroup(c fiber.Ctx) (*db.Group, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	var group db.Group
+	if err := whereIDOrSlug(a.iamDB.Preload("Policies"), c.Params("group")).
+		Where("organization_id = ?", principal.PrincipalOrgID()).
+		First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "group not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load group")
+	}
+	return &group, nil
+}
+
+// loadMember loads the user identified by the :user_id route parameter within orgID.
+func (a *API) loadMember(c fiber.Ctx, orgID uint) (*db.User, error) {
+	id := fiber.Params[uint](c, "user_id")
+	if id == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid user ID")
+	}
+
+	var user db.User
+	if err := a.iamDB.Where("id = ? AND organization_id = ?", id, orgID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "user not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
+	return &user, nil
+}
+
+// loadAttachablePolicy loads the policy identified by the :policy_id route parameter within orgID.
+func (a *API) loadAttachablePolicy(c fiber.Ctx, orgID uint) (*db.Policy, error) {
+	id := fiber.Params[uint](c, "policy_id")
+	if id == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid policy ID")
+	}
+
+	var policy db.Policy
+	if err := a.iamDB.Where("id = ? AND organization_id = ?", id, orgID).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "policy not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load policy")
+	}
+	return &policy, nil
+}
+
+// replacePolicies replaces the policies attached to model (a group or role) with
+// the policies of orgID with the given IDs. A nil list is left unchanged.
+func replacePolicies[T any](tx *gorm.DB, model *T, policyIDs []uint, orgID uint) error {
+	if policyIDs == nil {
+		return nil
+	}
+	var policies []db.Policy
+	if err := findInOrg(tx, &policies, policyIDs, orgID); err != nil {
+		return err
+	}
+	return tx.Model(model).Association("Policies").Replace(policies)
+}
+
+// policyIDs returns the IDs of the given policies.
+func policyIDs(policies []db.Policy) []uint {
+	ids := make([]uint, 0, len(policies))
+	for _, p := range policies {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// whereIDOrSlug filters by primary key if key is numeric and by slug otherwise.
+func whereIDOrSlug(tx *gorm.DB, key string) *gorm.DB {
+	if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return tx.Where("id = ?", id)
+	}
+	return tx.Where("slug = ?", key)
+}
+
+// validSlug returns the given slug, or one generated from name if it is empty.
+// Slugs must be URL-safe and not purely numeric, so they cannot be mistaken for IDs.
+func validSlug(slug, name string) (string, error) {
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if slug == "" || slug != slugify(slug) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "slug must consist of lowercase letters, digits and dashes")
+	}
+	if _, err := strconv.ParseUint(slug, 10, 64); err == nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "slug must not be numeric")
+	}
+	return slug, nil
+}
+
+// groupError maps errors from creating or updating a group to HTTP errors.
+func groupError(err error, msg string) error {
+	if errors.Is(err, errForeignAttachment) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+		return fiber.NewError(fiber.StatusConflict, "group name or slug already exists")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
+
+// listError passes through *fiber.Error values from paginate and maps other errors to msg.
+func listError(err error, msg string) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestAPI starts an API on a fresh SQLite database in a temporary directory.
+//
+// extraConfig is appended to a minimal YAML config, so tests can configure
+// providers and other settings the way operators do.
+func newTestAPI(t *testing.T, extraConfig string) (*API, *fiber.App) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	yaml := "appName: goIAM-test\n" +
+		"database: sqlite\n" +
+		"database_dsn: \"file:" + filepath.Join(dir, "iam.db") + "?_busy_timeout=5000&_txlock=immediate\"\n" +
+		"signing:\n  algorithm: ES256\n" +
+		"policy:\n  actions:\n    invoice: [read, list]\n" +
+		extraConfig
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IAM_CONFIG_PATH", "")
+
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	for service, verbs := range cfg.Policy.Actions {
+		db.RegisterActions(service, verbs...)
+	}
+
+	iamDB := db.Init(cfg.Database, cfg.DatabaseDSN)
+	iamDB.Logger = logger.Default.LogMode(logger.Silent)
+	db.InvalidatePolicyCache()
+	t.Cleanup(func() {
+		if sqlDB, err := iamDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	km, err := keys.NewManager(cfg, iamDB)
+	if err != nil {
+		t.Fatalf("key manager: %v", err)
+	}
+	a, err := New(cfg, iamDB, km)
+	if err != nil {
+		t.Fatalf("new API: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(middleware.ResolveTenant(a.cfg, a.iamDB))
+	a.registerRoutes(app)
+	a._app = app
+	return a, app
+}
+
+// doJSON sends a request with an optional JSON body and bearer token and
+// returns the status code and the decoded JSON response (nil if not JSON).
+func doJSON(t *testing.T, app *fiber.App, method, path string, body any, token string) (int, map[string]any) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return sendRequest(t, app, req)
+}
+
+// doForm posts a form-encoded body, as OAuth token requests do.
+func doForm(t *testing.T, app *fiber.App, path string, form url.Values) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return sendRequest(t, app, req)
+}
+
+// sendRequest runs the request against the app and decodes a JSON response.
+func sendRequest(t *testing.T, app *fiber.App, req *http.Request) (int, map[string]any) {
+	t.Helper()
+
+	res, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(res.Body)
+	var out map[string]any
+	if json.Unmarshal(data, &out) != nil {
+		out = map[string]any{"body": string(data)}
+	}
+	return res.StatusCode, out
+}
+
+// registerAndLogin registers a user creating the given organization (the first user
+// of an organization receives full access) and returns a first-party access token.
+func registerAndLogin(t *testing.T, app *fiber.App, username, email, orgSlug string) string {
+	t.Helper()
+
+	status, res := doJSON(t, app, http.MethodPost, "/auth/register", map[string]any{
+		"username":          username,
+		"password":          "Secret123x",
+		"email":             email,
+		"organization_slug": orgSlug,
+	}, "")
+	if status != http.StatusOK && status != http.StatusCreated {
+		t.Fatalf("register %s: %d %v", username, status, res)
+	}
+
+	status, res = doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+		"username":     username,
+		"password":     "Secret123x",
+		"organization": orgSlug,
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("login %s: %d %v", username, status, res)
+	}
+	token, _ := res["token"].(string)
+	if token == "" {
+		t.Fatalf("login %s: no token in %v", username, res)
+	}
+	return token
+}
+
+// loginAsLimitedUser creates an active user in the organization of the admin token,
+// allowed only the given actions by a policy of their own, and logs them in.
+func loginAsLimitedUser(t *testing.T, a *API, app *fiber.App, admin, username string, actions ...string) string {
+	t.Helper()
+
+	status, org := doJSON(t, app, http.MethodGet, "/s/org", nil, admin)
+	if status != http.StatusOK {
+		t.Fatalf("get org: %d %v", status, org)
+	}
+	slug, _ := org["slug"].(string)
+
+	status, res := doJSON(t, app, http.MethodPost, "/s/policies", map[string]any{
+		"name": username + "-policy",
+		"document": map[string]any{
+			"Statement": []map[string]any{{"Effect": "Allow", "Action": actions, "Resource": "*"}},
+		},
+	}, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("create policy: %d %v", status, res)
+	}
+	policyID := uint(res["id"].(float64))
+
+	hash, err := auth.HashPassword("Secret123x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := db.User{
+		Username:       username,
+		Email:          username + "@example.test",
+		PasswordHash:   hash,
+		IsActive:       true,
+		OrganizationID: uint(org["id"].(float64)),
+	}
+	if err := a.iamDB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.iamDB.Model(&user).Association("Policies").Append(&db.Policy{Model: gorm.Model{ID: policyID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, res = doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+		"username": username, "password": "Secret123x", "organization": slug,
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("login %s: %d %v", username, status, res)
+	}
+	return res["token"].(string)
+}
+
+// policyIDBySlug returns the ID of a seeded policy of the admin's organization, e.g. "full-access".
+func policyIDBySlug(t *testing.T, a *API, app *fiber.App, admin, slug string) uint {
+	t.Helper()
+
+	_, org := doJSON(t, app, http.MethodGet, "/s/org", nil, admin)
+	var policy db.Policy
+	if err := a.iamDB.Where("slug = ? AND organization_id = ?", slug, uint(org["id"].(float64))).First(&policy).Error; err != nil {
+		t.Fatalf("policy %s: %v", slug, err)
+	}
+	return policy.ID
+}
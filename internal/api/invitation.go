@@ -0,0 +1,332 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+	"github.com/javadmohebbi/goIAM/internal/smtpclient"
+	"gorm.io/gorm"
+)
+
+// handleInvitationInput represents the expected JSON structure for inviting someone
+// into the caller's organization.
+type handleInvitationInput struct {
+	Email    string `json:"email"`     // required
+	RoleIDs  []uint `json:"role_ids"`  // optional, roles assigned on acceptance
+	GroupIDs []uint `json:"group_ids"` // optional, groups joined on acceptance
+}
+
+// handleAcceptInvitationInput represents the expected JSON structure for accepting an
+// invitation. The email of the new user is the address the invitation was sent to.
+type handleAcceptInvitationInput struct {
+	Token       string `json:"token"`        // required
+	Username    string `json:"username"`     // required
+	Password    string `json:"password"`     // required, validated by the password rules
+	PhoneNumber string `json:"phone_number"` // optional, validated if present
+	FirstName   string `json:"first_name"`   // optional
+	MiddleName  string `json:"middle_name"`  // optional
+	LastName    string `json:"last_name"`    // optional
+	Address     string `json:"address"`      // optional
+}
+
+// invitationView is the JSON representation of an invitation, without its token.
+type invitationView struct {
+	ID          uint       `json:"id"`
+	Email       string     `json:"email"`
+	Status      string     `json:"status"` // "pending", "accepted" or "expired"
+	RoleIDs     []uint     `json:"role_ids"`
+	GroupIDs    []uint     `json:"group_ids"`
+	InvitedByID uint       `json:"invited_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// newInvitationView converts an invitation with preloaded roles and groups into its JSON representation.
+func newInvitationView(inv db.Invitation) invitationView {
+	v := invitationView{
+		ID:          inv.ID,
+		Email:       inv.Email,
+		Status:      "pending",
+		RoleIDs:     []uint{},
+		GroupIDs:    []uint{},
+		InvitedByID: inv.InvitedByID,
+		ExpiresAt:   inv.ExpiresAt,
+		AcceptedAt:  inv.AcceptedAt,
+		CreatedAt:   inv.CreatedAt,
+	}
+	switch {
+	case inv.AcceptedAt != nil:
+		v.Status = "accepted"
+	case time.Now().After(inv.ExpiresAt):
+		v.Status = "expired"
+	}
+	for _, r := range inv.Roles {
+		v.RoleIDs = append(v.RoleIDs, r.ID)
+	}
+	for _, g := range inv.Groups {
+		v.GroupIDs = append(v.GroupIDs, g.ID)
+	}
+	return v
+}
+
+// handleCreateInvitation invites someone by email into the caller's organization.
+// The invitation email is sent in the background.
+//
+// Listing roles or groups also requires role:assign or group:add_member, as the
+// invited user receives them without any further check.
+func (a *API) handleCreateInvitation(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	orgID := principal.PrincipalOrgID()
+
+	var body handleInvitationInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	body.Email = strings.TrimSpace(body.Email)
+	if !a.validation.ValidateEmail(body.Email) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid email format")
+	}
+	if err := a.checkAttachAccess(c, nil, body.RoleIDs, "role:assign", "role:unassign", "org:{org_id}:role"); err != nil {
+		return err
+	}
+	if err := a.checkAttachAccess(c, nil, body.GroupIDs, "group:add_member", "group:remove_member", "org:{org_id}:group"); err != nil {
+		return err
+	}
+
+	var existing int64
+	if err := a.iamDB.Model(&db.User{}).
+		Where("email = ? AND organization_id = ?", body.Email, orgID).
+		Count(&existing).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create invitation")
+	}
+	if existing > 0 {
+		return fiber.NewError(fiber.StatusConflict, "a user with this email already exists")
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create invitation")
+	}
+
+	inv := db.Invitation{
+		OrganizationID: orgID,
+		Email:          body.Email,
+		TokenHash:      auth.HashToken(token),
+		ExpiresAt:      time.Now().Add(a.cfg.Token.InvitationTTL),
+	}
+	if user, ok := c.Locals("user").(db.User); ok {
+		inv.InvitedByID = user.ID
+	}
+
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := findInOrg(tx, &inv.Roles, body.RoleIDs, orgID); err != nil {
+			return err
+		}
+		if err := findInOrg(tx, &inv.Groups, body.GroupIDs, orgID); err != nil {
+			return err
+		}
+		return tx.Create(&inv).Error
+	})
+	if err != nil {
+		if errors.Is(err, errForeignAttachment) {
+			return fiber.NewError(fiber.StatusBadRequest, "roles and groups must belong to the organization")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create invitation")
+	}
+
+	go func() {
+		if err := a.sendInvitationEmail(inv, token, principal); err != nil {
+			log.Printf("failed to send invitation %d: %v", inv.ID, err)
+		}
+	}()
+
+	return c.Status(fiber.StatusCreated).JSON(newInvitationView(inv))
+}
+
+// handleListInvitations lists the invitations of the caller's organization, paginated
+// with the page and page_size query parameters. Revoked invitations are not listed.
+func (a *API) handleListInvitations(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	query := a.iamDB.Model(&db.Invitation{}).Where("organization_id = ?", principal.PrincipalOrgID())
+	page, err := paginate(c, query, newInvitationView, "Roles", "Groups")
+	if err != nil {
+		return listError(err, "failed to list invitations")
+	}
+	return c.JSON(page)
+}
+
+// handleRevokeInvitation revokes a pending invitation so its link stops working.
+func (a *API) handleRevokeInvitation(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	id := fiber.Params[uint](c, "id")
+	if id == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid invitation ID")
+	}
+
+	var inv db.Invitation
+	if err := a.iamDB.Where("id = ? AND organization_id = ?", id, principal.PrincipalOrgID()).
+		First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "invitation not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load invitation")
+	}
+	if inv.AcceptedAt != nil {
+		return fiber.NewError(fiber.StatusConflict, "invitation was already accepted")
+	}
+
+	if err := a.iamDB.Delete(&inv).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to revoke invitation")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleAcceptInvitation registers a new user into the organization of an invitation.
+//
+// The user gets the invitation's email (already verified by receiving the invitation),
+// the SelfManage policy, and the roles and groups of the invitation.
+func (a *API) handleAcceptInvitation(c fiber.Ctx) error {
+	var body handleAcceptInvitationInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	body.Username = strings.TrimSpace(body.Username)
+	if body.Token == "" || body.Username == "" || body.Password == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "token, username and password are required")
+	}
+	if !a.validation.ValidatePassword(body.Password) {
+		return fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("password must be at least %d characters and match the password rules", a.cfg.Validation.PasswordMinLength))
+	}
+	if body.PhoneNumber != "" && !a.validation.ValidatePhone(body.PhoneNumber) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid phone number format")
+	}
+
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to hash password")
+	}
+
+	var user db.User
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		inv, err := db.ConsumeInvitation(tx, auth.HashToken(strings.TrimSpace(body.Token)))
+		if err != nil {
+			return err
+		}
+		// On a tenant host, only invitations of that tenant are valid
+		if middleware.CheckTenant(c, inv.OrganizationID) != nil {
+			return gorm.ErrRecordNotFound
+		}
+
+		user = db.User{
+			Username:       body.Username,
+			Email:          inv.Email,
+			EmailVerified:  true,
+			PhoneNumber:    body.PhoneNumber,
+			FirstName:      body.FirstName,
+			MiddleName:     body.MiddleName,
+			LastName:       body.LastName,
+			Address:        body.Address,
+			PasswordHash:   hash,
+			IsActive:       true,
+			OrganizationID: inv.OrganizationID,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(inv).Update("accepted_user_id", user.ID).Error; err != nil {
+			return err
+		}
+
+		var selfManage db.Policy
+		if err := tx.Where("slug = ? AND organization_id = ?", "self-manage", inv.OrganizationID).
+			First(&selfManage).Error; err == nil {
+			if err := tx.Model(&user).Association("Policies").Append(&selfManage); err != nil {
+				return err
+			}
+		}
+		if len(inv.Roles) > 0 {
+			if err := tx.Model(&user).Association("Roles").Append(inv.Roles); err != nil {
+				return err
+			}
+		}
+		if len(inv.Groups) > 0 {
+			if err := tx.Model(&user).Association("Groups").Append(inv.Groups); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid or expired invitation")
+		}
+		if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+			return fiber.NewError(fiber.StatusConflict, "username or email already exists")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to accept invitation")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":         "user registered",
+		"user_name":       user.Username,
+		"organization_id": user.OrganizationID,
+	})
+}
+
+// sendInvitationEmail populates the invitation email template and sends it.
+//
+// Parameters:
+//   - inv: the stored invitation
+//   - token: the plain invitation token; only its hash is stored
+//   - inviter: the principal who created the invitation
+func (a *API) sendInvitationEmail(inv db.Invitation, token string, inviter db.Principal) error {
+	var org db.Organization
+	if err := a.iamDB.First(&org, inv.OrganizationID).Error; err != nil {
+		return err
+	}
+
+	// Name the inviting user; service accounts invite on behalf of the organization
+	invitedBy := org.Name
+	if u, ok := inviter.(db.User); ok {
+		invitedBy = u.Username
+		if u.FirstName != "" {
+			invitedBy = strings.TrimSpace(u.FirstName + " " + u.LastName)
+		}
+	}
+
+	// Prepare template placeholders
+	placeholders := map[string]string{
+		"InvitedBy": invitedBy,
+		"OrgName":   org.Name,
+		"AppName":   a.cfg.AppName,
+		"Year":      fmt.Sprintf("%d", time.Now().Year()),
+		"Token":     token,
+	}
+
+	// invitation template
+	tmplt := filepath.Join(a.cfg.SMTP.TemplateDir, "invite.html")
+
+	return smtpclient.SendEmailFromHTMLTemplate(a.cfg, "You are invited to join "+org.Name,
+		[]string{inv.Email}, tmplt, placeholders)
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleJWKS serves the JSON Web Key Set containing the public keys used to verify
+// tokens issued by goIAM, including recently retired keys.
+//
+// Downstream services fetch this document and select the key matching a token's "kid" header.
+func (a *API) handleJWKS(c fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(a.keys.JWKS())
+}
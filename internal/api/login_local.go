@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -8,6 +9,7 @@ import (
 	"github.com/javadmohebbi/goIAM/internal/auth"
 	"github.com/javadmohebbi/goIAM/internal/db"
 	"github.com/mssola/user_agent"
+	"gorm.io/gorm"
 )
 
 // handleLoginInput represents the expected JSON structure for login.
@@ -15,40 +17,47 @@ type handleLoginInput struct {
 	Username   string `json:"username"`    // required
 	Password   string `json:"password"`    // required
 	BackupCode string `json:"backup_code"` // optional
+	DeviceID   string `json:"device_id"`   // optional, binds the refresh token to this device
+
+	// optional organization slug; falls back to the X-Org header and the request subdomain
+	Organization string `json:"organization"`
 }
 
 // handleLogin returns a Fiber handler that performs user login,
-// validates credentials, and returns either a 2FA challenge or a JWT.
-func (a *API) handleLoginLocal(c fiber.Ctx) error {
-
-	var org db.Organization
-	if err := a.iamDB.First(&org).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "default organization not found")
-	}
-
+// validates credentials, and returns either a 2FA challenge or a JWT access token
+// together with a refresh token.
+//
+// The organization is resolved with resolveLoginOrg; usernames are only unique within it.
+// Credentials are verified by the configured providers, see authenticate.
+func (a *API) handleLogin(c fiber.Ctx) error {
 	var body handleLoginInput
 	if err := c.Bind().Body(&body); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
 	}
 
-	var user db.User
-	if err := a.iamDB.Preload("BackupCodes").Where("username = ? AND organization_id = ?", body.Username, org.ID).First(&user).Error; err != nil {
-		a.storeLoginActivity(c, db.User{Username: body.Username}, "user_not_found")
-		return fiber.NewError(fiber.StatusUnauthorized, "invalid credential") // user not found
+	org, err := a.resolveLoginOrg(c, body.Organization)
+	if err != nil {
+		return err
 	}
 
-	if !auth.CheckPasswordHash(body.Password, user.PasswordHash) {
-		a.storeLoginActivity(c, user, "invalid_password")
-		return fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+	user, err := a.authenticate(c, org.ID, body.Username, body.Password)
+	if err != nil {
+		return err
 	}
 
-	if user.Requires2FA && body.BackupCode == "" {
-		totpToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return a.completeLogin(c, user, body.BackupCode, body.DeviceID)
+}
+
+// completeLogin finishes the login of an authenticated user: it returns a 2FA challenge
+// if the user requires a second factor and no backup code was given, and the access and
+// refresh tokens otherwise.
+func (a *API) completeLogin(c fiber.Ctx, user db.User, backupCode, device string) error {
+	if user.Requires2FA && backupCode == "" {
+		signed, err := a.signToken(jwt.MapClaims{
 			"sub":  user.ID,
 			"name": user.Username,
-			"exp":  time.Now().Add(5 * time.Minute).Unix(),
-		})
-		signed, err := totpToken.SignedString([]byte(a.cfg.JWTSecret))
+			"org":  user.OrganizationID,
+		}, 5*time.Minute)
 		if err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, "token creation failed")
 		}
@@ -58,36 +67,91 @@ func (a *API) handleLoginLocal(c fiber.Ctx) error {
 		})
 	}
 
-	if user.Requires2FA && body.BackupCode != "" {
-		valid := false
-		for _, bc := range user.BackupCodes {
-			if !bc.Used && auth.CheckBackupCode(body.BackupCode, bc.CodeHash) {
-				valid = true
-				bc.Used = true
-				a.iamDB.Save(&bc)
-				break
-			}
-		}
-		if !valid {
+	if user.Requires2FA && backupCode != "" {
+		if !a.verifyBackupCode(user, backupCode) {
 			a.storeLoginActivity(c, user, "invalid_backup_code")
 			return fiber.NewError(fiber.StatusForbidden, "invalid backup code")
 		}
 	}
 
-	finalToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":  user.ID,
-		"name": user.Username,
-		"exp":  time.Now().Add(24 * time.Hour).Unix(),
-	})
-	signed, err := finalToken.SignedString([]byte(a.cfg.JWTSecret))
+	// A valid backup code counts as the second factor
+	tokens, err := a.issueTokens(c, user, deviceID(c, device), user.Requires2FA)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "token creation failed")
 	}
 
 	a.storeLoginActivity(c, user, "success")
 
-	return c.JSON(fiber.Map{"token": signed})
+	return c.JSON(tokens)
+}
+
+// authenticateLocal looks up a user by username within the given organization
+// and verifies the password. Failed attempts are recorded as login activity.
+//
+// Unknown users and accounts of external providers yield ErrUnknownUser, so the next
+// provider can be asked. After a correct password, inactive users and, if
+// login.require_verified_email is set, users with an unverified email are rejected.
+func (a *API) authenticateLocal(c fiber.Ctx, orgID uint, username, password string) (db.User, error) {
+	var user db.User
+	// Accounts of external providers have no local password
+	if err := a.iamDB.Preload("BackupCodes").
+		Where("username = ? AND organization_id = ? AND auth_provider = ?", username, orgID, "").
+		First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.User{}, ErrUnknownUser
+		}
+		return db.User{}, fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
 
+	if !auth.CheckPasswordHash(password, user.PasswordHash) {
+		a.storeLoginActivity(c, user, "invalid_password")
+		return db.User{}, fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+	}
+
+	if err := a.checkLoginAllowed(c, user); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// checkLoginAllowed rejects inactive users and, if login.require_verified_email is set,
+// users with an unverified email. Providers call it after verifying the credentials.
+func (a *API) checkLoginAllowed(c fiber.Ctx, user db.User) error {
+	if !user.IsActive {
+		a.storeLoginActivity(c, user, "inactive")
+		return fiber.NewError(fiber.StatusForbidden, "account is not active")
+	}
+	if a.cfg.Login.RequireVerifiedEmail && !user.EmailVerified {
+		a.storeLoginActivity(c, user, "email_not_verified")
+		return fiber.NewError(fiber.StatusForbidden, "email address is not verified")
+	}
+	return nil
+}
+
+// verifyBackupCode consumes one of the user's unused backup codes if it matches code.
+// The user must have been loaded with BackupCodes preloaded.
+func (a *API) verifyBackupCode(user db.User, code string) bool {
+	for _, bc := range user.BackupCodes {
+		if !bc.Used && auth.CheckBackupCode(code, bc.CodeHash) {
+			bc.Used = true
+			a.iamDB.Save(&bc)
+			return true
+		}
+	}
+	return false
+}
+
+// verifySecondFactor checks a TOTP code or, if none is given, consumes a backup code.
+// Failed attempts are recorded as login activity.
+func (a *API) verifySecondFactor(c fiber.Ctx, user db.User, totpCode, backupCode string) bool {
+	if totpCode != "" && user.TOTPSecret != "" && auth.ValidateTOTP(user.TOTPSecret, totpCode) {
+		return true
+	}
+	if totpCode == "" && backupCode != "" && a.verifyBackupCode(user, backupCode) {
+		return true
+	}
+	a.storeLoginActivity(c, user, "invalid_second_factor")
+	return false
 }
 
 // storeLoginActivity creates an audit log record for a login attempt,
@@ -98,15 +162,16 @@ func (a *API) storeLoginActivity(c fiber.Ctx, user db.User, status string) {
 	browser, _ := ua.Browser()
 
 	audit := db.LoginActivity{
-		UserID:    user.ID,                                // ID of the user attempting login
-		Username:  user.Username,                          // Username of the user attempting login
-		IP:        c.IP(),                                 // IP address from which the login was attempted
-		UserAgent: string(c.Request().Header.UserAgent()), // Raw User-Agent string
-		OS:        ua.OS(),                                // Operating system extracted from User-Agent
-		Browser:   browser,                                // Browser name extracted from User-Agent
-		Device:    ua.Platform(),                          // Device platform extracted from User-Agent
-		Status:    status,                                 // Status of the login attempt (e.g. "success", "invalid_password")
-		Success:   status == "success",                    // true if login was successful
+		UserID:         user.ID,                                // ID of the user attempting login
+		OrganizationID: user.OrganizationID,                    // Organization the login was attempted in
+		Username:       user.Username,                          // Username of the user attempting login
+		IP:             c.IP(),                                 // IP address from which the login was attempted
+		UserAgent:      string(c.Request().Header.UserAgent()), // Raw User-Agent string
+		OS:             ua.OS(),                                // Operating system extracted from User-Agent
+		Browser:        browser,                                // Browser name extracted from User-Agent
+		Device:         ua.Platform(),                          // Device platform extracted from User-Agent
+		Status:         status,                                 // Status of the login attempt (e.g. "success", "invalid_password")
+		Success:        status == "success",                    // true if login was successful
 	}
 
 	go a.iamDB.Create(&audit)
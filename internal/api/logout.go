@@ -0,0 +1,76 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// handleLogoutInput represents the optional JSON body for logout.
+type handleLogoutInput struct {
+	RefreshToken string `json:"refresh_token"` // optional, its token family is revoked as well
+}
+
+// handleLogout revokes the access token used for this request.
+//
+// If a refresh token is supplied, every token rotated from the same login is revoked too,
+// so the session cannot be resumed.
+func (a *API) handleLogout(c fiber.Ctx) error {
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	claims, ok := c.Locals("claims").(jwt.MapClaims)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handleLogoutInput
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&body); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if err := db.RevokeToken(a.iamDB, jti, user.ID, time.Unix(int64(exp), 0)); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "logout failed")
+	}
+
+	if body.RefreshToken != "" {
+		// Only revoke refresh tokens that belong to the caller
+		rt, err := db.FindRefreshTokenByHash(a.iamDB, auth.HashToken(body.RefreshToken))
+		if err == nil && rt.UserID == user.ID {
+			a.revokeRefreshFamily(rt, "logout")
+		}
+	}
+
+	// Housekeeping: drop revocation entries for tokens that have expired anyway
+	go func() {
+		if err := db.PurgeExpiredRevokedTokens(a.iamDB); err != nil {
+			log.Printf("failed to purge revoked tokens: %v", err)
+		}
+	}()
+
+	return c.JSON(fiber.Map{"message": "logged out"})
+}
+
+// handleLogoutAll revokes every access and refresh token issued to the authenticated user,
+// signing them out of all devices.
+func (a *API) handleLogoutAll(c fiber.Ctx) error {
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	if err := db.RevokeAllUserTokens(a.iamDB, user.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "logout failed")
+	}
+
+	return c.JSON(fiber.Map{"message": "logged out from all devices"})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+func TestLogoutAllRejectsTokensIssuedEarlierInTheSameSecond(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	var root db.User
+	if err := a.iamDB.Where("username = ?", "root").First(&root).Error; err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Unix(time.Now().Unix(), 500*int64(time.Millisecond))
+	if err := a.iamDB.Model(&root).Update("tokens_valid_after", cutoff).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		iat        any
+		wantStatus int
+	}{
+		{"whole second of the cutoff", cutoff.Unix(), http.StatusUnauthorized},
+		{"one millisecond before", float64(cutoff.UnixMilli()-1) / 1000, http.StatusUnauthorized},
+		{"at the cutoff", float64(cutoff.UnixMilli()) / 1000, http.StatusOK},
+		{"one millisecond after", float64(cutoff.UnixMilli()+1) / 1000, http.StatusOK},
+	}
+	for _, tt := range tests {
+		claims := a.accessTokenClaims(root, false)
+		claims["jti"] = tt.name
+		claims["iat"] = tt.iat
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, err := a.keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, res := doJSON(t, app, http.MethodGet, "/s/auth/profile", nil, token); status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+		}
+	}
+}
+
+func TestLogoutAllKeepsTokensIssuedRightAfter(t *testing.T) {
+	_, app := newTestAPI(t, "")
+	before := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	if status, res := doJSON(t, app, http.MethodPost, "/s/auth/logout-all", nil, before); status != http.StatusOK {
+		t.Fatalf("logout-all: %d %v", status, res)
+	}
+	status, res := doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+		"username": "root", "password": "Secret123x", "organization": "acme",
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("login: %d %v", status, res)
+	}
+	after := res["token"].(string)
+
+	if status, _ := doJSON(t, app, http.MethodGet, "/s/auth/profile", nil, before); status != http.StatusUnauthorized {
+		t.Errorf("token issued before logout-all: got %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, res := doJSON(t, app, http.MethodGet, "/s/auth/profile", nil, after); status != http.StatusOK {
+		t.Errorf("token issued after logout-all: got %d %v", status, res)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+	"gorm.io/gorm"
+)
+
+// scopesSupported lists the scopes understood by the OpenID Connect provider.
+var scopesSupported = []string{"openid", "profile", "email", "phone", "address", "offline_access"}
+
+// oauthError writes an error response in the format defined by RFC 6749 section 5.2.
+func oauthError(c fiber.Ctx, status int, code, description string) error {
+	if status == fiber.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="goIAM"`)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// issuer returns the OpenID Connect issuer identifier ("iss").
+//
+// It is taken from the configuration, falling back to the base URL of the request.
+func (a *API) issuer(c fiber.Ctx) string {
+	if a.cfg.OIDC.Issuer != "" {
+		return strings.TrimRight(a.cfg.OIDC.Issuer, "/")
+	}
+	return c.BaseURL()
+}
+
+// wantsJSON reports whether the request body is JSON, in which case OAuth
+// interaction endpoints answer with JSON instead of HTML and redirects.
+func wantsJSON(c fiber.Ctx) bool {
+	return c.Is("json")
+}
+
+// redirectWithParams appends query parameters to a redirect URI.
+func redirectWithParams(redirectURI string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	return redirectURI + sep + params.Encode()
+}
+
+// verifyPKCE checks a PKCE code verifier against the stored S256 challenge (RFC 7636).
+func verifyPKCE(verifier, challenge, method string) bool {
+	if verifier == "" || challenge == "" || method != "S256" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hasScope reports whether a space-separated scope string contains scope.
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCredentials extracts the client ID and secret from the request, using
+// HTTP Basic authentication (client_secret_basic) or form fields (client_secret_post).
+func clientCredentials(c fiber.Ctx) (clientID, secret string) {
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Basic ") {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err == nil {
+			if id, sec, ok := strings.Cut(string(raw), ":"); ok {
+				id, _ = url.QueryUnescape(id)
+				sec, _ = url.QueryUnescape(sec)
+				return id, sec
+			}
+		}
+	}
+	return c.FormValue("client_id"), c.FormValue("client_secret")
+}
+
+// errInvalidClient is returned when client authentication fails.
+var errInvalidClient = errors.New("invalid client")
+
+// authenticateOAuthClient authenticates the client making a token request.
+//
+// Confidential clients must present their secret. Public clients only identify
+// themselves and are expected to prove possession of the PKCE verifier instead.
+func (a *API) authenticateOAuthClient(c fiber.Ctx) (*db.OAuthClient, error) {
+	clientID, secret := clientCredentials(c)
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+
+	client, err := db.GetOAuthClientByClientID(a.iamDB, clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidClient
+		}
+		return nil, err
+	}
+
+	// Clients of another organization are unknown on a tenant host
+	if middleware.CheckTenant(c, client.OrganizationID) != nil {
+		return nil, errInvalidClient
+	}
+
+	if client.Public {
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// authenticateServiceAccount authenticates a service account by its client ID and secret.
+// Inactive service accounts and, on a tenant host, service accounts of other
+// organizations fail authentication.
+func (a *API) authenticateServiceAccount(c fiber.Ctx) (*db.ServiceAccount, error) {
+	clientID, secret := clientCredentials(c)
+	if clientID == "" || secret == "" {
+		return nil, errInvalidClient
+	}
+
+	sa, err := db.GetServiceAccountByClientID(a.iamDB, clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidClient
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(sa.ClientSecretHash)) != 1 || !sa.IsActive {
+		return nil, errInvalidClient
+	}
+	if middleware.CheckTenant(c, sa.OrganizationID) != nil {
+		return nil, errInvalidClient
+	}
+	return sa, nil
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+	"gorm.io/gorm"
+)
+
+// authorizeInput represents the parameters of an authorization request (RFC 6749 section 4.1.1,
+// OpenID Connect Core section 3.1.2.1) plus the credentials posted by the login form.
+type authorizeInput struct {
+	ResponseType        string `query:"response_type" form:"response_type" json:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id" json:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope" json:"scope"`
+	State               string `query:"state" form:"state" json:"state"`
+	Nonce               string `query:"nonce" form:"nonce" json:"nonce"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method" json:"code_challenge_method"`
+
+	// Credentials, only used when the login form is posted
+	Username   string `form:"username" json:"username"`
+	Password   string `form:"password" json:"password"`
+	Code       string `form:"code" json:"code"`               // TOTP code
+	BackupCode string `form:"backup_code" json:"backup_code"` // 2FA backup code
+}
+
+// authorizeError is an error that must be reported back to the client's redirect URI.
+type authorizeError struct {
+	code        string
+	description string
+}
+
+func (e *authorizeError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// validateAuthorizeRequest checks the client, redirect URI, response type, scopes and PKCE parameters.
+//
+// Errors about the client or redirect URI are returned as fiber errors and must not be
+// redirected (the redirect URI cannot be trusted). Other errors are returned as
+// *authorizeError and are reported to the client's redirect URI.
+func (a *API) validateAuthorizeRequest(c fiber.Ctx, in *authorizeInput) (*db.OAuthClient, error) {
+	client, err := db.GetOAuthClientByClientID(a.iamDB, in.ClientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "unknown client_id")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load client")
+	}
+	// Clients of another organization are unknown on a tenant host
+	if middleware.CheckTenant(c, client.OrganizationID) != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "unknown client_id")
+	}
+
+	// Default to the only registered redirect URI when none is given
+	if in.RedirectURI == "" && len(client.RedirectURIList()) == 1 {
+		in.RedirectURI = client.RedirectURIList()[0]
+	}
+	if !client.AllowsRedirectURI(in.RedirectURI) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "redirect_uri is not registered for this client")
+	}
+
+	if in.ResponseType != "code" {
+		return client, &authorizeError{"unsupported_response_type", "only the authorization code flow is supported"}
+	}
+	if in.CodeChallenge == "" || in.CodeChallengeMethod != "S256" {
+		return client, &authorizeError{"invalid_request", "PKCE with code_challenge_method=S256 is required"}
+	}
+	for _, scope := range strings.Fields(in.Scope) {
+		if !client.AllowsScope(scope) {
+			return client, &authorizeError{"invalid_scope", "scope " + scope + " is not allowed for this client"}
+		}
+	}
+
+	return client, nil
+}
+
+// handleAuthorize starts the authorization code flow.
+//
+// After validating the request, it forwards the user to the configured login page
+// (oidc.login_url) or renders the built-in login form, which posts the credentials
+// back to handleAuthorizeLogin.
+func (a *API) handleAuthorize(c fiber.Ctx) error {
+	var in authorizeInput
+	if err := c.Bind().Query(&in); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid authorization request")
+	}
+
+	client, err := a.validateAuthorizeRequest(c, &in)
+	if err != nil {
+		return a.authorizeFailure(c, &in, err)
+	}
+
+	if a.cfg.OIDC.LoginURL != "" {
+		return c.Redirect().Status(fiber.StatusFound).
+			To(redirectWithParams(a.cfg.OIDC.LoginURL, authorizeParams(&in)))
+	}
+	return a.renderLoginForm(c, client, &in, "")
+}
+
+// handleAuthorizeLogin authenticates the user for an authorization request.
+//
+// It reuses the provider login (organization of the client) and, if enabled for the user,
+// the TOTP or backup code step. Security keys are not supported here, so users without
+// TOTP must enter a backup code. On success an authorization code is issued and the
+// user is redirected to the client. JSON requests receive {"redirect_to": "..."} instead
+// of a redirect, so custom login pages can drive the flow with fetch().
+func (a *API) handleAuthorizeLogin(c fiber.Ctx) error {
+	var in authorizeInput
+	if err := c.Bind().Body(&in); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid authorization request")
+	}
+
+	client, err := a.validateAuthorizeRequest(c, &in)
+	if err != nil {
+		return a.authorizeFailure(c, &in, err)
+	}
+
+	user, err := a.authenticate(c, client.OrganizationID, in.Username, in.Password)
+	if err != nil {
+		return a.loginFailure(c, client, &in, "invalid_credentials", "Invalid username or password.")
+	}
+
+	if user.Requires2FA {
+		// 2FA by security keys only; without this the TOTP step could never succeed
+		if user.TOTPSecret == "" && in.BackupCode == "" {
+			return a.loginFailure(c, client, &in, "2fa_method_unsupported",
+				"Security keys cannot be used to sign in here. Enter one of your backup codes.")
+		}
+		if in.Code == "" && in.BackupCode == "" {
+			return a.loginFailure(c, client, &in, "2fa_required", "Enter the code from your authenticator app.")
+		}
+		if !a.verifySecondFactor(c, user, in.Code, in.BackupCode) {
+			return a.loginFailure(c, client, &in, "invalid_2fa_code", "Invalid verification code.")
+		}
+	}
+
+	code, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create authorization code")
+	}
+	ac := db.AuthorizationCode{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         in.RedirectURI,
+		Scope:               in.Scope,
+		Nonce:               in.Nonce,
+		CodeChallenge:       in.CodeChallenge,
+		CodeChallengeMethod: in.CodeChallengeMethod,
+		TwoFA:               user.Requires2FA,
+		AuthTime:            time.Now(),
+		ExpiresAt:           time.Now().Add(a.cfg.OIDC.CodeTTL),
+	}
+	if err := a.iamDB.Create(&ac).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create authorization code")
+	}
+
+	a.storeLoginActivity(c, user, "success")
+
+	params := url.Values{"code": {code}}
+	if in.State != "" {
+		params.Set("state", in.State)
+	}
+	return a.redirectToClient(c, redirectWithParams(in.RedirectURI, params))
+}
+
+// authorizeFailure reports a failed authorization request: invalid client or redirect
+// URI errors are returned directly, all other errors are redirected to the client.
+func (a *API) authorizeFailure(c fiber.Ctx, in *authorizeInput, err error) error {
+	var aerr *authorizeError
+	if !errors.As(err, &aerr) {
+		return err
+	}
+	params := url.Values{"error": {aerr.code}, "error_description": {aerr.description}}
+	if in.State != "" {
+		params.Set("state", in.State)
+	}
+	return a.redirectToClient(c, redirectWithParams(in.RedirectURI, params))
+}
+
+// redirectToClient sends the user agent to the client's redirect URI,
+// or returns the target URL as JSON for JSON requests.
+func (a *API) redirectToClient(c fiber.Ctx, target string) error {
+	if wantsJSON(c) {
+		return c.JSON(fiber.Map{"redirect_to": target})
+	}
+	return c.Redirect().Status(fiber.StatusFound).To(target)
+}
+
+// loginFailure re-renders the login form with a message, or returns a JSON error.
+func (a *API) loginFailure(c fiber.Ctx, client *db.OAuthClient, in *authorizeInput, code, message string) error {
+	if wantsJSON(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":             code,
+			"error_description": message,
+		})
+	}
+	c.Status(fiber.StatusUnauthorized)
+	return a.renderLoginForm(c, client, in, message)
+}
+
+// authorizeParams returns the authorization request parameters as query values.
+func authorizeParams(in *authorizeInput) url.Values {
+	params := url.Values{}
+	for k, v := range map[string]string{
+		"response_type":         in.ResponseType,
+		"client_id":             in.ClientID,
+		"redirect_uri":          in.RedirectURI,
+		"scope":                 in.Scope,
+		"state":                 in.State,
+		"nonce":                 in.Nonce,
+		"code_challenge":        in.CodeChallenge,
+		"code_challenge_method": in.CodeChallengeMethod,
+	} {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+	return params
+}
+
+// loginFormTemplate is the built-in login page used when oidc.login_url is not configured.
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1.0"/>
+  <title>Sign in to {{.ClientName}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; background-color: #f6f6f6; padding: 20px;">
+  <form method="post" action="/oauth2/authorize" style="max-width: 360px; margin: auto; background-color: #ffffff; border-radius: 6px; padding: 30px; box-shadow: 0 2px 6px rgba(0,0,0,0.1);">
+    <h2 style="color: #008080;">{{.AppName}}</h2>
+    <p>Sign in to continue to <strong>{{.ClientName}}</strong>.</p>
+    {{if .Error}}<p style="color: #b00020;">{{.Error}}</p>{{end}}
+    {{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}" />
+    {{end}}
+    <p><input name="username" placeholder="Username" value="{{.Username}}" required style="width: 100%; padding: 8px;" /></p>
+    <p><input name="password" type="password" placeholder="Password" required style="width: 100%; padding: 8px;" /></p>
+    <p><input name="code" placeholder="2FA code (if enabled)" autocomplete="one-time-code" style="width: 100%; padding: 8px;" /></p>
+    <p><input name="backup_code" placeholder="Backup code (instead of the 2FA code)" autocomplete="off" style="width: 100%; padding: 8px;" /></p>
+    <p><button type="submit" style="background-color: #008080; color: white; padding: 12px 24px; border: 0; border-radius: 4px;">Sign in</button></p>
+  </form>
+</body>
+</html>`))
+
+// renderLoginForm renders the built-in login form for an authorization request.
+func (a *API) renderLoginForm(c fiber.Ctx, client *db.OAuthClient, in *authorizeInput, message string) error {
+	var buf bytes.Buffer
+	err := loginFormTemplate.Execute(&buf, map[string]any{
+		"AppName":    a.cfg.AppName,
+		"ClientName": client.Name,
+		"Error":      message,
+		"Params":     authorizeParams(in),
+		"Username":   in.Username,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to render login form")
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set("X-Frame-Options", "DENY")
+	return c.Send(buf.Bytes())
+}
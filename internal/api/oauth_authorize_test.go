@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	testRedirectURI  = "https://rp.example.com/callback"
+	testCodeVerifier = "0123456789abcdefghijklmnopqrstuvwxyz-verifier"
+)
+
+// createPublicClient registers a public OAuth client redirecting to testRedirectURI
+// and returns its client ID.
+func createPublicClient(t *testing.T, app *fiber.App, admin string) string {
+	t.Helper()
+
+	status, res := doJSON(t, app, http.MethodPost, "/s/oauth2/clients", map[string]any{
+		"name":          "Relying party",
+		"redirect_uris": []string{testRedirectURI},
+		"public":        true,
+	}, admin)
+	if status != http.StatusCreated {
+		t.Fatalf("create client: %d %v", status, res)
+	}
+	return res["client"].(map[string]any)["client_id"].(string)
+}
+
+// authorizeLogin posts the login of an authorization request of the client with the
+// given credentials, as a JSON request, with the PKCE challenge of testCodeVerifier.
+func authorizeLogin(t *testing.T, app *fiber.App, clientID string, credentials map[string]any) (int, map[string]any) {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(testCodeVerifier))
+	body := map[string]any{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid profile",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	maps.Copy(body, credentials)
+	return doJSON(t, app, http.MethodPost, "/oauth2/authorize", body, "")
+}
+
+func TestAuthorizeLoginWithSecurityKeyOnly(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	clientID := createPublicClient(t, app, admin)
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+
+	status, res := newSoftAuthenticator(t).register(t, app, alice)
+	if status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+	status, res = doJSON(t, app, http.MethodPost, "/s/auth/backup-codes/regenerate", nil, res["token"].(string))
+	if status != http.StatusOK {
+		t.Fatalf("backup codes: %d %v", status, res)
+	}
+	backupCode := res["backup_codes"].([]any)[0].(string)
+
+	tests := []struct {
+		name       string
+		secondStep map[string]any
+		wantStatus int
+		wantError  string
+	}{
+		{"no second factor", map[string]any{}, http.StatusUnauthorized, "2fa_method_unsupported"},
+		{"TOTP code", map[string]any{"code": "123456"}, http.StatusUnauthorized, "2fa_method_unsupported"},
+		{"wrong backup code", map[string]any{"backup_code": "not-a-code"}, http.StatusUnauthorized, "invalid_2fa_code"},
+		{"backup code", map[string]any{"backup_code": backupCode}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		credentials := map[string]any{"username": "alice", "password": "Secret123x"}
+		maps.Copy(credentials, tt.secondStep)
+		status, res := authorizeLogin(t, app, clientID, credentials)
+		if status != tt.wantStatus || (tt.wantError != "" && res["error"] != tt.wantError) {
+			t.Errorf("%s: got %d %v, want %d %s", tt.name, status, res, tt.wantStatus, tt.wantError)
+		}
+	}
+}
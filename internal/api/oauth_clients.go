@@ -0,0 +1,126 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// handleCreateOAuthClientInput represents the expected JSON structure for registering a client.
+type handleCreateOAuthClientInput struct {
+	Name         string   `json:"name"`          // required
+	RedirectURIs []string `json:"redirect_uris"` // required, exact-match redirect URIs
+	Scopes       []string `json:"scopes"`        // optional, allowed scopes (all if empty)
+	Public       bool     `json:"public"`        // optional, true for SPAs and native apps
+}
+
+// oauthClientView is the JSON representation of a registered client (without secret).
+type oauthClientView struct {
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+// newOAuthClientView converts a client model into its JSON representation.
+func newOAuthClientView(client db.OAuthClient) oauthClientView {
+	return oauthClientView{
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIList(),
+		Scopes:       strings.Fields(client.Scopes),
+		Public:       client.Public,
+	}
+}
+
+// handleCreateOAuthClient registers a new OAuth/OIDC client in the caller's organization.
+//
+// Confidential clients receive a client secret, which is only returned in this response.
+func (a *API) handleCreateOAuthClient(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handleCreateOAuthClientInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Name == "" || len(body.RedirectURIs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "name and redirect_uris are required")
+	}
+	for _, uri := range body.RedirectURIs {
+		if !a.validation.ValidateWebsite(uri) || strings.ContainsAny(uri, " #") {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid redirect URI: "+uri)
+		}
+	}
+
+	client := db.OAuthClient{
+		ClientID:       uuid.New().String(),
+		Name:           body.Name,
+		RedirectURIs:   strings.Join(body.RedirectURIs, " "),
+		Scopes:         strings.Join(body.Scopes, " "),
+		Public:         body.Public,
+		OrganizationID: principal.PrincipalOrgID(),
+	}
+
+	var secret string
+	if !body.Public {
+		var err error
+		if secret, err = auth.GenerateOpaqueToken(); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to generate client secret")
+		}
+		client.ClientSecretHash = auth.HashToken(secret)
+	}
+
+	if err := a.iamDB.Create(&client).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create client")
+	}
+
+	res := fiber.Map{"client": newOAuthClientView(client)}
+	if secret != "" {
+		res["client_secret"] = secret
+	}
+	return c.Status(fiber.StatusCreated).JSON(res)
+}
+
+// handleListOAuthClients lists the clients registered in the caller's organization.
+func (a *API) handleListOAuthClients(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var clients []db.OAuthClient
+	if err := a.iamDB.Where("organization_id = ?", principal.PrincipalOrgID()).Find(&clients).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to list clients")
+	}
+
+	views := make([]oauthClientView, 0, len(clients))
+	for _, client := range clients {
+		views = append(views, newOAuthClientView(client))
+	}
+	return c.JSON(views)
+}
+
+// handleDeleteOAuthClient removes a client of the caller's organization.
+func (a *API) handleDeleteOAuthClient(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	res := a.iamDB.Where("client_id = ? AND organization_id = ?", c.Params("client_id"), principal.PrincipalOrgID()).
+		Delete(&db.OAuthClient{})
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete client")
+	}
+	if res.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "client not found")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// tokenCaller is the client (OAuth client or service account) calling the
+// introspection or revocation endpoint.
+type tokenCaller struct {
+	ClientID string
+	OrgID    uint
+	Public   bool
+}
+
+// authenticateTokenCaller authenticates an OAuth client or, failing that, a service account.
+func (a *API) authenticateTokenCaller(c fiber.Ctx) (*tokenCaller, error) {
+	client, err := a.authenticateOAuthClient(c)
+	if err == nil {
+		return &tokenCaller{ClientID: client.ClientID, OrgID: client.OrganizationID, Public: client.Public}, nil
+	}
+	if !errors.Is(err, errInvalidClient) {
+		return nil, err
+	}
+
+	sa, err := a.authenticateServiceAccount(c)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenCaller{ClientID: sa.ClientID, OrgID: sa.OrganizationID}, nil
+}
+
+// isJWT reports whether token looks like a JWT access token rather than an opaque refresh token.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// handleIntrospect implements OAuth 2.0 Token Introspection (RFC 7662).
+//
+// Resource servers that cannot verify JWTs locally post a token and receive its
+// state. Access tokens are validated exactly like RequireAuth does; refresh tokens
+// are only reported to the client they were issued to. Tokens of other
+// organizations are reported as inactive.
+func (a *API) handleIntrospect(c fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	caller, err := a.authenticateTokenCaller(c)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to load client")
+	}
+	if caller.Public {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	if isJWT(token) {
+		return c.JSON(a.introspectAccessToken(token, caller))
+	}
+	return c.JSON(a.introspectRefreshToken(token, caller))
+}
+
+// introspectAccessToken returns the introspection response for a JWT access token.
+func (a *API) introspectAccessToken(token string, caller *tokenCaller) fiber.Map {
+	principal, claims, err := middleware.VerifyToken(a.iamDB, a.keys, token)
+	if err != nil || principal.PrincipalOrgID() != caller.OrgID {
+		return fiber.Map{"active": false}
+	}
+
+	exp, _ := claims["exp"].(float64)
+	iat, _ := claims["iat"].(float64)
+	twoFA, _ := claims["2fa"].(bool)
+
+	res := fiber.Map{
+		"active":         true,
+		"token_type":     "Bearer",
+		"sub":            fmt.Sprint(principal.PrincipalID()),
+		"username":       principal.PrincipalName(),
+		"principal_type": principal.PrincipalType(),
+		"org_id":         principal.PrincipalOrgID(),
+		"2fa":            twoFA,
+		"exp":            int64(exp),
+		"iat":            int64(iat),
+	}
+	for _, claim := range []string{"jti", "scope", "client_id", "aud"} {
+		if v, ok := claims[claim]; ok {
+			res[claim] = v
+		}
+	}
+	return res
+}
+
+// introspectRefreshToken returns the introspection response for an opaque refresh token.
+func (a *API) introspectRefreshToken(token string, caller *tokenCaller) fiber.Map {
+	inactive := fiber.Map{"active": false}
+
+	rt, err := db.FindRefreshTokenByHash(a.iamDB, auth.HashToken(token))
+	if err != nil || rt.ClientID != caller.ClientID {
+		return inactive
+	}
+	if rt.UsedAt != nil || rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+		return inactive
+	}
+
+	var user db.User
+	if err := a.iamDB.First(&user, rt.UserID).Error; err != nil || !user.IsActive || user.OrganizationID != caller.OrgID {
+		return inactive
+	}
+
+	res := fiber.Map{
+		"active":         true,
+		"token_type":     "refresh_token",
+		"sub":            fmt.Sprint(user.ID),
+		"username":       user.Username,
+		"principal_type": db.PrincipalUser,
+		"org_id":         user.OrganizationID,
+		"2fa":            rt.TwoFA,
+		"exp":            rt.ExpiresAt.Unix(),
+		"iat":            rt.CreatedAt.Unix(),
+		"client_id":      rt.ClientID,
+	}
+	if rt.Scope != "" {
+		res["scope"] = rt.Scope
+	}
+	return res
+}
+
+// handleRevoke implements OAuth 2.0 Token Revocation (RFC 7009).
+//
+// Clients may revoke access and refresh tokens that were issued to them. Revoking a
+// refresh token revokes its whole token family. As required by the RFC, the response
+// is 200 OK even if the token was invalid, already revoked or not owned by the client.
+func (a *API) handleRevoke(c fiber.Ctx) error {
+	caller, err := a.authenticateTokenCaller(c)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to load client")
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	if isJWT(token) {
+		principal, claims, err := middleware.VerifyToken(a.iamDB, a.keys, token)
+		if err == nil && claims["client_id"] == caller.ClientID {
+			jti, _ := claims["jti"].(string)
+			exp, _ := claims["exp"].(float64)
+			if err := db.RevokeToken(a.iamDB, jti, principal.PrincipalID(), time.Unix(int64(exp), 0)); err != nil {
+				return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to revoke token")
+			}
+		}
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	rt, err := db.FindRefreshTokenByHash(a.iamDB, auth.HashToken(token))
+	if err == nil && rt.ClientID == caller.ClientID {
+		a.revokeRefreshFamily(rt, "revoked by client")
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// handleOAuthToken implements the token endpoint (RFC 6749 section 3.2).
+//
+// Supported grants:
+//   - authorization_code: exchanges a code from /oauth2/authorize, verifying PKCE
+//   - refresh_token: rotates a refresh token issued to the same client
+//   - client_credentials: issues an access token to a service account
+//
+// Clients authenticate with HTTP Basic or client_id/client_secret form fields;
+// public clients send only client_id.
+func (a *API) handleOAuthToken(c fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	// Service accounts are their own clients
+	if c.FormValue("grant_type") == "client_credentials" {
+		return a.grantClientCredentials(c)
+	}
+
+	client, err := a.authenticateOAuthClient(c)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to load client")
+	}
+
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		return a.grantAuthorizationCode(c, client)
+	case "refresh_token":
+		return a.grantRefreshToken(c, client)
+	default:
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported")
+	}
+}
+
+// grantAuthorizationCode exchanges an authorization code for tokens.
+//
+// A code can be redeemed once; replaying it revokes the refresh tokens issued for it.
+func (a *API) grantAuthorizationCode(c fiber.Ctx, client *db.OAuthClient) error {
+	ac, err := db.FindAuthorizationCodeByHash(a.iamDB, auth.HashToken(c.FormValue("code")))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "invalid authorization code")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to load authorization code")
+	}
+	if ac.ClientID != client.ClientID {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "invalid authorization code")
+	}
+
+	ok, err := db.MarkAuthorizationCodeUsed(a.iamDB, ac.ID)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to redeem authorization code")
+	}
+	if !ok {
+		if ac.FamilyID != "" {
+			a.revokeRefreshFamily(&db.RefreshToken{UserID: ac.UserID, FamilyID: ac.FamilyID}, "authorization code replayed")
+		}
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "authorization code already used")
+	}
+
+	if time.Now().After(ac.ExpiresAt) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "authorization code expired")
+	}
+	if c.FormValue("redirect_uri", ac.RedirectURI) != ac.RedirectURI {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+	}
+	if !verifyPKCE(c.FormValue("code_verifier"), ac.CodeChallenge, ac.CodeChallengeMethod) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+	}
+
+	var user db.User
+	if err := a.iamDB.First(&user, ac.UserID).Error; err != nil || !user.IsActive {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "user not found or inactive")
+	}
+
+	familyID := uuid.New().String()
+	refresh, err := a.createRefreshToken(c, db.RefreshToken{
+		UserID:   user.ID,
+		FamilyID: familyID,
+		TwoFA:    ac.TwoFA,
+		ClientID: client.ClientID,
+		Scope:    ac.Scope,
+	})
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "token creation failed")
+	}
+	a.iamDB.Model(ac).Update("family_id", familyID)
+
+	return a.oauthTokenResponse(c, client, user, ac.Scope, ac.TwoFA, ac.Nonce, &ac.AuthTime, refresh)
+}
+
+// grantRefreshToken rotates a refresh token issued to the client and returns new tokens.
+func (a *API) grantRefreshToken(c fiber.Ctx, client *db.OAuthClient) error {
+	user, rt, refresh, err := a.rotateRefreshToken(c, c.FormValue("refresh_token"), "", client.ClientID)
+	if err != nil {
+		var ferr *fiber.Error
+		if errors.As(err, &ferr) && ferr.Code == fiber.StatusInternalServerError {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", ferr.Message)
+		}
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "invalid refresh token")
+	}
+
+	return a.oauthTokenResponse(c, client, user, rt.Scope, rt.TwoFA, "", nil, refresh)
+}
+
+// grantClientCredentials authenticates a service account with its client ID and
+// secret and issues an access token for it (RFC 6749 section 4.4).
+//
+// No refresh token is issued; the service account simply requests a new token.
+func (a *API) grantClientCredentials(c fiber.Ctx) error {
+	sa, err := a.authenticateServiceAccount(c)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "failed to load service account")
+	}
+
+	scope := c.FormValue("scope")
+	claims := jwt.MapClaims{
+		"sub":            sa.ID,
+		"name":           sa.Name,
+		"principal_type": db.PrincipalServiceAccount,
+		"client_id":      sa.ClientID,
+		"org":            sa.OrganizationID,
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	access, err := a.signToken(claims, a.cfg.Token.AccessTTL)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "token creation failed")
+	}
+
+	res := fiber.Map{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(a.cfg.Token.AccessTTL.Seconds()),
+	}
+	if scope != "" {
+		res["scope"] = scope
+	}
+	return c.JSON(res)
+}
+
+// oauthTokenResponse signs the access token (and id_token for the "openid" scope)
+// and writes the token response (RFC 6749 section 5.1).
+func (a *API) oauthTokenResponse(c fiber.Ctx, client *db.OAuthClient, user db.User, scope string, twoFA bool, nonce string, authTime *time.Time, refresh string) error {
+	claims := a.accessTokenClaims(user, twoFA)
+	claims["aud"] = client.ClientID
+	claims["client_id"] = client.ClientID
+	claims["scope"] = scope
+	access, err := a.signToken(claims, a.cfg.Token.AccessTTL)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "token creation failed")
+	}
+
+	res := fiber.Map{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    int(a.cfg.Token.AccessTTL.Seconds()),
+		"refresh_token": refresh,
+		"scope":         scope,
+	}
+
+	if hasScope(scope, "openid") {
+		idClaims := userInfoClaims(user, scope)
+		idClaims["iss"] = a.issuer(c)
+		idClaims["aud"] = client.ClientID
+		idClaims["amr"] = []string{"pwd"}
+		if twoFA {
+			idClaims["amr"] = []string{"pwd", "otp", "mfa"}
+		}
+		if nonce != "" {
+			idClaims["nonce"] = nonce
+		}
+		if authTime != nil {
+			idClaims["auth_time"] = authTime.Unix()
+		}
+		idToken, err := a.signToken(idClaims, a.cfg.OIDC.IDTokenTTL)
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "token creation failed")
+		}
+		res["id_token"] = idToken
+	}
+
+	return c.JSON(res)
+}
+
+// userInfoClaims returns the standard OpenID Connect claims of a user that are
+// released for the given scopes. The "sub" claim is always included.
+func userInfoClaims(user db.User, scope string) map[string]any {
+	claims := map[string]any{"sub": fmt.Sprint(user.ID)}
+
+	set := func(key, value string) {
+		if value != "" {
+			claims[key] = value
+		}
+	}
+
+	if hasScope(scope, "profile") {
+		set("name", strings.Join(strings.Fields(user.FirstName+" "+user.MiddleName+" "+user.LastName), " "))
+		set("given_name", user.FirstName)
+		set("middle_name", user.MiddleName)
+		set("family_name", user.LastName)
+		set("preferred_username", user.Username)
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if hasScope(scope, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if hasScope(scope, "phone") && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = user.PhoneVerified
+	}
+	if hasScope(scope, "address") && user.Address != "" {
+		claims["address"] = map[string]string{"formatted": user.Address}
+	}
+
+	return claims
+}
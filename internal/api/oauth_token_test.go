@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestOAuthClientTokenRejectedOnSecureRoutes(t *testing.T) {
+	_, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+
+	// The first-party token of the organization's first user has full access
+	if status, res := doJSON(t, app, http.MethodGet, "/s/user", nil, admin); status != http.StatusOK {
+		t.Fatalf("first-party token on /s/user: %d %v", status, res)
+	}
+
+	clientID := createPublicClient(t, app, admin)
+	status, res := authorizeLogin(t, app, clientID, map[string]any{"username": "alice", "password": "Secret123x"})
+	if status != http.StatusOK {
+		t.Fatalf("authorize: %d %v", status, res)
+	}
+	redirect, err := url.Parse(res["redirect_to"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, res = doForm(t, app, "/oauth2/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {redirect.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("token: %d %v", status, res)
+	}
+	access, _ := res["access_token"].(string)
+
+	// The relying party must not act as the user on the admin API
+	for _, path := range []string{"/s/user", "/s/org", "/s/auth/profile"} {
+		if status, res := doJSON(t, app, http.MethodGet, path, nil, access); status != http.StatusForbidden && status != http.StatusUnauthorized {
+			t.Errorf("OAuth client token on %s: got %d %v, want 401 or 403", path, status, res)
+		}
+	}
+
+	// but can still use the endpoints meant for it
+	if status, res := doJSON(t, app, http.MethodGet, "/oauth2/userinfo", nil, access); status != http.StatusOK || res["preferred_username"] != "alice" {
+		t.Errorf("userinfo: %d %v", status, res)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// handleUserInfo implements the OpenID Connect UserInfo endpoint.
+//
+// It must run after RequireAuth and returns the claims released by the scopes of
+// the access token. Tokens issued by /auth/login carry no scope and receive every claim.
+func (a *API) handleUserInfo(c fiber.Ctx) error {
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+
+	scope, ok := claims["scope"].(string)
+	if !ok {
+		scope = "openid profile email phone address"
+	}
+	if !hasScope(scope, "openid") {
+		return oauthError(c, fiber.StatusForbidden, "insufficient_scope", "the openid scope is required")
+	}
+
+	return c.JSON(userInfoClaims(user, scope))
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleOpenIDConfiguration serves the OpenID Provider metadata document
+// (OpenID Connect Discovery 1.0), which lets relying parties configure themselves.
+func (a *API) handleOpenIDConfiguration(c fiber.Ctx) error {
+	iss := a.issuer(c)
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{
+		"issuer":                                iss,
+		"authorization_endpoint":                iss + "/oauth2/authorize",
+		"token_endpoint":                        iss + "/oauth2/token",
+		"userinfo_endpoint":                     iss + "/oauth2/userinfo",
+		"introspection_endpoint":                iss + "/oauth2/introspect",
+		"revocation_endpoint":                   iss + "/oauth2/revoke",
+		"jwks_uri":                              iss + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{a.cfg.Signing.Algorithm},
+		"scopes_supported":                      scopesSupported,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr",
+			"name", "given_name", "middle_name", "family_name", "preferred_username",
+			"email", "email_verified", "phone_number", "phone_number_verified", "address",
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// resolveLoginOrg determines the organization a login request is for.
+//
+// The organization slug is taken, in this order, from:
+//   - the explicit slug given in the request body
+//   - the X-Org header
+//   - the tenant of the request host (see middleware.ResolveTenant)
+//
+// On a tenant host, an explicit slug must name the tenant. If no organization is given
+// and only a single organization exists, that organization is used, so single-tenant
+// deployments keep working without changes.
+func (a *API) resolveLoginOrg(c fiber.Ctx, slug string) (db.Organization, error) {
+	if slug == "" {
+		slug = strings.TrimSpace(c.Get("X-Org"))
+	}
+	tenant, hasTenant := c.Locals("tenant").(db.Organization)
+
+	var org db.Organization
+	if slug == "" {
+		if hasTenant {
+			return tenant, nil
+		}
+		var orgs []db.Organization
+		if err := a.iamDB.Limit(2).Find(&orgs).Error; err != nil {
+			return org, fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+		}
+		if len(orgs) != 1 {
+			return org, fiber.NewError(fiber.StatusBadRequest, "organization is required")
+		}
+		return orgs[0], nil
+	}
+
+	if err := a.iamDB.Where("slug = ?", strings.ToLower(slug)).First(&org).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return org, fiber.NewError(fiber.StatusNotFound, "organization not found")
+		}
+		return org, fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+	}
+	if hasTenant && org.ID != tenant.ID {
+		return org, fiber.NewError(fiber.StatusBadRequest, "organization does not match the host")
+	}
+	return org, nil
+}
+
+// scopeToTenant restricts a query to the organization_id of the request's tenant, if any.
+// Public endpoints use it so requests on a tenant host only see that tenant's data.
+func scopeToTenant(c fiber.Ctx, query *gorm.DB) *gorm.DB {
+	if tenant, ok := c.Locals("tenant").(db.Organization); ok {
+		return query.Where("organization_id = ?", tenant.ID)
+	}
+	return query
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+func TestTenantHostMismatch(t *testing.T) {
+	a, app := newTestAPI(t, "tenancy:\n  base_domain: iam.test\n")
+	acme := registerAndLogin(t, app, "alice", "alice@acme.test", "acme")
+	registerAndLogin(t, app, "bob", "bob@globex.test", "globex")
+
+	if err := a.iamDB.Model(&db.Organization{}).Where("slug = ?", "acme").
+		Updates(map[string]any{"custom_domain": "login.acme.test", "custom_domain_verified": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.iamDB.Model(&db.Organization{}).Where("slug = ?", "globex").
+		Updates(map[string]any{"custom_domain": "login.globex.test", "custom_domain_verified": false}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	alice := map[string]any{"username": "alice", "password": "Secret123x"}
+	aliceOfAcme := map[string]any{"username": "alice", "password": "Secret123x", "organization": "acme"}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       map[string]any
+		token      string
+		wantStatus int
+	}{
+		{"login on own subdomain", http.MethodPost, "http://acme.iam.test/auth/login", alice, "", http.StatusOK},
+		{"login naming own organization on own subdomain", http.MethodPost, "http://acme.iam.test/auth/login", aliceOfAcme, "", http.StatusOK},
+		{"login naming another organization", http.MethodPost, "http://globex.iam.test/auth/login", aliceOfAcme, "", http.StatusBadRequest},
+		{"login on another subdomain", http.MethodPost, "http://globex.iam.test/auth/login", alice, "", http.StatusUnauthorized},
+		{"login on unknown subdomain", http.MethodPost, "http://initech.iam.test/auth/login", alice, "", http.StatusNotFound},
+		{"login on verified custom domain", http.MethodPost, "http://login.acme.test/auth/login", alice, "", http.StatusOK},
+		{"login on unverified custom domain", http.MethodPost, "http://login.globex.test/auth/login", alice, "", http.StatusBadRequest},
+		{"token on own subdomain", http.MethodGet, "http://acme.iam.test/s/auth/profile", nil, acme, http.StatusOK},
+		{"token on own custom domain", http.MethodGet, "http://login.acme.test/s/auth/profile", nil, acme, http.StatusOK},
+		{"token on another subdomain", http.MethodGet, "http://globex.iam.test/s/auth/profile", nil, acme, http.StatusUnauthorized},
+		{"token without tenant host", http.MethodGet, "http://iam.test/s/auth/profile", nil, acme, http.StatusOK},
+	}
+	for _, tt := range tests {
+		var body any
+		if tt.body != nil {
+			body = tt.body
+		}
+		if status, res := doJSON(t, app, tt.method, tt.url, body, tt.token); status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// domainVerificationPrefix is prepended to a custom domain to get the name of the
+// TXT record that proves ownership of the domain.
+const domainVerificationPrefix = "_goiam-challenge."
+
+// domainPattern matches a lowercase DNS name with at least two labels.
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// handleOrganizationInput represents the fields of the caller's organization that can be changed.
+// Empty fields are left unchanged.
+type handleOrganizationInput struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"` // also changes the subdomain of the organization
+	Description string `json:"description"`
+
+	PasswordlessLogin *bool `json:"passwordless_login"` // allow login with emailed codes and magic links
+}
+
+// organizationView is the JSON representation of an organization.
+type organizationView struct {
+	ID                   uint                   `json:"id"`
+	Name                 string                 `json:"name"`
+	Slug                 string                 `json:"slug"`
+	Description          string                 `json:"description"`
+	CustomDomain         string                 `json:"custom_domain,omitempty"`
+	CustomDomainVerified bool                   `json:"custom_domain_verified"`
+	DomainVerification   *domainVerificationTXT `json:"domain_verification,omitempty"` // pending verification only
+	PasswordlessLogin    bool                   `json:"passwordless_login"`
+	CreatedAt            time.Time              `json:"created_at"`
+	UpdatedAt            time.Time              `json:"updated_at"`
+}
+
+// domainVerificationTXT is the TXT record an organization has to publish to verify its custom domain.
+type domainVerificationTXT struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// newOrganizationView converts an organization into its JSON representation.
+func newOrganizationView(o db.Organization) organizationView {
+	v := organizationView{
+		ID:                   o.ID,
+		Name:                 o.Name,
+		Slug:                 o.Slug,
+		Description:          o.Description,
+		CustomDomain:         o.CustomDomain,
+		CustomDomainVerified: o.CustomDomainVerified,
+		PasswordlessLogin:    o.PasswordlessLogin,
+		CreatedAt:            o.CreatedAt,
+		UpdatedAt:            o.UpdatedAt,
+	}
+	if o.CustomDomain != "" && !o.CustomDomainVerified {
+		v.DomainVerification = &domainVerificationTXT{
+			Name:  domainVerificationPrefix + o.CustomDomain,
+			Value: o.DomainVerificationToken,
+		}
+	}
+	return v
+}
+
+// handleGetOrganization returns the caller's organization.
+func (a *API) handleGetOrganization(c fiber.Ctx) error {
+	org, err := a.loadOrganization(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newOrganizationView(*org))
+}
+
+// handleUpdateOrganization updates the name, slug, description or passwordless login
+// setting of the caller's organization.
+func (a *API) handleUpdateOrganization(c fiber.Ctx) error {
+	org, err := a.loadOrganization(c)
+	if err != nil {
+		return err
+	}
+
+	var body handleOrganizationInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	updates := map[string]any{}
+	if strings.TrimSpace(body.Name) != "" {
+		updates["name"] = strings.TrimSpace(body.Name)
+	}
+	if body.Slug != "" {
+		slug, err := validSlug(body.Slug, "")
+		if err != nil {
+			return err
+		}
+		updates["slug"] = slug
+	}
+	if body.Description != "" {
+		updates["description"] = body.Description
+	}
+	if body.PasswordlessLogin != nil {
+		updates["passwordless_login"] = *body.PasswordlessLogin
+	}
+
+	if len(updates) > 0 {
+		if err := a.iamDB.Model(org).Updates(updates).Error; err != nil {
+			return organizationError(err, "failed to update organization")
+		}
+	}
+
+	if org, err = a.loadOrganization(c); err != nil {
+		return err
+	}
+	return c.JSON(newOrganizationView(*org))
+}
+
+// handleSetCustomDomain sets the custom domain of the caller's organization. The domain
+// only routes to the organization after it was verified with handleVerifyCustomDomain;
+// the response contains the TXT record to publish.
+func (a *API) handleSetCustomDomain(c fiber.Ctx) error {
+	org, err := a.loadOrganization(c)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Domain string `json:"domain"`
+	}
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(body.Domain), "."))
+	if !domainPattern.MatchString(domain) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid domain")
+	}
+	if base := strings.ToLower(strings.Trim(a.cfg.Tenancy.BaseDomain, ".")); base != "" &&
+		(domain == base || strings.HasSuffix(domain, "."+base)) {
+		return fiber.NewError(fiber.StatusBadRequest, "subdomains of the base domain cannot be custom domains")
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to set custom domain")
+	}
+	if err := a.iamDB.Model(org).Updates(map[string]any{
+		"custom_domain":             domain,
+		"custom_domain_verified":    false,
+		"domain_verification_token": "goiam-verification=" + token,
+	}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to set custom domain")
+	}
+	return c.JSON(newOrganizationView(*org))
+}
+
+// handleVerifyCustomDomain checks the TXT record of the custom domain of the caller's
+// organization and, if it holds the verification token, marks the domain as verified.
+func (a *API) handleVerifyCustomDomain(c fiber.Ctx) error {
+	org, err := a.loadOrganization(c)
+	if err != nil {
+		return err
+	}
+	if org.CustomDomain == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "no custom domain set")
+	}
+	if org.CustomDomainVerified {
+		return c.JSON(newOrganizationView(*org))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	records, err := net.DefaultResolver.LookupTXT(ctx, domainVerificationPrefix+org.CustomDomain)
+	if err != nil || !slices.Contains(records, org.DomainVerificationToken) {
+		return fiber.NewError(fiber.StatusBadRequest, "verification TXT record not found")
+	}
+
+	// A domain routes to a single organization
+	var taken int64
+	if err := a.iamDB.Model(&db.Organization{}).
+		Where("custom_domain = ? AND custom_domain_verified = ? AND id <> ?", org.CustomDomain, true, org.ID).
+		Count(&taken).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to verify custom domain")
+	}
+	if taken > 0 {
+		return fiber.NewError(fiber.StatusConflict, "domain is already used by another organization")
+	}
+
+	if err := a.iamDB.Model(org).Update("custom_domain_verified", true).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to verify custom domain")
+	}
+	return c.JSON(newOrganizationView(*org))
+}
+
+// handleDeleteCustomDomain removes the custom domain of the caller's organization.
+func (a *API) handleDeleteCustomDomain(c fiber.Ctx) error {
+	org, err := a.loadOrganization(c)
+	if err != nil {
+		return err
+	}
+	if err := a.iamDB.Model(org).Updates(map[string]any{
+		"custom_domain":             "",
+		"custom_domain_verified":    false,
+		"domain_verification_token": "",
+	}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete custom domain")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadOrganization loads the organization of the authenticated principal.
+func (a *API) loadOrganization(c fiber.Ctx) (*db.Organization, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	var org db.Organization
+	if err := a.iamDB.First(&org, principal.PrincipalOrgID()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "organization not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+	}
+	return &org, nil
+}
+
+// organizationError maps errors from creating or updating an organization to HTTP errors.
+func organizationError(err error, msg string) error {
+	if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+		return fiber.NewError(fiber.StatusConflict, "organization name or slug already exists")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
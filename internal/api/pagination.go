@@ -0,0 +1,66 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// Default and maximum page sizes of list endpoints.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageQuery represents the pagination query parameters of list endpoints.
+type pageQuery struct {
+	Page     int `query:"page"`      // 1-based page number (default 1)
+	PageSize int `query:"page_size"` // items per page (default 50, max 200)
+}
+
+// pageView is the JSON envelope of a paginated list.
+type pageView[T any] struct {
+	Items    []T   `json:"items"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+	Total    int64 `json:"total"`
+}
+
+// paginate counts the records matched by query, loads the requested page ordered
+// by ID with the given associations preloaded, and converts them with view.
+//
+// query should only carry the model and filters; preloads are applied after counting.
+func paginate[T, V any](c fiber.Ctx, query *gorm.DB, view func(T) V, preloads ...string) (*pageView[V], error) {
+	var q pageQuery
+	if err := c.Bind().Query(&q); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid pagination parameters")
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	find := query.Session(&gorm.Session{})
+	for _, p := range preloads {
+		find = find.Preload(p)
+	}
+	var records []T
+	if err := find.Order("id").Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	page := &pageView[V]{Items: make([]V, 0, len(records)), Page: q.Page, PageSize: q.PageSize, Total: total}
+	for _, r := range records {
+		page.Items = append(page.Items, view(r))
+	}
+	return page, nil
+}
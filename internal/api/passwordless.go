@@ -0,0 +1,348 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/smtpclient"
+	"gorm.io/gorm"
+)
+
+const (
+	// emailLoginCodeDigits is the length of emailed one-time login codes.
+	emailLoginCodeDigits = 6
+
+	// emailLoginMaxAttempts is how often a code can be entered wrongly before it is invalidated.
+	emailLoginMaxAttempts = 5
+
+	// emailLoginResendInterval is the minimum time between two login emails to a user.
+	emailLoginResendInterval = time.Minute
+)
+
+// emailLoginRequestedMessage is returned for every passwordless login request, whether or
+// not an account matched, so the endpoint cannot be used to enumerate accounts.
+const emailLoginRequestedMessage = "If the account exists and can log in by email, you will receive an email with instructions to log in"
+
+// errInvalidLoginCode is returned for wrong, expired and exhausted login codes alike.
+var errInvalidLoginCode = fiber.NewError(fiber.StatusUnauthorized, "invalid or expired code")
+
+// handleEmailLoginRequestInput represents the expected JSON structure for requesting a login email.
+type handleEmailLoginRequestInput struct {
+	Username     string `json:"username"` // username or email is required
+	Email        string `json:"email"`
+	Mode         string `json:"mode"`         // "code" (default) or "link"
+	DeviceID     string `json:"device_id"`    // optional, binds the refresh token to this device
+	Organization string `json:"organization"` // optional, resolved like /auth/login
+}
+
+// handleEmailLoginCodeInput represents the expected JSON structure for logging in with a code.
+type handleEmailLoginCodeInput struct {
+	Username     string `json:"username"` // username or email is required
+	Email        string `json:"email"`
+	Code         string `json:"code"`      // required
+	DeviceID     string `json:"device_id"` // optional, overrides the device given in the request
+	Organization string `json:"organization"`
+}
+
+// passwordlessOrg resolves the organization of a passwordless login like handleLogin
+// and rejects organizations that have not enabled passwordless login.
+func (a *API) passwordlessOrg(c fiber.Ctx, slug string) (db.Organization, error) {
+	org, err := a.resolveLoginOrg(c, slug)
+	if err != nil {
+		return org, err
+	}
+	if !org.PasswordlessLogin {
+		return org, fiber.NewError(fiber.StatusForbidden, "passwordless login is disabled for this organization")
+	}
+	return org, nil
+}
+
+// findPasswordlessUser looks up the user of the organization by username or, if empty,
+// email. Only active local accounts with a verified email can log in by email.
+func (a *API) findPasswordlessUser(orgID uint, username, email string) (db.User, error) {
+	var user db.User
+	query := a.iamDB.Where("organization_id = ? AND is_active = ? AND email_verified = ? AND email <> ? AND auth_provider = ?",
+		orgID, true, true, "", "")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	} else {
+		query = query.Where("email = ?", email)
+	}
+	err := query.First(&user).Error
+	return user, err
+}
+
+// handleEmailLoginRequest emails a one-time login code or magic link to a user of an
+// organization with passwordless login enabled.
+//
+// Earlier codes and links of the user are invalidated, and at most one code or link is
+// issued per emailLoginResendInterval, also to concurrent requests. The response is the
+// same whether or not an email was sent; the email itself is sent in the background.
+func (a *API) handleEmailLoginRequest(c fiber.Ctx) error {
+	var body handleEmailLoginRequestInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Username == "" && body.Email == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "username or email is required")
+	}
+	if body.Mode == "" {
+		body.Mode = "code"
+	}
+	if body.Mode != "code" && body.Mode != "link" {
+		return fiber.NewError(fiber.StatusBadRequest, `mode must be "code" or "link"`)
+	}
+
+	org, err := a.passwordlessOrg(c, body.Organization)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.findPasswordlessUser(org.ID, body.Username, body.Email)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(fiber.Map{"message": emailLoginRequestedMessage})
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
+
+	elt, secret, err := a.newEmailLoginToken(user, body.Mode, deviceID(c, body.DeviceID))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to request login email")
+	}
+	issued, err := db.IssueEmailLoginToken(a.iamDB, &elt, emailLoginResendInterval)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to request login email")
+	}
+	if issued {
+		go func(u db.User, mode string) {
+			if err := a.sendEmailLogin(u, mode, secret); err != nil {
+				log.Printf("failed to send login email to user %d: %v", u.ID, err)
+			}
+		}(user, body.Mode)
+	}
+
+	return c.JSON(fiber.Map{"message": emailLoginRequestedMessage})
+}
+
+// handleEmailLoginCode logs a user in with an emailed one-time code.
+//
+// Every wrong code counts as an attempt; after emailLoginMaxAttempts the code is
+// invalidated and a new one has to be requested. Responds like /auth/login.
+func (a *API) handleEmailLoginCode(c fiber.Ctx) error {
+	var body handleEmailLoginCodeInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if (body.Username == "" && body.Email == "") || body.Code == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "username or email and code are required")
+	}
+
+	org, err := a.passwordlessOrg(c, body.Organization)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.findPasswordlessUser(org.ID, body.Username, body.Email)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		a.storeLoginActivity(c, db.User{Username: body.Username, OrganizationID: org.ID}, "user_not_found")
+		return errInvalidLoginCode
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
+
+	var elt db.EmailLoginToken
+	err = a.iamDB.Where("user_id = ? AND mode = ? AND used_at IS NULL AND expires_at > ?", user.ID, "code", time.Now()).
+		Order("id DESC").First(&elt).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		a.storeLoginActivity(c, user, "invalid_login_code")
+		return errInvalidLoginCode
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load code")
+	}
+
+	// Count the attempt before checking the code, so concurrent guesses cannot exceed the limit
+	res := a.iamDB.Model(&db.EmailLoginToken{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", elt.ID, emailLoginMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to verify code")
+	}
+	if res.RowsAffected != 1 {
+		a.storeLoginActivity(c, user, "login_code_attempts_exceeded")
+		return errInvalidLoginCode
+	}
+
+	if !auth.CheckPasswordHash(strings.TrimSpace(body.Code), elt.CodeHash) {
+		if elt.Attempts+1 >= emailLoginMaxAttempts {
+			a.iamDB.Model(&db.EmailLoginToken{}).Where("id = ? AND used_at IS NULL", elt.ID).Update("used_at", time.Now())
+			a.storeLoginActivity(c, user, "login_code_attempts_exceeded")
+		} else {
+			a.storeLoginActivity(c, user, "invalid_login_code")
+		}
+		return errInvalidLoginCode
+	}
+
+	res = a.iamDB.Model(&db.EmailLoginToken{}).
+		Where("id = ? AND used_at IS NULL", elt.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to verify code")
+	}
+	if res.RowsAffected != 1 {
+		return errInvalidLoginCode // redeemed by a concurrent request
+	}
+
+	user, err = a.loadLoginUser(user.ID)
+	if err != nil {
+		return err
+	}
+	device := body.DeviceID
+	if device == "" {
+		device = elt.DeviceID
+	}
+	return a.completeLogin(c, user, "", device)
+}
+
+// handleEmailLoginLink logs a user in with the token of an emailed magic link.
+//
+// Links are redeemed with POST by the page they point to, so that link scanners of
+// mail servers, which follow links with GET, cannot use them up. Responds like /auth/login.
+func (a *API) handleEmailLoginLink(c fiber.Ctx) error {
+	var body struct {
+		Token    string `json:"token"`     // required
+		DeviceID string `json:"device_id"` // optional, overrides the device given in the request
+	}
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Token == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "token is required")
+	}
+
+	elt, err := db.ConsumeEmailLoginLink(a.iamDB, auth.HashToken(strings.TrimSpace(body.Token)))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid or expired link")
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to verify link")
+	}
+
+	user, err := a.loadLoginUser(elt.UserID)
+	if err != nil {
+		return err
+	}
+	// The user or organization may have changed since the link was sent
+	var org db.Organization
+	if err := a.iamDB.First(&org, user.OrganizationID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+	}
+	if tenant, ok := c.Locals("tenant").(db.Organization); ok && tenant.ID != org.ID {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid or expired link")
+	}
+	if !org.PasswordlessLogin {
+		return fiber.NewError(fiber.StatusForbidden, "passwordless login is disabled for this organization")
+	}
+	if err := a.checkLoginAllowed(c, user); err != nil {
+		return err
+	}
+	if !user.EmailVerified || user.AuthProvider != "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid or expired link")
+	}
+
+	device := body.DeviceID
+	if device == "" {
+		device = elt.DeviceID
+	}
+	return a.completeLogin(c, user, "", device)
+}
+
+// loadLoginUser loads a user for completeLogin, with the backup codes needed for the second factor.
+func (a *API) loadLoginUser(id uint) (db.User, error) {
+	var user db.User
+	if err := a.iamDB.Preload("BackupCodes").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+		}
+		return user, fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
+	return user, nil
+}
+
+// newEmailLoginToken generates a login code or magic link token for the user and
+// returns the record storing its hash, which expires after token.email_login_ttl,
+// together with the secret to email.
+func (a *API) newEmailLoginToken(u db.User, mode, device string) (db.EmailLoginToken, string, error) {
+	elt := db.EmailLoginToken{
+		UserID:    u.ID,
+		Mode:      mode,
+		DeviceID:  device,
+		ExpiresAt: time.Now().Add(a.cfg.Token.EmailLoginTTL),
+	}
+
+	// Only the hash of the code or token is stored
+	var secret string
+	var err error
+	if mode == "code" {
+		if secret, err = auth.GenerateNumericCode(emailLoginCodeDigits); err != nil {
+			return elt, "", err
+		}
+		if elt.CodeHash, err = auth.HashPassword(secret); err != nil {
+			return elt, "", err
+		}
+	} else {
+		if secret, err = auth.GenerateOpaqueToken(); err != nil {
+			return elt, "", err
+		}
+		elt.LinkHash = auth.HashToken(secret)
+	}
+	return elt, secret, nil
+}
+
+// sendEmailLogin populates an email template with the login code or magic link token
+// of the user and sends it.
+//
+// Parameters:
+//   - u: the user who requested to log in
+//   - mode: "code" (login-code.html) or "link" (magic-link.html)
+//   - secret: the code or link token issued by newEmailLoginToken
+//
+// Behavior:
+//   - Uses the user's FirstName if available, otherwise falls back to Username
+//   - Replaces placeholders in the HTML template and sends the email
+func (a *API) sendEmailLogin(u db.User, mode, secret string) error {
+	// Choose the name to personalize the email
+	_name := u.Username
+	if u.FirstName != "" {
+		_name = u.FirstName
+	}
+
+	// Prepare template placeholders
+	placeholders := map[string]string{
+		"Name":    _name,
+		"AppName": a.cfg.AppName,
+		"Year":    fmt.Sprintf("%d", time.Now().Year()),
+		"Minutes": fmt.Sprintf("%d", int(a.cfg.Token.EmailLoginTTL.Minutes())),
+	}
+
+	subject, tmplt := "Your Login Code", "login-code.html"
+	placeholders["Code"] = secret
+	if mode == "link" {
+		subject, tmplt = "Your Login Link", "magic-link.html"
+		delete(placeholders, "Code")
+		placeholders["Token"] = secret
+	}
+
+	// Send the login email using HTML template
+	return smtpclient.SendEmailFromHTMLTemplate(a.cfg, subject,
+		[]string{u.Email}, filepath.Join(a.cfg.SMTP.TemplateDir, tmplt), placeholders)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// newPasswordlessTestAPI starts an API with the organization "acme" allowing passwordless
+// login and its user alice, whose email is verified.
+func newPasswordlessTestAPI(t *testing.T) (*API, *fiber.App, db.User) {
+	t.Helper()
+
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	if status, res := doJSON(t, app, http.MethodPatch, "/s/org", map[string]any{"passwordless_login": true}, admin); status != http.StatusOK {
+		t.Fatalf("enable passwordless login: %d %v", status, res)
+	}
+	loginAsLimitedUser(t, a, app, admin, "alice", "user:read")
+
+	var alice db.User
+	if err := a.iamDB.Where("username = ?", "alice").First(&alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.iamDB.Model(&alice).Update("email_verified", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	return a, app, alice
+}
+
+func TestEmailLoginRequestThrottlesConcurrentRequests(t *testing.T) {
+	a, app, alice := newPasswordlessTestAPI(t)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, res := doJSON(t, app, http.MethodPost, "/auth/passwordless/request", map[string]any{
+				"username": "alice", "organization": "acme",
+			}, "")
+			if status != http.StatusOK {
+				t.Errorf("request: %d %v", status, res)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var issued int64
+	a.iamDB.Model(&db.EmailLoginToken{}).Where("user_id = ?", alice.ID).Count(&issued)
+	if issued != 1 {
+		t.Errorf("%d login codes issued by concurrent requests, want 1", issued)
+	}
+}
+
+// issueEmailLogin stores a login code or link of the user expiring after ttl, as a login
+// request does, and returns the code or link token.
+func issueEmailLogin(t *testing.T, a *API, user db.User, mode string, ttl time.Duration) string {
+	t.Helper()
+
+	elt, secret, err := a.newEmailLoginToken(user, mode, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	elt.ExpiresAt = time.Now().Add(ttl)
+	if issued, err := db.IssueEmailLoginToken(a.iamDB, &elt, 0); err != nil || !issued {
+		t.Fatalf("issue %s: %v %v", mode, issued, err)
+	}
+	return secret
+}
+
+func TestEmailLoginCode(t *testing.T) {
+	a, app, alice := newPasswordlessTestAPI(t)
+
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		wrongGuesses int  // wrong codes entered before the right one
+		superseded   bool // a new code was requested after this one
+		wantStatus   int
+	}{
+		{"right code", time.Minute, 0, false, http.StatusOK},
+		{"right code after wrong guesses", time.Minute, emailLoginMaxAttempts - 1, false, http.StatusOK},
+		{"right code after the attempt limit", time.Minute, emailLoginMaxAttempts, false, http.StatusUnauthorized},
+		{"expired code", -time.Second, 0, false, http.StatusUnauthorized},
+		{"superseded code", time.Minute, 0, true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		code := issueEmailLogin(t, a, alice, "code", tt.ttl)
+		if tt.superseded {
+			issueEmailLogin(t, a, alice, "code", time.Minute)
+		}
+		enter := func(code string) (int, map[string]any) {
+			return doJSON(t, app, http.MethodPost, "/auth/passwordless/code", map[string]any{
+				"username": "alice", "organization": "acme", "code": code,
+			}, "")
+		}
+
+		for range tt.wrongGuesses {
+			if status, res := enter("wrong"); status != http.StatusUnauthorized {
+				t.Errorf("%s: wrong code: got %d %v", tt.name, status, res)
+			}
+		}
+		if status, res := enter(code); status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+		// Codes are single-use
+		if tt.wantStatus == http.StatusOK {
+			if status, res := enter(code); status != http.StatusUnauthorized {
+				t.Errorf("%s: code reused: got %d %v", tt.name, status, res)
+			}
+		}
+	}
+}
+
+func TestEmailLoginLink(t *testing.T) {
+	a, app, alice := newPasswordlessTestAPI(t)
+
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		superseded bool // a new link was requested after this one
+		wantStatus int
+	}{
+		{"link", time.Minute, false, http.StatusOK},
+		{"expired link", -time.Second, false, http.StatusUnauthorized},
+		{"superseded link", time.Minute, true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		token := issueEmailLogin(t, a, alice, "link", tt.ttl)
+		if tt.superseded {
+			issueEmailLogin(t, a, alice, "link", time.Minute)
+		}
+
+		if status, res := doJSON(t, app, http.MethodPost, "/auth/passwordless/link", map[string]any{"token": token}, ""); status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+		// Links are single-use
+		if tt.wantStatus == http.StatusOK {
+			if status, res := doJSON(t, app, http.MethodPost, "/auth/passwordless/link", map[string]any{"token": token}, ""); status != http.StatusUnauthorized {
+				t.Errorf("%s: link reused: got %d %v", tt.name, status, res)
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// policyPreloads are the associations needed to render a policy document.
+var policyPreloads = []string{"Statements.Actions", "Statements.Resources", "Statements.Conditions"}
+
+// handlePolicyInput represents the expected JSON structure for creating or updating a policy.
+// Empty fields are left unchanged on update; a given document replaces all statements.
+type handlePolicyInput struct {
+	Name        string             `json:"name"`        // required on create
+	Slug        string             `json:"slug"`        // optional, generated from the name if empty
+	Description string             `json:"description"` // optional
+	Document    *db.PolicyDocument `json:"document"`    // required on create
+}
+
+// policyView is the JSON representation of a policy and its document.
+type policyView struct {
+	ID          uint              `json:"id"`
+	Name        string            `json:"name"`
+	Slug        string            `json:"slug"`
+	Description string            `json:"description"`
+	Document    db.PolicyDocument `json:"document"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// newPolicyView converts a policy with preloaded statements into its JSON representation.
+func newPolicyView(p db.Policy) policyView {
+	return policyView{
+		ID:          p.ID,
+		Name:        p.Name,
+		Slug:        p.Slug,
+		Description: p.Description,
+		Document:    db.NewPolicyDocument(p),
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+// handleCreatePolicy creates a policy in the caller's organization from a policy document.
+func (a *API) handleCreatePolicy(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handlePolicyInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if body.Document == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "document is required")
+	}
+	if err := body.Document.Validate(); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	slug, err := validSlug(body.Slug, body.Name)
+	if err != nil {
+		return err
+	}
+
+	policy := db.Policy{
+		Name:           strings.TrimSpace(body.Name),
+		Slug:           slug,
+		Description:    body.Description,
+		OrganizationID: principal.PrincipalOrgID(),
+		Statements:     body.Document.Statements(principal.PrincipalOrgID()),
+	}
+
+	if err := a.iamDB.Create(&policy).Error; err != nil {
+		return policyError(err, "failed to create policy")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newPolicyView(policy))
+}
+
+// handleListPolicies lists the policies of the caller's organization with their documents,
+// paginated with the page and page_size query parameters.
+func (a *API) handleListPolicies(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	query := a.iamDB.Model(&db.Policy{}).Where("organization_id = ?", principal.PrincipalOrgID())
+	page, err := paginate(c, query, newPolicyView, policyPreloads...)
+	if err != nil {
+		return listError(err, "failed to list policies")
+	}
+	return c.JSON(page)
+}
+
+// handleGetPolicy returns a policy of the caller's organization by ID or slug.
+func (a *API) handleGetPolicy(c fiber.Ctx) error {
+	policy, err := a.loadPolicy(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newPolicyView(*policy))
+}
+
+// handleUpdatePolicy updates the name, slug or description of a policy. If a document
+// is given, all statements are replaced by it in a single transaction.
+func (a *API) handleUpdatePolicy(c fiber.Ctx) error {
+	policy, err := a.loadPolicy(c)
+	if err != nil {
+		return err
+	}
+
+	var body handlePolicyInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if body.Document != nil {
+		if err := body.Document.Validate(); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	updates := map[string]any{}
+	if strings.TrimSpace(body.Name) != "" {
+		updates["name"] = strings.TrimSpace(body.Name)
+	}
+	if body.Slug != "" {
+		slug, err := validSlug(body.Slug, "")
+		if err != nil {
+			return err
+		}
+		updates["slug"] = slug
+	}
+	if body.Description != "" {
+		updates["description"] = body.Description
+	}
+	if body.Document != nil {
+		// Statements changed, so bump updated_at even without other updates
+		updates["updated_at"] = time.Now()
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(policy).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if body.Document == nil {
+			return nil
+		}
+		return db.ReplacePolicyStatements(tx, policy, body.Document.Statements(policy.OrganizationID))
+	})
+	if err != nil {
+		return policyError(err, "failed to update policy")
+	}
+
+	q := a.iamDB
+	for _, p := range policyPreloads {
+		q = q.Preload(p)
+	}
+	if err := q.First(policy, policy.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load policy")
+	}
+	return c.JSON(newPolicyView(*policy))
+}
+
+// handleDeletePolicy deletes a policy with its statements and detaches it from
+// all users, groups, roles and service accounts.
+func (a *API) handleDeletePolicy(c fiber.Ctx) error {
+	policy, err := a.loadPolicy(c)
+	if err != nil {
+		return err
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		for _, table := range []string{"user_policies", "group_policies", "role_policies", "service_account_policies"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE policy_id = ?", policy.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := db.ReplacePolicyStatements(tx, policy, nil); err != nil {
+			return err
+		}
+		return tx.Delete(policy).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete policy")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadPolicy loads the policy identified by the :policy route parameter (an ID or a slug)
+// within the caller's organization, with its statements preloaded.
+func (a *API) loadPolicy(c fiber.Ctx) (*db.Policy, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	q := a.iamDB
+	for _, p := range policyPreloads {
+		q = q.Preload(p)
+	}
+
+	var policy db.Policy
+	if err := whereIDOrSlug(q, c.Params("policy")).
+		Where("organization_id = ?", principal.PrincipalOrgID()).
+		First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "policy not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load policy")
+	}
+	return &policy, nil
+}
+
+// policyError maps errors from creating or updating a policy to HTTP errors.
+func policyError(err error, msg string) error {
+	if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+		return fiber.NewError(fiber.StatusConflict, "policy name or slug already exists")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// ErrUnknownUser is returned by providers that do not know a user. Login and password
+// reset then continue with the next configured provider; any other error is final.
+var ErrUnknownUser = errors.New("unknown user")
+
+var (
+	// errForeignAccount is returned when an external account matches an IAM user of another provider.
+	errForeignAccount = errors.New("account belongs to another provider")
+
+	// errNoEmail is returned for external accounts without an email address, which
+	// every IAM user needs.
+	errNoEmail = errors.New("account has no email address")
+)
+
+// Capabilities lists the operations an authentication provider supports.
+type Capabilities struct {
+	Login         bool // Authenticate verifies usernames and passwords
+	Register      bool // Register creates new accounts
+	ResetPassword bool // ResetPassword sends password reset instructions
+	Federation    bool // the provider implements FederatedProvider
+}
+
+// Provider is an authentication backend configured in auth_providers.
+//
+// Providers are asked in the configured order. Authenticate and ResetPassword return
+// ErrUnknownUser to hand the request to the next provider; registration is handled by
+// the first provider supporting it.
+type Provider interface {
+	// Name returns the name the provider is configured with, e.g. "local".
+	Name() string
+
+	// Capabilities returns the operations the provider supports. Methods of
+	// unsupported operations are never called.
+	Capabilities() Capabilities
+
+	// Authenticate verifies the credentials of a user of the organization and returns
+	// the IAM user. Second factors and token issuance are handled by the caller.
+	Authenticate(c fiber.Ctx, orgID uint, username, password string) (db.User, error)
+
+	// Register creates an account from the registration request and writes the response.
+	Register(c fiber.Ctx) error
+
+	// ResetPassword sends password reset instructions to the accounts matching the
+	// username or email. It must not reveal whether an account matched.
+	ResetPassword(c fiber.Ctx, username, email string) error
+}
+
+// FederatedProvider is a provider users log in at in the browser, with the OAuth2
+// authorization code flow started at /auth/federation/<name>/start.
+type FederatedProvider interface {
+	Provider
+
+	// Organization returns the slug of the organization the provider logs users in to.
+	Organization() string
+
+	// AuthCodeURL returns the URL the browser is redirected to for logging in.
+	// state, nonce and the S256 PKCE codeChallenge are generated by the caller.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+
+	// Exchange redeems the authorization code returned to the callback and returns the
+	// IAM user, provisioning or linking it as needed. Errors are *fiber.Error.
+	Exchange(c fiber.Ctx, code, codeVerifier, nonce string) (db.User, error)
+}
+
+// ProviderFactory creates a provider from its auth_providers entry. Factories decode
+// provider-specific settings with config.AuthProviderConfig.As.
+type ProviderFactory func(a *API, pc config.AuthProviderConfig) (Provider, error)
+
+// providerFactories holds the known providers by their configured name.
+var providerFactories = map[string]ProviderFactory{
+	"local":    newLocalProvider,
+	"ldap":     newLDAPProvider,
+	"oidc":     newOIDCProvider,
+	"auth0":    newAuth0Provider,
+	"entra_id": newEntraIDProvider,
+}
+
+// RegisterProvider makes a provider available under name in auth_providers.
+// It must be called before New; registering a name twice replaces the factory.
+func RegisterProvider(name string, f ProviderFactory) {
+	providerFactories[name] = f
+}
+
+// loadProviders creates the providers configured in auth_providers, in order.
+// Unknown and duplicate names are rejected, so typos do not silently disable a provider.
+func (a *API) loadProviders() error {
+	seen := map[string]bool{}
+	for _, pc := range a.cfg.AuthProviders {
+		f, ok := providerFactories[pc.Name]
+		if !ok {
+			return fmt.Errorf("auth provider %q is not supported", pc.Name)
+		}
+		if seen[pc.Name] {
+			return fmt.Errorf("auth provider %q is configured more than once", pc.Name)
+		}
+		seen[pc.Name] = true
+
+		p, err := f(a, pc)
+		if err != nil {
+			return fmt.Errorf("auth provider %q: %w", pc.Name, err)
+		}
+		a.providers = append(a.providers, p)
+	}
+	return nil
+}
+
+// providerNames returns the names of the configured providers, in order. Unlike the
+// provider configuration, they can be shown publicly.
+func (a *API) providerNames() []string {
+	names := make([]string, 0, len(a.providers))
+	for _, p := range a.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// authenticate verifies a username and password with each login provider in order.
+//
+// A provider that does not know the user hands over to the next one; the first other
+// answer, successful or not, is final. If no provider knows the user, the attempt is
+// recorded and 401 is returned.
+func (a *API) authenticate(c fiber.Ctx, orgID uint, username, password string) (db.User, error) {
+	for _, p := range a.providers {
+		if !p.Capabilities().Login {
+			continue
+		}
+		user, err := p.Authenticate(c, orgID, username, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		return user, err
+	}
+
+	a.storeLoginActivity(c, db.User{Username: username, OrganizationID: orgID}, "user_not_found")
+	return db.User{}, fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+}
+
+// handleRegister passes a registration request to the first provider supporting it.
+func (a *API) handleRegister(c fiber.Ctx) error {
+	for _, p := range a.providers {
+		if p.Capabilities().Register {
+			return p.Register(c)
+		}
+	}
+	return fiber.NewError(fiber.StatusForbidden, "registration is disabled")
+}
+
+// handleResetPasswordRequest asks each provider supporting password resets, in order,
+// to send reset instructions, until one knows the account.
+//
+// The response is the same whether or not an account matched, so the endpoint cannot
+// be used to enumerate accounts. Provider errors are logged only.
+func (a *API) handleResetPasswordRequest(c fiber.Ctx) error {
+	var body struct {
+		Username string `json:"username"` // username or email is required
+		Email    string `json:"email"`
+	}
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Username == "" && body.Email == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "username or email is required")
+	}
+
+	for _, p := range a.providers {
+		if !p.Capabilities().ResetPassword {
+			continue
+		}
+		err := p.ResetPassword(c, body.Username, body.Email)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		if err != nil {
+			log.Printf("password reset with provider %s failed: %v", p.Name(), err)
+		}
+		break
+	}
+
+	return c.JSON(fiber.Map{"message": resetPasswordRequestedMessage})
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// ldapProvider authenticates users against an LDAP or Active Directory server and
+// provisions them just in time into the configured organization.
+type ldapProvider struct {
+	a         *API
+	cfg       config.LDAPConfig
+	tlsConfig *tls.Config
+	mappings  []ldapGroupMapping
+}
+
+// ldapGroupMapping is a config.LDAPGroupMapping with its parsed group DN.
+type ldapGroupMapping struct {
+	config.LDAPGroupMapping
+	dn *ldap.DN
+}
+
+// newLDAPProvider creates the "ldap" provider from its auth_providers entry and applies
+// the defaults of config.LDAPConfig.
+func newLDAPProvider(a *API, pc config.AuthProviderConfig) (Provider, error) {
+	p := &ldapProvider{a: a}
+	if err := pc.As(&p.cfg); err != nil {
+		return nil, err
+	}
+	cfg := &p.cfg
+
+	if cfg.Server == "" || cfg.BaseDN == "" || cfg.Organization == "" {
+		return nil, errors.New("server, baseDn and organization are required")
+	}
+	u, err := url.Parse(cfg.Server)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return nil, errors.New("server must be an ldap:// or ldaps:// URL")
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return nil, errors.New("startTls cannot be used with ldaps://")
+	}
+
+	p.tlsConfig = &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACertFile)
+		}
+		p.tlsConfig.RootCAs = pool
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid={username})"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.FirstNameAttribute == "" {
+		cfg.FirstNameAttribute = "givenName"
+	}
+	if cfg.LastNameAttribute == "" {
+		cfg.LastNameAttribute = "sn"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.GroupBaseDN == "" {
+		cfg.GroupBaseDN = cfg.BaseDN
+	}
+
+	for _, m := range cfg.GroupMappings {
+		dn, err := ldap.ParseDN(m.GroupDN)
+		if err != nil {
+			return nil, fmt.Errorf("groupMappings: invalid groupDn %q: %w", m.GroupDN, err)
+		}
+		p.mappings = append(p.mappings, ldapGroupMapping{LDAPGroupMapping: m, dn: dn})
+	}
+
+	return p, nil
+}
+
+// Name returns "ldap".
+func (p *ldapProvider) Name() string { return "ldap" }
+
+// Capabilities reports login support only; accounts and passwords are managed in the directory.
+func (p *ldapProvider) Capabilities() Capabilities {
+	return Capabilities{Login: true}
+}
+
+// Authenticate finds the user in the directory with the service account, verifies the
+// password by binding as the user, and provisions or updates the IAM user.
+//
+// Logins for other organizations than the configured one, and users not found in the
+// directory, yield ErrUnknownUser. An unreachable server is a final error, so logins do
+// not silently fall through to another provider.
+func (p *ldapProvider) Authenticate(c fiber.Ctx, orgID uint, username, password string) (db.User, error) {
+	var org db.Organization
+	if err := p.a.iamDB.Where("slug = ?", p.cfg.Organization).First(&org).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.User{}, ErrUnknownUser
+		}
+		return db.User{}, fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+	}
+	if org.ID != orgID {
+		return db.User{}, ErrUnknownUser
+	}
+
+	conn, err := p.dialServer()
+	if err != nil {
+		log.Printf("ldap: %v", err)
+		return db.User{}, fiber.NewError(fiber.StatusServiceUnavailable, "directory is unavailable")
+	}
+	defer conn.Close()
+
+	entry, err := p.findUser(conn, username)
+	if err != nil {
+		log.Printf("ldap: user search for %q failed: %v", username, err)
+		return db.User{}, fiber.NewError(fiber.StatusServiceUnavailable, "directory is unavailable")
+	}
+	if entry == nil {
+		return db.User{}, ErrUnknownUser
+	}
+	if name := entry.GetAttributeValue(p.cfg.UsernameAttribute); name != "" {
+		username = name
+	}
+
+	// Groups are read with the service account, which may see more than the user
+	memberOf, err := p.groupsOf(conn, entry, username)
+	if err != nil {
+		log.Printf("ldap: group lookup for %q failed: %v", entry.DN, err)
+		return db.User{}, fiber.NewError(fiber.StatusServiceUnavailable, "directory is unavailable")
+	}
+
+	// An empty password would be an unauthenticated bind, which servers accept
+	if password == "" {
+		p.a.storeLoginActivity(c, db.User{Username: username, OrganizationID: orgID}, "invalid_password")
+		return db.User{}, fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			log.Printf("ldap: bind as %q failed: %v", entry.DN, err)
+		}
+		p.a.storeLoginActivity(c, db.User{Username: username, OrganizationID: orgID}, "invalid_password")
+		return db.User{}, fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+	}
+
+	user, err := p.provision(orgID, username, entry, memberOf)
+	if err != nil {
+		switch {
+		case errors.Is(err, errForeignAccount):
+			p.a.storeLoginActivity(c, user, "provider_mismatch")
+			return db.User{}, fiber.NewError(fiber.StatusConflict, "an account with this username already exists")
+		case errors.Is(err, errNoEmail):
+			log.Printf("ldap: %q has no %s attribute", entry.DN, p.cfg.EmailAttribute)
+			return db.User{}, fiber.NewError(fiber.StatusForbidden, "directory account has no email address")
+		case strings.Contains(strings.ToUpper(err.Error()), "UNIQUE"):
+			return db.User{}, fiber.NewError(fiber.StatusConflict, "an account with this email already exists")
+		}
+		log.Printf("ldap: provisioning %q failed: %v", entry.DN, err)
+		return db.User{}, fiber.NewError(fiber.StatusInternalServerError, "failed to provision user")
+	}
+
+	if err := p.a.checkLoginAllowed(c, user); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// Register is not supported; accounts are created in the directory.
+func (p *ldapProvider) Register(c fiber.Ctx) error {
+	return fiber.ErrNotImplemented
+}
+
+// ResetPassword is not supported; passwords are changed in the directory.
+func (p *ldapProvider) ResetPassword(c fiber.Ctx, username, email string) error {
+	return ErrUnknownUser
+}
+
+// dialServer connects to the server, upgrades the connection with StartTLS if
+// configured, and binds as the service account.
+func (p *ldapProvider) dialServer() (ldap.Client, error) {
+	conn, err := ldap.DialURL(p.cfg.Server,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.cfg.Timeout)
+
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser searches the user entry with UserFilter. It returns nil if no entry matched;
+// ambiguous filters matching several entries are an error.
+func (p *ldapProvider) findUser(conn ldap.Client, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(p.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	attrs := []string{p.cfg.UsernameAttribute, p.cfg.EmailAttribute,
+		p.cfg.FirstNameAttribute, p.cfg.LastNameAttribute, p.cfg.GroupAttribute}
+
+	res, err := conn.Search(ldap.NewSearchRequest(p.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(p.cfg.Timeout.Seconds()), false,
+		filter, attrs, nil))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("filter %q matches more than one entry", filter)
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch len(res.Entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return res.Entries[0], nil
+	}
+	return nil, fmt.Errorf("filter %q matches more than one entry", filter)
+}
+
+// groupsOf returns the DNs of the LDAP groups the user is a member of.
+func (p *ldapProvider) groupsOf(conn ldap.Client, entry *ldap.Entry, username string) ([]*ldap.DN, error) {
+	var dns []string
+	if p.cfg.GroupFilter == "" {
+		dns = entry.GetAttributeValues(p.cfg.GroupAttribute)
+	} else {
+		filter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(username),
+		).Replace(p.cfg.GroupFilter)
+		res, err := conn.Search(ldap.NewSearchRequest(p.cfg.GroupBaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(p.cfg.Timeout.Seconds()), false,
+			filter, []string{"1.1"}, nil)) // no attributes, the DN is enough
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range res.Entries {
+			dns = append(dns, e.DN)
+		}
+	}
+
+	groups := make([]*ldap.DN, 0, len(dns))
+	for _, s := range dns {
+		dn, err := ldap.ParseDN(s)
+		if err != nil {
+			log.Printf("ldap: ignoring invalid group DN %q: %v", s, err)
+			continue
+		}
+		groups = append(groups, dn)
+	}
+	return groups, nil
+}
+
+// provision creates the IAM user of a directory entry on first login, or updates its
+// profile from the directory, and synchronizes mapped group and role memberships.
+// Existing accounts of other providers are never taken over.
+func (p *ldapProvider) provision(orgID uint, username string, entry *ldap.Entry, memberOf []*ldap.DN) (db.User, error) {
+	email := entry.GetAttributeValue(p.cfg.EmailAttribute)
+	if email == "" {
+		return db.User{}, errNoEmail
+	}
+	profile := map[string]any{
+		"email":          email,
+		"email_verified": true, // addresses are managed by directory administrators
+		"first_name":     entry.GetAttributeValue(p.cfg.FirstNameAttribute),
+		"last_name":      entry.GetAttributeValue(p.cfg.LastNameAttribute),
+		"external_id":    entry.DN,
+	}
+
+	var user db.User
+	err := db.PolicyTransaction(p.a.iamDB, func(tx *gorm.DB) error {
+		err := tx.Where("username = ? AND organization_id = ?", username, orgID).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = db.User{
+				Username:       username,
+				Email:          email,
+				EmailVerified:  true,
+				FirstName:      profile["first_name"].(string),
+				LastName:       profile["last_name"].(string),
+				IsActive:       true,
+				OrganizationID: orgID,
+				AuthProvider:   p.Name(),
+				ExternalID:     entry.DN,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+
+			var selfManage db.Policy
+			if err := tx.Where("slug = ? AND organization_id = ?", "self-manage", orgID).
+				First(&selfManage).Error; err == nil {
+				if err := tx.Model(&user).Association("Policies").Append(&selfManage); err != nil {
+					return err
+				}
+			}
+		case err != nil:
+			return err
+		case user.AuthProvider != p.Name():
+			return errForeignAccount
+		default:
+			if err := tx.Model(&user).Updates(profile).Error; err != nil {
+				return err
+			}
+		}
+		return p.syncMemberships(tx, &user, memberOf)
+	})
+	if err != nil {
+		return user, err
+	}
+
+	// Reload with the backup codes needed for the second factor
+	err = p.a.iamDB.Preload("BackupCodes").First(&user, user.ID).Error
+	return user, err
+}
+
+// syncMemberships synchronizes the groups and roles mapped from the user's LDAP groups.
+func (p *ldapProvider) syncMemberships(tx *gorm.DB, user *db.User, memberOf []*ldap.DN) error {
+	mapped := make([]mappedMembership, 0, len(p.mappings))
+	for _, m := range p.mappings {
+		mapped = append(mapped, mappedMembership{
+			Groups: m.Groups,
+			Roles:  m.Roles,
+			Member: slices.ContainsFunc(memberOf, m.dn.EqualFold),
+		})
+	}
+	return syncMappedMemberships(tx, user, mapped)
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+const (
+	ldapServiceDN   = "cn=goiam,dc=example,dc=org"
+	ldapAliceDN     = "uid=alice,ou=people,dc=example,dc=org"
+	ldapAdminsDN    = "cn=admins,ou=groups,dc=example,dc=org"
+	ldapAlicePasswd = "wonderland"
+)
+
+// ldapTestEntry is an entry of the in-process directory.
+type ldapTestEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// ldapTestServer is a minimal in-process LDAP server answering simple binds and
+// searches with equality, presence, and and or filters, enough for the provider.
+type ldapTestServer struct {
+	addr string
+
+	mu      sync.Mutex
+	entries []*ldapTestEntry
+	ops     []string // "bind <dn>" and "search <filter>", in order
+}
+
+// newLDAPTestServer starts a directory with a service account and the user alice,
+// a member of the admins group.
+func newLDAPTestServer(t *testing.T) *ldapTestServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &ldapTestServer{
+		addr: l.Addr().String(),
+		entries: []*ldapTestEntry{
+			{dn: ldapServiceDN, password: "svc-secret", attrs: map[string][]string{"cn": {"goiam"}}},
+			{dn: ldapAliceDN, password: ldapAlicePasswd, attrs: map[string][]string{
+				"uid":       {"alice"},
+				"mail":      {"alice@example.org"},
+				"givenName": {"Alice"},
+				"sn":        {"Liddell"},
+				"memberOf":  {ldapAdminsDN},
+			}},
+		},
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config returns the auth_providers entry of the "ldap" provider using this server.
+func (s *ldapTestServer) config() string {
+	return "  - name: ldap\n" +
+		"    config:\n" +
+		"      server: ldap://" + s.addr + "\n" +
+		"      baseDn: dc=example,dc=org\n" +
+		"      bindDn: " + ldapServiceDN + "\n" +
+		"      bindPassword: svc-secret\n" +
+		"      organization: acme\n" +
+		"      groupMappings:\n" +
+		"        - groupDn: CN=Admins,OU=Groups,DC=example,DC=org\n" +
+		"          groups: [ops]\n" +
+		"          roles: [auditor]\n"
+}
+
+// setAttr replaces an attribute of the entry with the given DN.
+func (s *ldapTestServer) setAttr(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.dn == dn {
+			e.attrs[name] = values
+		}
+	}
+}
+
+// takeOps returns and clears the operations received so far.
+func (s *ldapTestServer) takeOps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ops := s.ops
+	s.ops = nil
+	return ops
+}
+
+func (s *ldapTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		var replies []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			replies = append(replies, s.bind(op))
+		case ldap.ApplicationSearchRequest:
+			replies = append(replies, s.search(op)...)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+		for _, r := range replies {
+			msg := ber.NewSequence("LDAPMessage")
+			msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+			msg.AppendChild(r)
+			if _, err := conn.Write(msg.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks a simple bind: name and password must match an entry.
+func (s *ldapTestServer) bind(op *ber.Packet) *ber.Packet {
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, "bind "+dn)
+
+	code := int(ldap.LDAPResultInvalidCredentials)
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password == password && password != "" {
+			code = ldap.LDAPResultSuccess
+		}
+	}
+	return ldapTestResult(ldap.ApplicationBindResponse, code)
+}
+
+// search returns the entries below the base DN matching the filter, then the result.
+func (s *ldapTestServer) search(op *ber.Packet) []*ber.Packet {
+	base := strings.ToLower(op.Children[0].Data.String())
+	filter := op.Children[6]
+	text, _ := ldap.DecompileFilter(filter)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, "search "+text)
+
+	var replies []*ber.Packet
+	for _, e := range s.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), base) || !e.matches(filter) {
+			continue
+		}
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+		attrs := ber.NewSequence("Attributes")
+		for name, values := range e.attrs {
+			attr := ber.NewSequence("Attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		entry.AppendChild(attrs)
+		replies = append(replies, entry)
+	}
+	return append(replies, ldapTestResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+// matches evaluates a filter against the entry, comparing case-insensitively.
+func (e *ldapTestEntry) matches(filter *ber.Packet) bool {
+	values := func(name string) []string {
+		for k, v := range e.attrs {
+			if strings.EqualFold(k, name) {
+				return v
+			}
+		}
+		return nil
+	}
+
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !e.matches(f) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		return slices.ContainsFunc(filter.Children, e.matches)
+	case ldap.FilterEqualityMatch:
+		want := filter.Children[1].Data.String()
+		return slices.ContainsFunc(values(filter.Children[0].Data.String()), func(v string) bool {
+			return strings.EqualFold(v, want)
+		})
+	case ldap.FilterPresent:
+		return len(values(filter.Data.String())) > 0
+	}
+	return false
+}
+
+// ldapTestResult encodes an LDAPResult with the given application tag and result code.
+func ldapTestResult(tag ber.Tag, code int) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "ResultCode"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "DiagnosticMessage"))
+	return res
+}
+
+// newLDAPTestAPI starts an API with the "ldap" provider followed by "local", and
+// registers the admin of the organization "acme" through the local provider.
+func newLDAPTestAPI(t *testing.T) (*API, *ldapTestServer, func(username, password string) (int, map[string]any), string) {
+	t.Helper()
+
+	s := newLDAPTestServer(t)
+	a, app := newTestAPI(t, "auth_providers:\n"+s.config()+"  - name: local\n")
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	login := func(username, password string) (int, map[string]any) {
+		return doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+			"username": username, "password": password, "organization": "acme",
+		}, "")
+	}
+	return a, s, login, admin
+}
+
+func TestLDAPLoginSearchesThenBindsAndProvisions(t *testing.T) {
+	a, s, login, _ := newLDAPTestAPI(t)
+	s.takeOps()
+
+	status, res := login("alice", ldapAlicePasswd)
+	if status != http.StatusOK {
+		t.Fatalf("login: %d %v", status, res)
+	}
+	if res["token"] == nil {
+		t.Fatalf("login: no token in %v", res)
+	}
+
+	// The user is found with the service account before binding as the user
+	want := []string{"bind " + ldapServiceDN, "search (uid=alice)", "bind " + ldapAliceDN}
+	if ops := s.takeOps(); !slices.Equal(ops, want) {
+		t.Errorf("directory operations = %q, want %q", ops, want)
+	}
+
+	var user db.User
+	if err := a.iamDB.Preload("Policies").Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatalf("provisioned user: %v", err)
+	}
+	if user.AuthProvider != "ldap" || user.ExternalID != ldapAliceDN || user.Email != "alice@example.org" ||
+		!user.EmailVerified || !user.IsActive || user.FirstName != "Alice" || user.LastName != "Liddell" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+	if !slices.ContainsFunc(user.Policies, func(p db.Policy) bool { return p.Slug == "self-manage" }) {
+		t.Errorf("provisioned user has no SelfManage policy: %v", user.Policies)
+	}
+
+	// Later logins update the profile from the directory instead of creating another user
+	s.setAttr(ldapAliceDN, "sn", "Pleasance")
+	if status, res := login("alice", ldapAlicePasswd); status != http.StatusOK {
+		t.Fatalf("second login: %d %v", status, res)
+	}
+	var users []db.User
+	a.iamDB.Where("username = ?", "alice").Find(&users)
+	if len(users) != 1 || users[0].LastName != "Pleasance" {
+		t.Errorf("users after second login = %+v", users)
+	}
+}
+
+func TestLDAPLoginRejectsWrongPassword(t *testing.T) {
+	a, _, login, _ := newLDAPTestAPI(t)
+
+	for _, password := range []string{"not-the-password", ""} {
+		if status, res := login("alice", password); status != http.StatusUnauthorized {
+			t.Errorf("login with password %q: got %d %v, want 401", password, status, res)
+		}
+	}
+	var count int64
+	a.iamDB.Model(&db.User{}).Where("username = ?", "alice").Count(&count)
+	if count != 0 {
+		t.Errorf("a user was provisioned without a successful bind")
+	}
+}
+
+func TestLDAPUnknownUserFallsThroughToLocal(t *testing.T) {
+	_, s, login, _ := newLDAPTestAPI(t)
+	s.takeOps()
+
+	// root was registered with the local provider and is not in the directory
+	status, res := login("root", "Secret123x")
+	if status != http.StatusOK {
+		t.Fatalf("local login: %d %v", status, res)
+	}
+	if ops := s.takeOps(); !slices.Contains(ops, "search (uid=root)") {
+		t.Errorf("the directory was not asked first: %q", ops)
+	}
+
+	if status, res := login("nobody", "whatever"); status != http.StatusUnauthorized {
+		t.Errorf("login of a user no provider knows: got %d %v, want 401", status, res)
+	}
+}
+
+func TestLDAPGroupMappingsSyncMemberships(t *testing.T) {
+	a, s, login, admin := newLDAPTestAPI(t)
+	app := a._app
+
+	for _, path := range []string{"/s/groups", "/s/roles"} {
+		for _, name := range []string{"Ops", "Auditor", "Manual"} {
+			if status, res := doJSON(t, app, http.MethodPost, path, map[string]any{"name": name}, admin); status != http.StatusCreated {
+				t.Fatalf("create %s %s: %d %v", path, name, status, res)
+			}
+		}
+	}
+
+	memberships := func() (groups, roles []string) {
+		t.Helper()
+		var user db.User
+		if err := a.iamDB.Preload("Groups").Preload("Roles").Where("username = ?", "alice").First(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, g := range user.Groups {
+			groups = append(groups, g.Slug)
+		}
+		for _, r := range user.Roles {
+			roles = append(roles, r.Slug)
+		}
+		slices.Sort(groups)
+		slices.Sort(roles)
+		return groups, roles
+	}
+
+	if status, res := login("alice", ldapAlicePasswd); status != http.StatusOK {
+		t.Fatalf("login: %d %v", status, res)
+	}
+	if groups, roles := memberships(); !slices.Equal(groups, []string{"ops"}) || !slices.Equal(roles, []string{"auditor"}) {
+		t.Fatalf("after login as an admins member: groups %v, roles %v", groups, roles)
+	}
+
+	// Memberships assigned by an administrator are not mapped and must survive the sync
+	var user db.User
+	a.iamDB.Where("username = ?", "alice").First(&user)
+	if status, res := doJSON(t, app, http.MethodPut, fmt.Sprintf("/s/groups/manual/members/%d", user.ID), nil, admin); status != http.StatusOK && status != http.StatusNoContent {
+		t.Fatalf("add manual member: %d %v", status, res)
+	}
+
+	s.setAttr(ldapAliceDN, "memberOf")
+	if status, res := login("alice", ldapAlicePasswd); status != http.StatusOK {
+		t.Fatalf("login after leaving admins: %d %v", status, res)
+	}
+	if groups, roles := memberships(); !slices.Equal(groups, []string{"manual"}) || len(roles) != 0 {
+		t.Errorf("after leaving admins: groups %v, roles %v, want [manual] and none", groups, roles)
+	}
+}
+
+// The server must be reachable for the provider to answer at all: an unreachable
+// directory is a final error rather than a fall-through to the local provider.
+func TestLDAPUnreachableServerIsFinal(t *testing.T) {
+	s := newLDAPTestServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	cfg := strings.Replace(s.config(), s.addr, closed, 1)
+	_, app := newTestAPI(t, "auth_providers:\n"+cfg+"  - name: local\n")
+	status, res := doJSON(t, app, http.MethodPost, "/auth/register", map[string]any{
+		"username": "root", "password": "Secret123x", "email": "root@acme.test", "organization_slug": "acme",
+	}, "")
+	if status != http.StatusOK && status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+	status, res = doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+		"username": "root", "password": "Secret123x", "organization": "acme",
+	}, "")
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("login with the directory down: got %d %v, want 503", status, res)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// localProvider authenticates users against the password hashes stored in the IAM database.
+type localProvider struct {
+	a   *API
+	cfg config.LocalConfig
+}
+
+// newLocalProvider creates the "local" provider from its auth_providers entry.
+func newLocalProvider(a *API, pc config.AuthProviderConfig) (Provider, error) {
+	p := &localProvider{a: a}
+	if err := pc.As(&p.cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Name returns "local".
+func (p *localProvider) Name() string { return "local" }
+
+// Capabilities reports login and password reset support, and registration unless
+// it was disabled with disableRegistration.
+func (p *localProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Login:         true,
+		Register:      !p.cfg.DisableRegistration,
+		ResetPassword: true,
+	}
+}
+
+// Authenticate verifies the password of a user of the organization.
+func (p *localProvider) Authenticate(c fiber.Ctx, orgID uint, username, password string) (db.User, error) {
+	return p.a.authenticateLocal(c, orgID, username, password)
+}
+
+// Register registers a user into a new organization.
+func (p *localProvider) Register(c fiber.Ctx) error {
+	return p.a.handleRegisterLocal(c)
+}
+
+// ResetPassword emails reset tokens to the active accounts matching username or email.
+func (p *localProvider) ResetPassword(c fiber.Ctx, username, email string) error {
+	return p.a.requestPasswordResetLocal(c, username, email)
+}
@@ -0,0 +1,582 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
+	"gorm.io/gorm"
+)
+
+// upstreamSigningMethods are the id_token algorithms accepted from upstream issuers.
+var upstreamSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// errCodeRejected is returned when the issuer rejects an authorization code as invalid,
+// expired or already redeemed.
+var errCodeRejected = errors.New("authorization code rejected")
+
+// oidcProvider logs users in at an upstream OpenID Connect provider with the
+// authorization code flow and provisions them just in time into the configured organization.
+type oidcProvider struct {
+	a          *API
+	name       string
+	cfg        config.UpstreamOIDCConfig
+	authParams url.Values // extra authorization request parameters, e.g. Auth0's audience
+	client     *http.Client
+
+	mu          sync.Mutex
+	meta        *oidcMetadata               // discovery document, fetched on first use
+	keys        map[string]crypto.PublicKey // id_token verification keys by kid
+	keysFetched time.Time                   // when keys were last fetched
+}
+
+// oidcMetadata holds the fields of an issuer's discovery document used for logins.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// newOIDCProvider creates the generic "oidc" provider from its auth_providers entry.
+func newOIDCProvider(a *API, pc config.AuthProviderConfig) (Provider, error) {
+	var cfg config.UpstreamOIDCConfig
+	if err := pc.As(&cfg); err != nil {
+		return nil, err
+	}
+	return newUpstreamOIDC(a, pc.Name, cfg, nil)
+}
+
+// newAuth0Provider creates the "auth0" preset: the issuer is the Auth0 domain and the
+// optional audience is requested in the authorization request.
+func newAuth0Provider(a *API, pc config.AuthProviderConfig) (Provider, error) {
+	var auth0 config.Auth0Config
+	var cfg config.UpstreamOIDCConfig
+	if err := pc.As(&auth0); err != nil {
+		return nil, err
+	}
+	if err := pc.As(&cfg); err != nil {
+		return nil, err
+	}
+	if auth0.Domain == "" {
+		return nil, errors.New("domain is required")
+	}
+	cfg.Issuer = "https://" + strings.Trim(auth0.Domain, "/") + "/"
+
+	var params url.Values
+	if auth0.Audience != "" {
+		params = url.Values{"audience": {auth0.Audience}}
+	}
+	return newUpstreamOIDC(a, pc.Name, cfg, params)
+}
+
+// newEntraIDProvider creates the "entra_id" preset: the issuer is the v2.0 endpoint of
+// the tenant at the authority host.
+func newEntraIDProvider(a *API, pc config.AuthProviderConfig) (Provider, error) {
+	var entra config.EntraIDConfig
+	var cfg config.UpstreamOIDCConfig
+	if err := pc.As(&entra); err != nil {
+		return nil, err
+	}
+	if err := pc.As(&cfg); err != nil {
+		return nil, err
+	}
+	if entra.TenantID == "" {
+		return nil, errors.New("tenantId is required")
+	}
+	authority := strings.TrimRight(entra.AuthorityHost, "/")
+	if authority == "" {
+		authority = "https://login.microsoftonline.com"
+	}
+	cfg.Issuer = authority + "/" + entra.TenantID + "/v2.0"
+	return newUpstreamOIDC(a, pc.Name, cfg, nil)
+}
+
+// newUpstreamOIDC validates cfg, applies its defaults and creates the provider.
+func newUpstreamOIDC(a *API, name string, cfg config.UpstreamOIDCConfig, authParams url.Values) (*oidcProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" || cfg.Organization == "" {
+		return nil, errors.New("issuer, clientId, redirectUrl and organization are required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	} else if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.EmailClaim == "" {
+		cfg.EmailClaim = "email"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+
+	return &oidcProvider{
+		a:          a,
+		name:       name,
+		cfg:        cfg,
+		authParams: authParams,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns the name the provider is configured with, e.g. "entra_id".
+func (p *oidcProvider) Name() string { return p.name }
+
+// Capabilities reports federation support only; users log in at the issuer.
+func (p *oidcProvider) Capabilities() Capabilities {
+	return Capabilities{Federation: true}
+}
+
+// Authenticate yields ErrUnknownUser; passwords are verified by the issuer.
+func (p *oidcProvider) Authenticate(c fiber.Ctx, orgID uint, username, password string) (db.User, error) {
+	return db.User{}, ErrUnknownUser
+}
+
+// Register is not supported; users are provisioned on their first login.
+func (p *oidcProvider) Register(c fiber.Ctx) error {
+	return fiber.ErrNotImplemented
+}
+
+// ResetPassword yields ErrUnknownUser; passwords are managed by the issuer.
+func (p *oidcProvider) ResetPassword(c fiber.Ctx, username, email string) error {
+	return ErrUnknownUser
+}
+
+// Organization returns the slug of the organization users are provisioned into.
+func (p *oidcProvider) Organization() string { return p.cfg.Organization }
+
+// AuthCodeURL returns the authorization endpoint of the issuer with an authorization
+// request for the code flow with PKCE.
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	for k, v := range p.authParams {
+		params[k] = v
+	}
+	return redirectWithParams(meta.AuthorizationEndpoint, params), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint, verifies the id_token
+// and returns the provisioned or linked IAM user.
+func (p *oidcProvider) Exchange(c fiber.Ctx, code, codeVerifier, nonce string) (db.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	rawIDToken, err := p.redeemCode(ctx, code, codeVerifier)
+	if err != nil {
+		log.Printf("%s: %v", p.name, err)
+		if errors.Is(err, errCodeRejected) {
+			return db.User{}, fiber.NewError(fiber.StatusBadRequest, "invalid authorization code")
+		}
+		return db.User{}, fiber.NewError(fiber.StatusBadGateway, "identity provider is unavailable")
+	}
+
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		log.Printf("%s: invalid id_token: %v", p.name, err)
+		return db.User{}, fiber.NewError(fiber.StatusUnauthorized, "invalid id_token")
+	}
+
+	var org db.Organization
+	if err := p.a.iamDB.Where("slug = ?", p.cfg.Organization).First(&org).Error; err != nil {
+		log.Printf("%s: organization %q: %v", p.name, p.cfg.Organization, err)
+		return db.User{}, fiber.NewError(fiber.StatusInternalServerError, "failed to load organization")
+	}
+
+	user, err := p.provision(org.ID, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errForeignAccount):
+			user.Username, user.OrganizationID = stringClaim(claims, p.cfg.UsernameClaim), org.ID
+			p.a.storeLoginActivity(c, user, "provider_mismatch")
+			return db.User{}, fiber.NewError(fiber.StatusConflict, "an account with this username already exists")
+		case errors.Is(err, errNoEmail):
+			return db.User{}, fiber.NewError(fiber.StatusForbidden, "identity provider returned no email address")
+		case strings.Contains(strings.ToUpper(err.Error()), "UNIQUE"):
+			return db.User{}, fiber.NewError(fiber.StatusConflict, "an account with this email already exists")
+		}
+		log.Printf("%s: provisioning %v failed: %v", p.name, claims["sub"], err)
+		return db.User{}, fiber.NewError(fiber.StatusInternalServerError, "failed to provision user")
+	}
+
+	if err := p.a.checkLoginAllowed(c, user); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// redeemCode exchanges an authorization code for tokens and returns the id_token.
+func (p *oidcProvider) redeemCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return "", fmt.Errorf("token endpoint: %w", err)
+	}
+	if tokens.Error == "invalid_grant" {
+		return "", fmt.Errorf("%w: %s", errCodeRejected, tokens.ErrorDescription)
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token endpoint: %d %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an id_token
+// and returns its claims.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.verificationKey(ctx, kid)
+	},
+		jwt.WithValidMethods(upstreamSigningMethods),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	// With several audiences, the token must have been issued to this client
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("azp mismatch")
+		}
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("sub is missing")
+	}
+	return claims, nil
+}
+
+// provision finds the IAM user of the upstream account, by a linked identity or else a
+// user of the organization with the same verified email, or creates one. Profiles and
+// mapped group and role memberships of users created by this provider are synchronized
+// from the claims; linked users managed elsewhere keep theirs.
+func (p *oidcProvider) provision(orgID uint, claims jwt.MapClaims) (db.User, error) {
+	sub, _ := claims["sub"].(string)
+	email := stringClaim(claims, p.cfg.EmailClaim)
+	emailVerified := email != "" && (p.cfg.TrustEmail || boolClaim(claims, "email_verified"))
+
+	var user db.User
+	err := db.PolicyTransaction(p.a.iamDB, func(tx *gorm.DB) error {
+		found, err := p.linkedUser(tx, orgID, sub, email, emailVerified, &user)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !found:
+			if email == "" {
+				return errNoEmail
+			}
+			username := stringClaim(claims, p.cfg.UsernameClaim)
+			if username == "" {
+				username = email
+			}
+			var taken int64
+			if err := tx.Model(&db.User{}).Where("username = ? AND organization_id = ?", username, orgID).
+				Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return errForeignAccount
+			}
+
+			user = db.User{
+				Username:       username,
+				Email:          email,
+				EmailVerified:  emailVerified,
+				FirstName:      stringClaim(claims, "given_name"),
+				LastName:       stringClaim(claims, "family_name"),
+				IsActive:       true,
+				OrganizationID: orgID,
+				AuthProvider:   p.name,
+				ExternalID:     sub,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&db.FederatedIdentity{UserID: user.ID, Provider: p.name, Subject: sub, Email: email}).Error; err != nil {
+				return err
+			}
+
+			var selfManage db.Policy
+			if err := tx.Where("slug = ? AND organization_id = ?", "self-manage", orgID).
+				First(&selfManage).Error; err == nil {
+				if err := tx.Model(&user).Association("Policies").Append(&selfManage); err != nil {
+					return err
+				}
+			}
+		case user.AuthProvider == p.name && email != "":
+			if err := tx.Model(&user).Updates(map[string]any{
+				"email":          email,
+				"email_verified": emailVerified,
+				"first_name":     stringClaim(claims, "given_name"),
+				"last_name":      stringClaim(claims, "family_name"),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// Only accounts created by this provider are managed by it
+		if user.AuthProvider != p.name {
+			return nil
+		}
+		groups := stringsClaim(claims, p.cfg.GroupsClaim)
+		mapped := make([]mappedMembership, 0, len(p.cfg.GroupMappings))
+		for _, m := range p.cfg.GroupMappings {
+			mapped = append(mapped, mappedMembership{
+				Groups: m.Groups,
+				Roles:  m.Roles,
+				Member: slices.Contains(groups, m.Group),
+			})
+		}
+		return syncMappedMemberships(tx, &user, mapped)
+	})
+	if err != nil {
+		return user, err
+	}
+
+	// Reload with the backup codes needed for the second factor
+	err = p.a.iamDB.Preload("BackupCodes").First(&user, user.ID).Error
+	return user, err
+}
+
+// linkedUser loads into user the IAM user linked to the upstream subject. Without a
+// link, a user of the organization with the same email is linked if both addresses
+// are verified and the user is a local one or of this provider; users of other
+// providers only with linkOtherProviders. It reports whether a user was found.
+func (p *oidcProvider) linkedUser(tx *gorm.DB, orgID uint, sub, email string, emailVerified bool, user *db.User) (bool, error) {
+	var identity db.FederatedIdentity
+	err := tx.Where("provider = ? AND subject = ?", p.name, sub).First(&identity).Error
+	switch {
+	case err == nil:
+		err := tx.Where("id = ? AND organization_id = ?", identity.UserID, orgID).First(user).Error
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		// The linked user was deleted; link the account anew
+		if err := tx.Unscoped().Delete(&identity).Error; err != nil {
+			return false, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return false, err
+	}
+
+	if !emailVerified {
+		return false, nil
+	}
+	query := tx.Where("email = ? AND organization_id = ? AND email_verified = ?", email, orgID, true)
+	if !p.cfg.LinkOtherProviders {
+		query = query.Where("auth_provider IN ?", []string{"", p.name})
+	}
+	err = query.First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Create(&db.FederatedIdentity{UserID: user.ID, Provider: p.name, Subject: sub, Email: email}).Error
+}
+
+// metadata returns the discovery document of the issuer, fetching it on first use.
+func (p *oidcProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta oidcMetadata
+	status, err := p.doJSON(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: status %d", status)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: endpoints are missing")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// verificationKey returns the issuer's key with the given kid. The key set is fetched
+// again for unknown kids, e.g. after a key rotation, at most once a minute.
+func (p *oidcProvider) verificationKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set keys.JWKS
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jwks: status %d", status)
+	}
+
+	p.keys = map[string]crypto.PublicKey{}
+	p.keysFetched = time.Now()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue // keys of unsupported types are skipped
+		}
+		p.keys[jwk.KID] = key
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Issuers with a single key may omit the kid
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// doJSON sends req and decodes a JSON response body of at most 1 MiB into v.
+func (p *oidcProvider) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// stringClaim returns a string claim, or "" if it is missing or not a string.
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// boolClaim returns a boolean claim; some issuers send booleans as strings.
+func boolClaim(claims jwt.MapClaims, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// stringsClaim returns a claim holding a list of strings, or a single string, as a slice.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
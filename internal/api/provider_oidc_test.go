@@ -0,0 +1,430 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
+)
+
+const oidcTestClientID = "goiam-test-client"
+
+// oidcTestIssuer is a local OpenID Connect issuer serving discovery, its key set and
+// a token endpoint that returns the id_token registered for an authorization code.
+type oidcTestIssuer struct {
+	*httptest.Server
+	key *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	tokens map[string]string // id_token by authorization code
+}
+
+func newOIDCTestIssuer(t *testing.T) *oidcTestIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &oidcTestIssuer{key: key, tokens: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss.URL,
+			"authorization_endpoint": iss.URL + "/authorize",
+			"token_endpoint":         iss.URL + "/token",
+			"jwks_uri":               iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys.JWKS{Keys: []keys.JWK{{
+			KTY: "EC",
+			KID: "test-key",
+			Use: "sig",
+			Alg: "ES256",
+			CRV: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		iss.mu.Lock()
+		token, ok := iss.tokens[r.PostForm.Get("code")]
+		delete(iss.tokens, r.PostForm.Get("code"))
+		iss.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok || r.PostForm.Get("client_id") != oidcTestClientID || r.PostForm.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "upstream", "token_type": "Bearer", "id_token": token})
+	})
+
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// config returns the auth_providers entry of an "oidc" provider using this issuer.
+func (iss *oidcTestIssuer) config() string {
+	return "  - name: oidc\n" +
+		"    config:\n" +
+		"      issuer: " + iss.URL + "\n" +
+		"      clientId: " + oidcTestClientID + "\n" +
+		"      clientSecret: upstream-secret\n" +
+		"      redirectUrl: http://localhost/auth/federation/oidc/callback\n" +
+		"      organization: acme\n"
+}
+
+// claims returns valid id_token claims for the subject, bound to nonce.
+func (iss *oidcTestIssuer) claims(sub, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   iss.URL,
+		"aud":   oidcTestClientID,
+		"sub":   sub,
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+}
+
+// issue signs the claims with key and returns an authorization code redeeming them.
+func (iss *oidcTestIssuer) issue(t *testing.T, claims jwt.MapClaims, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.tokens[code] = signed
+	iss.mu.Unlock()
+	return code
+}
+
+// federatedLogin is a login started at /auth/federation/oidc/start: the state cookie
+// set by goIAM and the parameters of the authorization request sent to the issuer.
+type federatedLogin struct {
+	cookie *http.Cookie
+	params url.Values
+}
+
+// startFederatedLogin starts a login and follows it to the issuer's authorization endpoint.
+func startFederatedLogin(t *testing.T, app *fiber.App, iss *oidcTestIssuer) federatedLogin {
+	t.Helper()
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/auth/federation/oidc/start", nil), fiber.TestConfig{Timeout: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("start: %d %s", res.StatusCode, body)
+	}
+
+	target, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Scheme+"://"+target.Host+target.Path != iss.URL+"/authorize" {
+		t.Fatalf("start redirected to %s, want the issuer's authorization endpoint", target)
+	}
+	var login federatedLogin
+	login.params = target.Query()
+	for _, c := range res.Cookies() {
+		if c.Name == federationCookie {
+			login.cookie = c
+		}
+	}
+	if login.cookie == nil {
+		t.Fatal("start set no state cookie")
+	}
+	return login
+}
+
+// callback returns to goIAM's callback with the code and state, sending cookie if not nil.
+func (l federatedLogin) callback(t *testing.T, app *fiber.App, code, state string, cookie *http.Cookie) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/federation/oidc/callback?"+
+		url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return sendRequest(t, app, req)
+}
+
+// finish completes the login with an id_token of the given claims.
+func (l federatedLogin) finish(t *testing.T, app *fiber.App, iss *oidcTestIssuer, claims jwt.MapClaims) (int, map[string]any) {
+	t.Helper()
+	return l.callback(t, app, iss.issue(t, claims, iss.key), l.params.Get("state"), l.cookie)
+}
+
+// newOIDCTestAPI starts an API with a local and an "oidc" provider and the organization "acme".
+func newOIDCTestAPI(t *testing.T) (*API, *fiber.App, *oidcTestIssuer) {
+	t.Helper()
+
+	iss := newOIDCTestIssuer(t)
+	a, app := newTestAPI(t, "auth_providers:\n  - name: local\n"+iss.config())
+	registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	return a, app, iss
+}
+
+func TestOIDCRejectsInvalidIDTokens(t *testing.T) {
+	a, app, iss := newOIDCTestAPI(t)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(claims jwt.MapClaims)
+		key    *ecdsa.PrivateKey
+	}{
+		{"signature", func(jwt.MapClaims) {}, otherKey},
+		{"issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, iss.key},
+		{"audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, iss.key},
+		{"nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed-nonce" }, iss.key},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, iss.key},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, iss.key},
+	}
+	for _, tt := range tests {
+		login := startFederatedLogin(t, app, iss)
+		claims := iss.claims("sub-"+tt.name, login.params.Get("nonce"))
+		claims["email"], claims["email_verified"] = "mallory@example.com", true
+		tt.mutate(claims)
+
+		code := iss.issue(t, claims, tt.key)
+		if status, res := login.callback(t, app, code, login.params.Get("state"), login.cookie); status != http.StatusUnauthorized {
+			t.Errorf("%s: got %d %v, want 401", tt.name, status, res)
+		}
+	}
+
+	var count int64
+	a.iamDB.Model(&db.User{}).Where("email = ?", "mallory@example.com").Count(&count)
+	if count != 0 {
+		t.Errorf("%d users were provisioned from rejected id_tokens", count)
+	}
+}
+
+func TestOIDCProvisionsUserJustInTime(t *testing.T) {
+	a, app, iss := newOIDCTestAPI(t)
+
+	login := startFederatedLogin(t, app, iss)
+	if login.params.Get("client_id") != oidcTestClientID || login.params.Get("code_challenge_method") != "S256" ||
+		login.params.Get("nonce") == "" || login.params.Get("code_challenge") == "" {
+		t.Fatalf("authorization request: %v", login.params)
+	}
+
+	claims := iss.claims("upstream-1", login.params.Get("nonce"))
+	claims["preferred_username"] = "dana"
+	claims["email"], claims["email_verified"] = "dana@example.com", true
+	claims["given_name"], claims["family_name"] = "Dana", "Scully"
+	status, res := login.finish(t, app, iss, claims)
+	if status != http.StatusOK || res["token"] == nil {
+		t.Fatalf("callback: %d %v", status, res)
+	}
+
+	var user db.User
+	if err := a.iamDB.Preload("Policies").Where("username = ?", "dana").First(&user).Error; err != nil {
+		t.Fatalf("provisioned user: %v", err)
+	}
+	if user.AuthProvider != "oidc" || user.ExternalID != "upstream-1" || user.Email != "dana@example.com" ||
+		!user.EmailVerified || user.FirstName != "Dana" || user.LastName != "Scully" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+	if !slices.ContainsFunc(user.Policies, func(p db.Policy) bool { return p.Slug == "self-manage" }) {
+		t.Errorf("provisioned user has no SelfManage policy: %v", user.Policies)
+	}
+
+	// The next login finds the user by the linked identity, even with a changed email
+	login = startFederatedLogin(t, app, iss)
+	claims = iss.claims("upstream-1", login.params.Get("nonce"))
+	claims["preferred_username"] = "dana"
+	claims["email"], claims["email_verified"] = "dana@fbi.example.com", true
+	if status, res := login.finish(t, app, iss, claims); status != http.StatusOK {
+		t.Fatalf("second login: %d %v", status, res)
+	}
+	var users []db.User
+	a.iamDB.Where("auth_provider = ?", "oidc").Find(&users)
+	if len(users) != 1 || users[0].ID != user.ID || users[0].Email != "dana@fbi.example.com" {
+		t.Errorf("users after second login = %+v", users)
+	}
+}
+
+func TestOIDCLinksExistingUserByVerifiedEmail(t *testing.T) {
+	a, app, iss := newOIDCTestAPI(t)
+
+	var org db.Organization
+	a.iamDB.Where("slug = ?", "acme").First(&org)
+	hash, err := auth.HashPassword("Secret123x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := db.User{Username: "erin", Email: "erin@acme.test", EmailVerified: true, PasswordHash: hash, IsActive: true, OrganizationID: org.ID}
+	unverified := db.User{Username: "frank", Email: "frank@acme.test", PasswordHash: hash, IsActive: true, OrganizationID: org.ID}
+	for _, u := range []*db.User{&verified, &unverified} {
+		if err := a.iamDB.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	identities := func(userID uint) int64 {
+		var n int64
+		a.iamDB.Model(&db.FederatedIdentity{}).Where("user_id = ?", userID).Count(&n)
+		return n
+	}
+
+	// Both addresses verified: the upstream account is linked to the existing user
+	login := startFederatedLogin(t, app, iss)
+	claims := iss.claims("upstream-erin", login.params.Get("nonce"))
+	claims["preferred_username"] = "erin.upstream"
+	claims["email"], claims["email_verified"] = "erin@acme.test", true
+	if status, res := login.finish(t, app, iss, claims); status != http.StatusOK {
+		t.Fatalf("login with a verified email: %d %v", status, res)
+	}
+	if identities(verified.ID) != 1 {
+		t.Errorf("the upstream account was not linked to %s", verified.Username)
+	}
+	var count int64
+	a.iamDB.Model(&db.User{}).Where("username = ?", "erin.upstream").Count(&count)
+	if count != 0 {
+		t.Errorf("a second user was created instead of linking")
+	}
+
+	// An unverified upstream email must not take over the account
+	login = startFederatedLogin(t, app, iss)
+	claims = iss.claims("upstream-mallory", login.params.Get("nonce"))
+	claims["preferred_username"] = "mallory"
+	claims["email"], claims["email_verified"] = "erin@acme.test", false
+	if status, res := login.finish(t, app, iss, claims); status != http.StatusConflict {
+		t.Errorf("login with an unverified email: got %d %v, want 409", status, res)
+	}
+	if identities(verified.ID) != 1 {
+		t.Errorf("an account with an unverified email was linked to %s", verified.Username)
+	}
+
+	// Nor may a verified upstream email take over a user whose own email is unverified
+	login = startFederatedLogin(t, app, iss)
+	claims = iss.claims("upstream-frank", login.params.Get("nonce"))
+	claims["preferred_username"] = "frank.upstream"
+	claims["email"], claims["email_verified"] = "frank@acme.test", true
+	if status, res := login.finish(t, app, iss, claims); status != http.StatusConflict {
+		t.Errorf("login for a user with an unverified email: got %d %v, want 409", status, res)
+	}
+	if identities(unverified.ID) != 0 {
+		t.Errorf("the upstream account was linked to %s, whose email is unverified", unverified.Username)
+	}
+}
+
+func TestOIDCLinksOnlyLocalAndOwnUsers(t *testing.T) {
+	tests := []struct {
+		name               string
+		linkOtherProviders bool
+		wantLDAPLinked     bool
+	}{
+		{"default", false, false},
+		{"linkOtherProviders", true, true},
+	}
+	for _, tt := range tests {
+		iss := newOIDCTestIssuer(t)
+		config := iss.config() + "      groupMappings:\n        - group: admins\n          groups: [ops]\n"
+		if tt.linkOtherProviders {
+			config += "      linkOtherProviders: true\n"
+		}
+		a, app := newTestAPI(t, "auth_providers:\n  - name: local\n"+config)
+		admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+		if status, res := doJSON(t, app, http.MethodPost, "/s/groups", map[string]any{"name": "Ops"}, admin); status != http.StatusCreated {
+			t.Fatalf("%s: create group: %d %v", tt.name, status, res)
+		}
+
+		var org db.Organization
+		a.iamDB.Where("slug = ?", "acme").First(&org)
+		local := db.User{Username: "erin", Email: "erin@acme.test", EmailVerified: true, PasswordHash: "x", IsActive: true, OrganizationID: org.ID}
+		ldapUser := db.User{Username: "lena", Email: "lena@acme.test", EmailVerified: true, PasswordHash: "x", IsActive: true,
+			OrganizationID: org.ID, AuthProvider: "ldap", ExternalID: "uid=lena,dc=example,dc=org"}
+		for _, u := range []*db.User{&local, &ldapUser} {
+			if err := a.iamDB.Create(u).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Every upstream account is in the mapped group "admins"
+		loginAs := func(sub, email string) int {
+			login := startFederatedLogin(t, app, iss)
+			claims := iss.claims(sub, login.params.Get("nonce"))
+			claims["email"], claims["email_verified"] = email, true
+			claims["groups"] = []string{"admins"}
+			status, _ := login.finish(t, app, iss, claims)
+			return status
+		}
+		linked := func(u db.User) bool {
+			var n int64
+			a.iamDB.Model(&db.FederatedIdentity{}).Where("user_id = ?", u.ID).Count(&n)
+			return n > 0
+		}
+		inOps := func(u db.User) bool {
+			var groups []db.Group
+			a.iamDB.Model(&u).Association("Groups").Find(&groups)
+			return slices.ContainsFunc(groups, func(g db.Group) bool { return g.Slug == "ops" })
+		}
+
+		// Local users are linked, but their memberships stay managed in goIAM
+		if status := loginAs("upstream-erin", local.Email); status != http.StatusOK || !linked(local) {
+			t.Errorf("%s: local user: got %d, linked %v", tt.name, status, linked(local))
+		}
+		if inOps(local) {
+			t.Errorf("%s: mapped group was synchronized onto the linked local user", tt.name)
+		}
+
+		// Users of other providers only with linkOtherProviders
+		status := loginAs("upstream-lena", ldapUser.Email)
+		if linked(ldapUser) != tt.wantLDAPLinked {
+			t.Errorf("%s: ldap user: got %d, linked %v, want %v", tt.name, status, linked(ldapUser), tt.wantLDAPLinked)
+		}
+		if !tt.wantLDAPLinked && status != http.StatusConflict {
+			t.Errorf("%s: ldap user: got %d, want 409", tt.name, status)
+		}
+		if inOps(ldapUser) {
+			t.Errorf("%s: mapped group was synchronized onto the ldap user", tt.name)
+		}
+
+		// Users created by the provider get the mapped memberships
+		if status := loginAs("upstream-dana", "dana@example.com"); status != http.StatusOK {
+			t.Fatalf("%s: new user: %d", tt.name, status)
+		}
+		var dana db.User
+		a.iamDB.Where("email = ?", "dana@example.com").First(&dana)
+		if !inOps(dana) {
+			t.Errorf("%s: provisioned user is not in the mapped group", tt.name)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// mappedMembership grants goIAM groups and roles to members of an external group.
+type mappedMembership struct {
+	Groups []string // slugs of goIAM groups
+	Roles  []string // slugs of goIAM roles
+	Member bool     // whether the user is a member of the external group
+}
+
+// syncMappedMemberships adds the groups and roles of mappings the user is a member of
+// and removes mapped ones the user no longer qualifies for. Unmapped memberships, e.g.
+// assigned by an administrator, are left unchanged. External providers call it on
+// every login.
+func syncMappedMemberships(tx *gorm.DB, user *db.User, mappings []mappedMembership) error {
+	var mappedGroups, mappedRoles []string
+	wantGroups, wantRoles := map[string]bool{}, map[string]bool{}
+	for _, m := range mappings {
+		for _, slug := range m.Groups {
+			mappedGroups = append(mappedGroups, slug)
+			wantGroups[slug] = wantGroups[slug] || m.Member
+		}
+		for _, slug := range m.Roles {
+			mappedRoles = append(mappedRoles, slug)
+			wantRoles[slug] = wantRoles[slug] || m.Member
+		}
+	}
+
+	if len(mappedGroups) > 0 {
+		var groups []db.Group
+		if err := tx.Where("slug IN ? AND organization_id = ?", mappedGroups, user.OrganizationID).
+			Find(&groups).Error; err != nil {
+			return err
+		}
+		var add, remove []db.Group
+		for _, g := range groups {
+			if wantGroups[g.Slug] {
+				add = append(add, g)
+			} else {
+				remove = append(remove, g)
+			}
+		}
+		if err := syncAssociation(tx, user, "Groups", add, remove); err != nil {
+			return err
+		}
+	}
+
+	if len(mappedRoles) > 0 {
+		var roles []db.Role
+		if err := tx.Where("slug IN ? AND organization_id = ?", mappedRoles, user.OrganizationID).
+			Find(&roles).Error; err != nil {
+			return err
+		}
+		var add, remove []db.Role
+		for _, r := range roles {
+			if wantRoles[r.Slug] {
+				add = append(add, r)
+			} else {
+				remove = append(remove, r)
+			}
+		}
+		if err := syncAssociation(tx, user, "Roles", add, remove); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncAssociation appends add to and deletes remove from a many-to-many association of user.
+func syncAssociation[T any](tx *gorm.DB, user *db.User, name string, add, remove []T) error {
+	if len(add) > 0 {
+		if err := tx.Model(user).Association(name).Append(add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err := tx.Model(user).Association(name).Delete(remove); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,10 +13,8 @@ import (
 
 // handleRegisterInput represents the expected JSON structure for registration.
 //
-// A user may either:
-//   - provide an existing organization_id
-//   - or leave it blank and supply an optional organization_name and/or slug,
-//     in which case a new organization will be created.
+// Registration always creates a new organization from the optional organization_name
+// and organization_slug. Existing organizations are joined by accepting an invitation.
 type handleRegisterInput struct {
 	Username         string `json:"username"`          // required
 	Password         string `json:"password"`          // required, validated by regex
@@ -26,8 +24,8 @@ type handleRegisterInput struct {
 	MiddleName       string `json:"middle_name"`       // optional
 	LastName         string `json:"last_name"`         // optional
 	Address          string `json:"address"`           // optional
-	OrganizationID   uint   `json:"organization_id"`   // optional, use default if not set
-	OrganizationName string `json:"organization_name"` // optional: name of new org if org_id not provided
+	OrganizationID   uint   `json:"organization_id"`   // rejected, use an invitation to join an existing org
+	OrganizationName string `json:"organization_name"` // optional: name of the new org
 	OrganizationSlug string `json:"organization_slug"` // optional: custom slug (generated from name if not given)
 }
 
@@ -35,7 +33,7 @@ type handleRegisterInput struct {
 //
 // This function:
 //   - Validates user input (username, password, email format, etc.)
-//   - Verifies that a valid OrganizationID is provided or creates a new organization if not
+//   - Creates a new organization; joining an existing one requires an invitation
 //   - Hashes the password securely
 //   - Stores the user in the database
 //
@@ -52,32 +50,38 @@ func (a *API) handleRegisterLocal(c fiber.Ctx) error {
 		return err
 	}
 
-	var org db.Organization
+	// Existing organizations are joined through invitations only
+	if body.OrganizationID != 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "joining an existing organization requires an invitation")
+	}
 
-	// Create new organization always
-	orgName := body.OrganizationName
+	// Create a new organization
+	orgName := strings.TrimSpace(body.OrganizationName)
 	if orgName == "" {
 		suffix := uuid.New().String()[:8]
 		orgName = "goIAM Organization " + suffix
 	}
-	orgSlug := strings.ToLower(strings.ReplaceAll(orgName, " ", "-"))
+	orgSlug, err := validSlug(body.OrganizationSlug, orgName)
+	if err != nil {
+		return err
+	}
 
-	// Ensure slug is unique
+	// Ensure a generated slug is unique; a custom slug must be free
 	var existing db.Organization
 	if err := a.iamDB.Where("slug = ?", orgSlug).First(&existing).Error; err == nil {
+		if body.OrganizationSlug != "" {
+			return fiber.NewError(fiber.StatusConflict, "organization slug already exists")
+		}
 		orgSlug = orgSlug + "-" + uuid.New().String()[:4]
 	}
 
-	org = db.Organization{
+	org := db.Organization{
 		Name:        orgName,
 		Slug:        orgSlug,
 		Description: "Created automatically during registration",
 	}
 	if err := a.iamDB.Create(&org).Error; err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed: organizations.name") {
-			return fiber.NewError(fiber.StatusConflict, "organization name already exists")
-		}
-		return fiber.NewError(fiber.StatusInternalServerError, "failed to create organization")
+		return organizationError(err, "failed to create organization")
 	}
 
 	// Seed default policies into the new organization
@@ -131,6 +135,9 @@ func (a *API) handleRegisterLocal(c fiber.Ctx) error {
 		}
 	}
 
+	// ask the user to verify the email address
+	a.sendActivationEmailAsync(user, false)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "user registered"})
 }
 
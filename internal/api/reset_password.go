@@ -1,52 +1,107 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/google/uuid"
-	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/auth"
 	"github.com/javadmohebbi/goIAM/internal/db"
 	"github.com/javadmohebbi/goIAM/internal/smtpclient"
+	"gorm.io/gorm"
 )
 
-// handleResetPasswordRequestLocal send the instruction to user to reset his password
-func (a *API) handleResetPasswordRequestLocal(c fiber.Ctx) error {
-	type req struct {
-		Username string `json:"username"` // required
-		Email    string `json:"email"`    // required
+// resetPasswordRequestedMessage is returned for every reset request, whether or not
+// an account matched, so the endpoint cannot be used to enumerate accounts.
+const resetPasswordRequestedMessage = "If the account exists, you will receive an email with instructions to reset your password"
+
+// requestPasswordResetLocal sends password reset instructions to the active local
+// accounts matching username or, if empty, email. It returns ErrUnknownUser if none matched.
+//
+// Emails are sent in the background so the response time does not reveal whether an
+// account matched either.
+func (a *API) requestPasswordResetLocal(c fiber.Ctx, username, email string) error {
+	// Usernames and emails are unique per organization only, so every matching
+	// account (of the tenant, on a tenant host) gets its own reset email
+	var users []db.User
+	query := scopeToTenant(c, a.iamDB).Where("is_active = ? AND email <> ? AND auth_provider = ?", true, "", "")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	} else {
+		query = query.Where("email = ?", email)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return ErrUnknownUser
 	}
 
-	var body req
+	for _, user := range users {
+		go func(u db.User) {
+			if err := a.sendResetPasswordEmail(u); err != nil {
+				log.Printf("failed to send password reset email to user %d: %v", u.ID, err)
+			}
+		}(user)
+	}
+	return nil
+}
+
+// handleResetPasswordConfirm sets a new password using a token from a reset email.
+//
+// The token is single-use. On success, every other outstanding reset token of the
+// user is invalidated and all sessions are revoked, so the user has to log in again.
+func (a *API) handleResetPasswordConfirm(c fiber.Ctx) error {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
 	if err := c.Bind().Body(&body); err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
 	}
+	if body.Token == "" || body.Password == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "token and password are required")
+	}
+	if !a.validation.ValidatePassword(body.Password) {
+		return fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("password must be at least %d characters and match the password rules", a.cfg.Validation.PasswordMinLength))
+	}
 
-	var user db.User
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to hash password")
+	}
 
-	// if username is provided
-	if body.Username != "" {
-		if err := a.iamDB.Model(&db.User{}).Where("username = ?", body.Username).First(&user); err != nil {
-			// log error
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		prt, err := db.ConsumePasswordResetToken(tx, auth.HashToken(strings.TrimSpace(body.Token)))
+		if err != nil {
+			return err
 		}
 
-		return sendResetPasswordEmail(user, a.cfg)
-	}
-
-	// if email provided
-	if body.Email != "" {
-		if err := a.iamDB.Model(&db.User{}).Where("email = ?", body.Email).First(&user); err != nil {
-			// log error
+		var user db.User
+		if err := tx.Where("id = ? AND is_active = ?", prt.UserID, true).First(&user).Error; err != nil {
+			return err
+		}
+		if err := user.UpdatePasswordHash(tx, hash); err != nil {
+			return err
 		}
-		return sendResetPasswordEmail(user, a.cfg)
+		if err := db.InvalidatePasswordResetTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return db.RevokeAllUserTokens(tx, user.ID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid or expired token")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reset password")
 	}
 
-	// anyway, we will show a message to user
-	// that if the provided info is correct,
-	// you will recieve an email to reset your password
-	return nil
+	return c.JSON(fiber.Map{"message": "password has been reset"})
 }
 
 // sendResetPasswordEmail generates a password reset token, populates an email template
@@ -54,34 +109,43 @@ func (a *API) handleResetPasswordRequestLocal(c fiber.Ctx) error {
 //
 // Parameters:
 //   - u: the user who requested password reset
-//   - cfg: application configuration including SMTP settings
 //
 // Behavior:
 //   - Uses the user's FirstName if available, otherwise falls back to Username
-//   - Generates a UUID token (should be stored for later validation — TODO)
+//   - Stores the hash of a random single-use token that expires after token.password_reset_ttl
 //   - Replaces placeholders in the HTML template and sends the email
-func sendResetPasswordEmail(u db.User, cfg *config.Config) error {
+func (a *API) sendResetPasswordEmail(u db.User) error {
 	// Choose the name to personalize the email
 	_name := u.Username
 	if u.FirstName != "" {
 		_name = u.FirstName
 	}
 
-	// Generate a unique reset token (should be stored with expiration — TODO)
-	token := uuid.New().String()
+	// Generate a unique reset token; only its hash is stored
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := a.iamDB.Create(&db.PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(a.cfg.Token.PasswordResetTTL),
+	}).Error; err != nil {
+		return err
+	}
 
 	// Prepare template placeholders
 	placeholders := map[string]string{
 		"Name":    _name,
-		"AppName": cfg.AppName,
+		"AppName": a.cfg.AppName,
 		"Year":    fmt.Sprintf("%d", time.Now().Year()),
 		"Token":   token,
 	}
 
 	// reset password template
-	tmplt := filepath.Join(cfg.SMTP.TemplateDir, "reset-password.html")
+	tmplt := filepath.Join(a.cfg.SMTP.TemplateDir, "reset-password.html")
 
 	// Send the reset password email using HTML template
-	return smtpclient.SendEmailFromHTMLTemplate(cfg, "Reset Your Password",
+	return smtpclient.SendEmailFromHTMLTemplate(a.cfg, "Reset Your Password",
 		[]string{u.Email}, tmplt, placeholders)
 }
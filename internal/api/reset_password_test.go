@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+// createPasswordResetToken stores a reset token of the user expiring after ttl, as the
+// reset email does, and returns the plain token.
+func createPasswordResetToken(t *testing.T, a *API, userID uint, ttl time.Duration) string {
+	t.Helper()
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.iamDB.Create(&db.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestResetPasswordConfirm(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	var root db.User
+	if err := a.iamDB.Where("username = ?", "root").First(&root).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		used       bool
+		token      string // sent instead of the stored token if set
+		password   string
+		wantStatus int
+	}{
+		{"missing password", time.Hour, false, "", "", http.StatusBadRequest},
+		{"weak password", time.Hour, false, "", "short", http.StatusBadRequest},
+		{"unknown token", time.Hour, false, "not-a-token", "NewSecret456y", http.StatusBadRequest},
+		{"expired token", -time.Minute, false, "", "NewSecret456y", http.StatusBadRequest},
+		{"used token", time.Hour, true, "", "NewSecret456y", http.StatusBadRequest},
+		{"valid token", time.Hour, false, "", "NewSecret456y", http.StatusOK},
+	}
+	for _, tt := range tests {
+		token := createPasswordResetToken(t, a, root.ID, tt.ttl)
+		if tt.used {
+			a.iamDB.Model(&db.PasswordResetToken{}).Where("token_hash = ?", auth.HashToken(token)).Update("used_at", time.Now())
+		}
+		if tt.token != "" {
+			token = tt.token
+		}
+
+		status, res := doJSON(t, app, http.MethodPost, "/auth/reset/password/confirm", map[string]any{
+			"token": token, "password": tt.password,
+		}, "")
+		if status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+		}
+	}
+}
+
+func TestResetPasswordConfirmRevokesSessionsAndOtherTokens(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	session := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	var root db.User
+	if err := a.iamDB.Where("username = ?", "root").First(&root).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := createPasswordResetToken(t, a, root.ID, time.Hour)
+	other := createPasswordResetToken(t, a, root.ID, time.Hour)
+
+	status, res := doJSON(t, app, http.MethodPost, "/auth/reset/password/confirm", map[string]any{
+		"token": token, "password": "NewSecret456y",
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("confirm: %d %v", status, res)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       map[string]any
+		token      string
+		wantStatus int
+	}{
+		{"session from before the reset", http.MethodGet, "/s/auth/profile", nil, session, http.StatusUnauthorized},
+		{"same token again", http.MethodPost, "/auth/reset/password/confirm",
+			map[string]any{"token": token, "password": "Other789z"}, "", http.StatusBadRequest},
+		{"other outstanding token", http.MethodPost, "/auth/reset/password/confirm",
+			map[string]any{"token": other, "password": "Other789z"}, "", http.StatusBadRequest},
+		{"login with the old password", http.MethodPost, "/auth/login",
+			map[string]any{"username": "root", "password": "Secret123x", "organization": "acme"}, "", http.StatusUnauthorized},
+		{"login with the new password", http.MethodPost, "/auth/login",
+			map[string]any{"username": "root", "password": "NewSecret456y", "organization": "acme"}, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status, res := doJSON(t, app, tt.method, tt.path, tt.body, tt.token); status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+		}
+	}
+}
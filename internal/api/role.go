@@ -0,0 +1,305 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// handleRoleInput represents the expected JSON structure for creating or updating a role.
+// Empty fields are left unchanged on update; a nil policy list is left unchanged.
+type handleRoleInput struct {
+	Name        string `json:"name"`        // required on create
+	Slug        string `json:"slug"`        // optional, generated from the name if empty
+	Description string `json:"description"` // optional
+	PolicyIDs   []uint `json:"policy_ids"`  // optional, attached policies
+}
+
+// roleView is the JSON representation of a role.
+type roleView struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	PolicyIDs   []uint    `json:"policy_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// newRoleView converts a role with preloaded policies into its JSON representation.
+func newRoleView(r db.Role) roleView {
+	v := roleView{
+		ID:          r.ID,
+		Name:        r.Name,
+		Slug:        r.Slug,
+		Description: r.Description,
+		PolicyIDs:   []uint{},
+		CreatedAt:   r.CreatedAt,
+	}
+	for _, p := range r.Policies {
+		v.PolicyIDs = append(v.PolicyIDs, p.ID)
+	}
+	return v
+}
+
+// handleCreateRole creates a role in the caller's organization.
+func (a *API) handleCreateRole(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handleRoleInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	slug, err := validSlug(body.Slug, body.Name)
+	if err != nil {
+		return err
+	}
+	if err := a.checkAttachAccess(c, nil, body.PolicyIDs, "role:attach_policy", "role:detach_policy", "org:{org_id}:role"); err != nil {
+		return err
+	}
+
+	role := db.Role{
+		Name:           strings.TrimSpace(body.Name),
+		Slug:           slug,
+		Description:    body.Description,
+		OrganizationID: principal.PrincipalOrgID(),
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return replacePolicies(tx, &role, body.PolicyIDs, role.OrganizationID)
+	})
+	if err != nil {
+		return roleError(err, "failed to create role")
+	}
+
+	if err := a.iamDB.Preload("Policies").First(&role, role.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load role")
+	}
+	return c.Status(fiber.StatusCreated).JSON(newRoleView(role))
+}
+
+// handleListRoles lists the roles of the caller's organization, paginated
+// with the page and page_size query parameters.
+func (a *API) handleListRoles(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	query := a.iamDB.Model(&db.Role{}).Where("organization_id = ?", principal.PrincipalOrgID())
+	page, err := paginate(c, query, newRoleView, "Policies")
+	if err != nil {
+		return listError(err, "failed to list roles")
+	}
+	return c.JSON(page)
+}
+
+// handleGetRole returns a role of the caller's organization by ID or slug.
+func (a *API) handleGetRole(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newRoleView(*role))
+}
+
+// handleUpdateRole updates the name, slug, description or policies of a role.
+func (a *API) handleUpdateRole(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+
+	var body handleRoleInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	updates := map[string]any{}
+	if strings.TrimSpace(body.Name) != "" {
+		updates["name"] = strings.TrimSpace(body.Name)
+	}
+	if body.Slug != "" {
+		slug, err := validSlug(body.Slug, "")
+		if err != nil {
+			return err
+		}
+		updates["slug"] = slug
+	}
+	if body.Description != "" {
+		updates["description"] = body.Description
+	}
+	if err := a.checkAttachAccess(c, policyIDs(role.Policies), body.PolicyIDs,
+		"role:attach_policy", "role:detach_policy", "org:{org_id}:role"); err != nil {
+		return err
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(role).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return replacePolicies(tx, role, body.PolicyIDs, role.OrganizationID)
+	})
+	if err != nil {
+		return roleError(err, "failed to update role")
+	}
+
+	if err := a.iamDB.Preload("Policies").First(role, role.ID).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to load role")
+	}
+	return c.JSON(newRoleView(*role))
+}
+
+// handleDeleteRole deletes a role. Users and service accounts assigned to it lose its policies.
+func (a *API) handleDeleteRole(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Users").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(role).Association("Policies").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM service_account_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleListRoleUsers lists the users assigned a role, paginated.
+func (a *API) handleListRoleUsers(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+
+	query := a.iamDB.Model(&db.User{}).
+		Where("id IN (?)", a.iamDB.Table("user_roles").Select("user_id").Where("role_id = ?", role.ID))
+	page, err := paginate(c, query, newMemberView)
+	if err != nil {
+		return listError(err, "failed to list role users")
+	}
+	return c.JSON(page)
+}
+
+// handleAssignRole assigns a role to a user of the same organization.
+func (a *API) handleAssignRole(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+	user, err := a.loadMember(c, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(role).Association("Users").Append(user); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to assign role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleUnassignRole removes a role from a user.
+func (a *API) handleUnassignRole(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+	user, err := a.loadMember(c, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(role).Association("Users").Delete(user); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to unassign role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleAttachRolePolicy attaches a policy of the same organization to a role.
+func (a *API) handleAttachRolePolicy(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+	policy, err := a.loadAttachablePolicy(c, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(role).Association("Policies").Append(policy); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to attach policy")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleDetachRolePolicy detaches a policy from a role.
+func (a *API) handleDetachRolePolicy(c fiber.Ctx) error {
+	role, err := a.loadRole(c)
+	if err != nil {
+		return err
+	}
+	policy, err := a.loadAttachablePolicy(c, role.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Model(role).Association("Policies").Delete(policy); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to detach policy")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadRole loads the role identified by the :role route parameter (an ID or a slug)
+// within the caller's organization, with its policies preloaded.
+func (a *API) loadRole(c fiber.Ctx) (*db.Role, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	var role db.Role
+	if err := whereIDOrSlug(a.iamDB.Preload("Policies"), c.Params("role")).
+		Where("organization_id = ?", principal.PrincipalOrgID()).
+		First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "role not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load role")
+	}
+	return &role, nil
+}
+
+// roleError maps errors from creating or updating a role to HTTP errors.
+func roleError(err error, msg string) error {
+	if errors.Is(err, errForeignAttachment) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+		return fiber.NewError(fiber.StatusConflict, "role name or slug already exists")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
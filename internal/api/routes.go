@@ -13,15 +13,35 @@ import (
 // under the /secure path using RequireAuth middleware. These protected routes include 2FA,
 // profile management, and backup code functionality, registered via registerAuthRoutes().
 func (a *API) registerRoutes(app *fiber.App) {
-	// a.handleLogin and a.handleRegister will internally dispatch to the correct auth method
-	// based on the configured precedence in a.cfg.AuthProviders
-	// Register a unified login and register endpoint
+	// a.handleLogin, a.handleRegister and a.handleResetPasswordRequest dispatch to the
+	// providers configured in a.cfg.AuthProviders, in order (see provider.go)
 	app.Post("/auth/login", a.handleLogin)
 	app.Post("/auth/register", a.handleRegister)
 	app.Post("/auth/reset/password/request", a.handleResetPasswordRequest)
+	app.Post("/auth/reset/password/confirm", a.handleResetPasswordConfirm)
+	app.Post("/auth/activate", a.handleActivate)
+	app.Post("/auth/activate/resend", a.handleResendActivation)
+	app.Post("/auth/invitations/accept", a.handleAcceptInvitation)
+	app.Post("/auth/token/refresh", a.handleRefreshToken)
+
+	// usernameless passkey login (see webauthn.go)
+	app.Post("/auth/webauthn/login/begin", a.handlePasskeyLoginBegin)
+	app.Post("/auth/webauthn/login/finish", a.handlePasskeyLoginFinish)
+
+	// passwordless login with emailed codes and magic links (see passwordless.go)
+	app.Post("/auth/passwordless/request", a.handleEmailLoginRequest)
+	app.Post("/auth/passwordless/code", a.handleEmailLoginCode)
+	app.Post("/auth/passwordless/link", a.handleEmailLoginLink)
+
+	// browser logins at upstream identity providers (see federation.go)
+	app.Get("/auth/federation/:provider/start", a.handleFederationStart)
+	app.Get("/auth/federation/:provider/callback", a.handleFederationCallback)
+
+	// public keys for verifying issued tokens
+	app.Get("/.well-known/jwks.json", a.handleJWKS)
 
 	// token check middleware
-	secure := app.Group("/s", middleware.RequireAuth(a.cfg, a.iamDB))
+	secure := app.Group("/s", middleware.RequireAuth(a.cfg, a.iamDB, a.keys))
 
 	// auth and profile-related routes
 	a.registerAuthRoutes(secure)
@@ -29,67 +49,35 @@ func (a *API) registerRoutes(app *fiber.App) {
 	// register user-related routes
 	userRoutes := secure.Group("/user")
 	a.registerUserRoutes(userRoutes)
-}
 
-// handleLogin attempts login with each configured AuthProvider in order.
-// It tries local, LDAP, etc., in configured order, and returns Unauthorized if all fail.
-func (a *API) handleLogin(c fiber.Ctx) error {
-	for _, provider := range a.cfg.AuthProviders {
-		switch provider.Name {
-		case "local":
-			if err := a.handleLoginLocal(c); err == nil {
-				return nil
-			}
-		case "ldap":
-			// var cfg config.LDAPConfig
-			// Future: implement LDAP login
-		case "auth0":
-			// Future: implement Auth0 login
-		case "entra_id":
-			// Future: implement Entra ID login
-		}
-	}
-	return fiber.ErrUnauthorized
-}
+	// register organization and invitation routes
+	orgRoutes := secure.Group("/org")
+	a.registerOrgRoutes(orgRoutes)
 
-// handleRegister attempts registration with each configured AuthProvider in order.
-// Only local registration is generally supported.
-func (a *API) handleRegister(c fiber.Ctx) error {
-	for _, provider := range a.cfg.AuthProviders {
-		switch provider.Name {
-		case "local":
-			if err := a.handleRegisterLocal(c); err == nil {
-				return nil
-			}
-		case "ldap":
-			// var cfg config.LDAPConfig
-			// Future: implement LDAP login
-		case "auth0":
-			// Future: implement Auth0 login
-		case "entra_id":
-			// Future: implement Entra ID login
-		}
-	}
-	return fiber.ErrUnauthorized
-}
+	// register service account routes
+	serviceAccountRoutes := secure.Group("/service-accounts")
+	a.registerServiceAccountRoutes(serviceAccountRoutes)
+
+	// register group routes
+	groupRoutes := secure.Group("/groups")
+	a.registerGroupRoutes(groupRoutes)
+
+	// register role routes
+	roleRoutes := secure.Group("/roles")
+	a.registerRoleRoutes(roleRoutes)
+
+	// register authorization decision routes
+	authzRoutes := secure.Group("/authz")
+	a.registerAuthzRoutes(authzRoutes)
+
+	// register policy routes
+	policyRoutes := secure.Group("/policy")
+	a.registerPolicyRoutes(policyRoutes)
+
+	// register policy document routes
+	policyDocumentRoutes := secure.Group("/policies")
+	a.registerPolicyDocumentRoutes(policyDocumentRoutes)
 
-// handleRegister attempts registration with each configured AuthProvider in order.
-// Only local registration is generally supported.
-func (a *API) handleResetPasswordRequest(c fiber.Ctx) error {
-	for _, provider := range a.cfg.AuthProviders {
-		switch provider.Name {
-		case "local":
-			if err := a.handleResetPasswordRequestLocal(c); err == nil {
-				return nil
-			}
-		case "ldap":
-			// var cfg config.LDAPConfig
-			// Future: implement LDAP login
-		case "auth0":
-			// Future: implement Auth0 login
-		case "entra_id":
-			// Future: implement Entra ID login
-		}
-	}
-	return fiber.ErrUnauthorized
+	// OpenID Connect provider and client registration
+	a.registerOAuthRoutes(app, secure)
 }
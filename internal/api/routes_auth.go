@@ -9,30 +9,46 @@ import (
 //
 // These routes are grouped under the /secure prefix and protected by RequireAuth.
 // They also apply fine-grained policy checks using RequireAccess middleware.
-// Includes routes for 2FA management, user profile updates, and backup codes.
+// Includes routes for 2FA management, WebAuthn credentials, logout, user profile updates,
+// and backup codes.
 func (a *API) registerAuthRoutes(secure fiber.Router) {
 	secure.Post("/auth/2fa/setup", a.handle2FASetup())
 	secure.Post("/auth/2fa/verify", a.handle2FAVerify())
 	secure.Post("/auth/2fa/disable", a.handle2FADisable())
 	secure.Post("/auth/backup-codes/regenerate", a.handleBackupCodes())
 
-	secure.Get("/auth/profile",
-		middleware.RequireAccess("read", "org:{org_id}:user:{user_id}", a.cfg),
-		a.handleGetProfile)
+	// WebAuthn as the second factor, with the token of a login requiring 2FA
+	secure.Post("/auth/2fa/webauthn/begin", a.handleWebAuthn2FABegin)
+	secure.Post("/auth/2fa/webauthn/finish", a.handleWebAuthn2FAFinish)
 
-	secure.Patch("/auth/profile",
-		middleware.RequireAccess("update", "org:{org_id}:user:{user_id}", a.cfg),
-		a.handleUpdateProfile)
+	// security keys and passkeys of the caller
+	secure.Get("/auth/webauthn/credentials", a.handleListWebAuthnCredentials,
+		middleware.RequireAccess("user:read", "org:{org_id}:user:{user_id}:webauthn", a.cfg))
 
-	secure.Post("/auth/profile/password",
-		middleware.RequireAccess("update", "org:{org_id}:user:{user_id}:password", a.cfg),
-		a.handleChangePassword)
+	secure.Post("/auth/webauthn/register/begin", a.handleWebAuthnRegisterBegin,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:webauthn", a.cfg))
 
-	secure.Post("/auth/profile/2fa/enable",
-		middleware.RequireAccess("update", "org:{org_id}:user:{user_id}:2fa", a.cfg),
-		a.handleEnable2FA)
+	secure.Post("/auth/webauthn/register/finish", a.handleWebAuthnRegisterFinish,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:webauthn", a.cfg))
 
-	secure.Post("/auth/profile/2fa/disable",
-		middleware.RequireAccess("update", "org:{org_id}:user:{user_id}:2fa", a.cfg),
-		a.handleDisable2FA)
+	secure.Delete("/auth/webauthn/credentials/:id", a.handleDeleteWebAuthnCredential,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:webauthn", a.cfg))
+
+	secure.Post("/auth/logout", a.handleLogout)
+	secure.Post("/auth/logout-all", a.handleLogoutAll)
+
+	secure.Get("/auth/profile", a.handleGetProfile,
+		middleware.RequireAccess("user:read", "org:{org_id}:user:{user_id}", a.cfg))
+
+	secure.Patch("/auth/profile", a.handleUpdateProfile,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}", a.cfg))
+
+	secure.Post("/auth/profile/password", a.handleChangePassword,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:password", a.cfg))
+
+	secure.Post("/auth/profile/2fa/enable", a.handleEnable2FA,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:2fa", a.cfg))
+
+	secure.Post("/auth/profile/2fa/disable", a.handleDisable2FA,
+		middleware.RequireAccess("user:update", "org:{org_id}:user:{user_id}:2fa", a.cfg))
 }
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerAuthzRoutes defines the authorization decision API used by other services.
+func (a *API) registerAuthzRoutes(secure fiber.Router) {
+	secure.Post("/check", a.handleAuthzCheck,
+		middleware.RequireAccess("authz:check", "org:{org_id}:authz", a.cfg))
+	secure.Post("/check/batch", a.handleAuthzCheckBatch,
+		middleware.RequireAccess("authz:check", "org:{org_id}:authz", a.cfg))
+}
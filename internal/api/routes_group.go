@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerGroupRoutes defines routes for managing the groups of the caller's organization,
+// their members and attached policies, guarded by group:* actions.
+// Groups are addressed by ID or slug.
+func (a *API) registerGroupRoutes(secure fiber.Router) {
+	secure.Post("/", a.handleCreateGroup,
+		middleware.RequireAccess("group:create", "org:{org_id}:group", a.cfg))
+	secure.Get("/", a.handleListGroups,
+		middleware.RequireAccess("group:read", "org:{org_id}:group", a.cfg))
+	secure.Get("/:group", a.handleGetGroup,
+		middleware.RequireAccess("group:read", "org:{org_id}:group", a.cfg))
+	secure.Patch("/:group", a.handleUpdateGroup,
+		middleware.RequireAccess("group:update", "org:{org_id}:group", a.cfg))
+	secure.Delete("/:group", a.handleDeleteGroup,
+		middleware.RequireAccess("group:delete", "org:{org_id}:group", a.cfg))
+
+	// Membership
+	secure.Get("/:group/members", a.handleListGroupMembers,
+		middleware.RequireAccess("group:read", "org:{org_id}:group", a.cfg))
+	secure.Put("/:group/members/:user_id", a.handleAddGroupMember,
+		middleware.RequireAccess("group:add_member", "org:{org_id}:group", a.cfg))
+	secure.Delete("/:group/members/:user_id", a.handleRemoveGroupMember,
+		middleware.RequireAccess("group:remove_member", "org:{org_id}:group", a.cfg))
+
+	// Policy attachments
+	secure.Put("/:group/policies/:policy_id", a.handleAttachGroupPolicy,
+		middleware.RequireAccess("group:attach_policy", "org:{org_id}:group", a.cfg))
+	secure.Delete("/:group/policies/:policy_id", a.handleDetachGroupPolicy,
+		middleware.RequireAccess("group:detach_policy", "org:{org_id}:group", a.cfg))
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerOAuthRoutes defines the OpenID Connect provider endpoints.
+//
+// Discovery, authorization, token, introspection and revocation endpoints are
+// public (the latter three authenticate the client); userinfo requires a bearer token,
+// which may be an access token issued to an OAuth client. Client registration lives
+// under the secure group and is guarded by RequireAccess with oauth_client:* actions.
+func (a *API) registerOAuthRoutes(app *fiber.App, secure fiber.Router) {
+	app.Get("/.well-known/openid-configuration", a.handleOpenIDConfiguration)
+
+	app.Get("/oauth2/authorize", a.handleAuthorize)
+	app.Post("/oauth2/authorize", a.handleAuthorizeLogin)
+	app.Post("/oauth2/token", a.handleOAuthToken)
+	app.Post("/oauth2/introspect", a.handleIntrospect)
+	app.Post("/oauth2/revoke", a.handleRevoke)
+
+	requireAuth := middleware.RequireClientAuth(a.cfg, a.iamDB, a.keys)
+	app.Get("/oauth2/userinfo", a.handleUserInfo, requireAuth)
+	app.Post("/oauth2/userinfo", a.handleUserInfo, requireAuth)
+
+	clients := secure.Group("/oauth2/clients")
+	clients.Post("/", a.handleCreateOAuthClient,
+		middleware.RequireAccess("oauth_client:create", "org:{org_id}:oauth_client", a.cfg))
+	clients.Get("/", a.handleListOAuthClients,
+		middleware.RequireAccess("oauth_client:read", "org:{org_id}:oauth_client", a.cfg))
+	clients.Delete("/:client_id", a.handleDeleteOAuthClient,
+		middleware.RequireAccess("oauth_client:delete", "org:{org_id}:oauth_client", a.cfg))
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerOrgRoutes defines routes for managing the caller's organization and its custom
+// domain, guarded by org:* actions, and its invitations, guarded by invitation:* actions.
+func (a *API) registerOrgRoutes(secure fiber.Router) {
+	secure.Get("/", a.handleGetOrganization,
+		middleware.RequireAccess("org:read", "org:{org_id}", a.cfg))
+	secure.Patch("/", a.handleUpdateOrganization,
+		middleware.RequireAccess("org:update", "org:{org_id}", a.cfg))
+
+	// Custom domain
+	secure.Put("/domain", a.handleSetCustomDomain,
+		middleware.RequireAccess("org:update", "org:{org_id}", a.cfg))
+	secure.Post("/domain/verify", a.handleVerifyCustomDomain,
+		middleware.RequireAccess("org:update", "org:{org_id}", a.cfg))
+	secure.Delete("/domain", a.handleDeleteCustomDomain,
+		middleware.RequireAccess("org:update", "org:{org_id}", a.cfg))
+
+	// Invitations
+	secure.Post("/invitations", a.handleCreateInvitation,
+		middleware.RequireAccess("invitation:create", "org:{org_id}:invitation", a.cfg))
+	secure.Get("/invitations", a.handleListInvitations,
+		middleware.RequireAccess("invitation:read", "org:{org_id}:invitation", a.cfg))
+	secure.Delete("/invitations/:id", a.handleRevokeInvitation,
+		middleware.RequireAccess("invitation:delete", "org:{org_id}:invitation", a.cfg))
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerPolicyRoutes defines routes for working with the policies of the caller's organization.
+func (a *API) registerPolicyRoutes(secure fiber.Router) {
+	secure.Post("/simulate", a.handlePolicySimulate,
+		middleware.RequireAccess("policy:simulate", "org:{org_id}:policy", a.cfg))
+}
+
+// registerPolicyDocumentRoutes defines routes for managing the policies of the caller's
+// organization as JSON policy documents, guarded by policy:* actions.
+// Policies are addressed by ID or slug.
+func (a *API) registerPolicyDocumentRoutes(secure fiber.Router) {
+	secure.Post("/", a.handleCreatePolicy,
+		middleware.RequireAccess("policy:create", "org:{org_id}:policy", a.cfg))
+	secure.Get("/", a.handleListPolicies,
+		middleware.RequireAccess("policy:read", "org:{org_id}:policy", a.cfg))
+	secure.Get("/:policy", a.handleGetPolicy,
+		middleware.RequireAccess("policy:read", "org:{org_id}:policy", a.cfg))
+	secure.Patch("/:policy", a.handleUpdatePolicy,
+		middleware.RequireAccess("policy:update", "org:{org_id}:policy", a.cfg))
+	secure.Delete("/:policy", a.handleDeletePolicy,
+		middleware.RequireAccess("policy:delete", "org:{org_id}:policy", a.cfg))
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerRoleRoutes defines routes for managing the roles of the caller's organization,
+// their assignment to users and attached policies, guarded by role:* actions.
+// Roles are addressed by ID or slug.
+func (a *API) registerRoleRoutes(secure fiber.Router) {
+	secure.Post("/", a.handleCreateRole,
+		middleware.RequireAccess("role:create", "org:{org_id}:role", a.cfg))
+	secure.Get("/", a.handleListRoles,
+		middleware.RequireAccess("role:read", "org:{org_id}:role", a.cfg))
+	secure.Get("/:role", a.handleGetRole,
+		middleware.RequireAccess("role:read", "org:{org_id}:role", a.cfg))
+	secure.Patch("/:role", a.handleUpdateRole,
+		middleware.RequireAccess("role:update", "org:{org_id}:role", a.cfg))
+	secure.Delete("/:role", a.handleDeleteRole,
+		middleware.RequireAccess("role:delete", "org:{org_id}:role", a.cfg))
+
+	// Assignment to users
+	secure.Get("/:role/users", a.handleListRoleUsers,
+		middleware.RequireAccess("role:read", "org:{org_id}:role", a.cfg))
+	secure.Put("/:role/users/:user_id", a.handleAssignRole,
+		middleware.RequireAccess("role:assign", "org:{org_id}:role", a.cfg))
+	secure.Delete("/:role/users/:user_id", a.handleUnassignRole,
+		middleware.RequireAccess("role:unassign", "org:{org_id}:role", a.cfg))
+
+	// Policy attachments
+	secure.Put("/:role/policies/:policy_id", a.handleAttachRolePolicy,
+		middleware.RequireAccess("role:attach_policy", "org:{org_id}:role", a.cfg))
+	secure.Delete("/:role/policies/:policy_id", a.handleDetachRolePolicy,
+		middleware.RequireAccess("role:detach_policy", "org:{org_id}:role", a.cfg))
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+)
+
+// registerServiceAccountRoutes defines routes for managing the service accounts
+// of the caller's organization, guarded by service_account:* actions.
+func (a *API) registerServiceAccountRoutes(secure fiber.Router) {
+	secure.Post("/", a.handleCreateServiceAccount,
+		middleware.RequireAccess("service_account:create", "org:{org_id}:service_account", a.cfg))
+	secure.Get("/", a.handleListServiceAccounts,
+		middleware.RequireAccess("service_account:read", "org:{org_id}:service_account", a.cfg))
+	secure.Get("/:id", a.handleGetServiceAccount,
+		middleware.RequireAccess("service_account:read", "org:{org_id}:service_account", a.cfg))
+	secure.Patch("/:id", a.handleUpdateServiceAccount,
+		middleware.RequireAccess("service_account:update", "org:{org_id}:service_account", a.cfg))
+	secure.Post("/:id/secret", a.handleRotateServiceAccountSecret,
+		middleware.RequireAccess("service_account:update", "org:{org_id}:service_account", a.cfg))
+	secure.Delete("/:id", a.handleDeleteServiceAccount,
+		middleware.RequireAccess("service_account:delete", "org:{org_id}:service_account", a.cfg))
+}
@@ -5,30 +5,42 @@ import (
 	"github.com/javadmohebbi/goIAM/internal/middleware"
 )
 
-// registerUserRoutes defines routes for managing users within the authenticated user's organization.
+// registerUserRoutes defines routes for managing users within the authenticated user's organization,
+// guarded by user:* actions.
 func (a *API) registerUserRoutes(secure fiber.Router) {
 	// Create a new user within the caller's organization
-	secure.Post("/create",
-		middleware.RequireAccess("create", "org:{org_id}:user", a.cfg),
-		a.handleCreateUser)
-
-	// // Update an existing user by ID
-	// secure.Patch("/:username",
-	// 	middleware.RequireAccess("update", "org:{org_id}:user:{user_id}", a.cfg, a.iamDB),
-	// 	a.handleUpdateUser)
-
-	// // Delete a user by ID
-	// secure.Delete("/:username",
-	// 	middleware.RequireAccess("delete", "org:{org_id}:user:{user_id}", a.cfg, a.iamDB),
-	// 	a.handleDeleteUser)
-
-	// // Get a specific user by ID
-	// secure.Get("/:username",
-	// 	middleware.RequireAccess("read", "org:{org_id}:user:{user_id}", a.cfg, a.iamDB),
-	// 	a.handleGetUser)
-
-	// // List all users in the caller's organization
-	// secure.Get("/users",
-	// 	middleware.RequireAccess("read", "org:{org_id}:user", a.cfg, a.iamDB),
-	// 	a.handleListUsers)
+	secure.Post("/create", a.handleCreateUser,
+		middleware.RequireAccess("user:create", "org:{org_id}:user", a.cfg))
+
+	// List and search the users of the caller's organization
+	secure.Get("/", a.handleListUsers,
+		middleware.RequireAccess("user:read", "org:{org_id}:user", a.cfg))
+
+	// Get a specific user by ID
+	secure.Get("/:id", a.handleGetUser,
+		middleware.RequireAccess("user:read", "org:{org_id}:user", a.cfg))
+
+	// Update the profile of a user
+	secure.Patch("/:id", a.handleUpdateUser,
+		middleware.RequireAccess("user:update", "org:{org_id}:user", a.cfg))
+
+	// Enable or disable a user account
+	secure.Post("/:id/activate", a.handleActivateUser,
+		middleware.RequireAccess("user:activate", "org:{org_id}:user", a.cfg))
+	secure.Post("/:id/deactivate", a.handleDeactivateUser,
+		middleware.RequireAccess("user:deactivate", "org:{org_id}:user", a.cfg))
+
+	// Invalidate the password and email reset instructions
+	secure.Post("/:id/password/reset", a.handleForcePasswordReset,
+		middleware.RequireAccess("user:reset_password", "org:{org_id}:user", a.cfg))
+
+	// Reset 2FA for a locked-out user
+	secure.Delete("/:id/2fa", a.handleReset2FA,
+		middleware.RequireAccess("user:reset_2fa", "org:{org_id}:user", a.cfg))
+
+	// Soft-delete and restore a user
+	secure.Delete("/:id", a.handleDeleteUser,
+		middleware.RequireAccess("user:delete", "org:{org_id}:user", a.cfg))
+	secure.Post("/:id/restore", a.handleRestoreUser,
+		middleware.RequireAccess("user:restore", "org:{org_id}:user", a.cfg))
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
 )
 
 // StartServer initializes and starts the Fiber HTTP server.
@@ -41,7 +42,7 @@ func (a *API) StartServer() error {
 			"status":        "ok",
 			"uptime":        time.Since(a.startTime).String(),
 			"go_version":    runtime.Version(),
-			"auth_provider": a.cfg.AuthProviders,
+			"auth_provider": a.providerNames(),
 			"port":          a.cfg.Port,
 			"app":           a._app.Config(),
 		})
@@ -57,6 +58,9 @@ func (a *API) StartServer() error {
 		return c.Next()
 	})
 
+	// Map subdomains and custom domains to organizations
+	app.Use(middleware.ResolveTenant(a.cfg, a.iamDB))
+
 	// Register routes depending on auth provider
 	a.registerRoutes(app)
 
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/middleware"
+	"gorm.io/gorm"
+)
+
+// handleServiceAccountInput represents the expected JSON structure for creating
+// or updating a service account. Nil attachment lists are left unchanged on update.
+type handleServiceAccountInput struct {
+	Name        string `json:"name"`        // required on create
+	Description string `json:"description"` // optional
+	IsActive    *bool  `json:"is_active"`   // optional, update only
+	PolicyIDs   []uint `json:"policy_ids"`  // optional, directly attached policies
+	RoleIDs     []uint `json:"role_ids"`    // optional, assigned roles
+	GroupIDs    []uint `json:"group_ids"`   // optional, group memberships
+}
+
+// serviceAccountView is the JSON representation of a service account (without secret).
+type serviceAccountView struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ClientID    string    `json:"client_id"`
+	IsActive    bool      `json:"is_active"`
+	PolicyIDs   []uint    `json:"policy_ids"`
+	RoleIDs     []uint    `json:"role_ids"`
+	GroupIDs    []uint    `json:"group_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// newServiceAccountView converts a service account with preloaded attachments into its JSON representation.
+func newServiceAccountView(sa db.ServiceAccount) serviceAccountView {
+	v := serviceAccountView{
+		ID:          sa.ID,
+		Name:        sa.Name,
+		Description: sa.Description,
+		ClientID:    sa.ClientID,
+		IsActive:    sa.IsActive,
+		PolicyIDs:   []uint{},
+		RoleIDs:     []uint{},
+		GroupIDs:    []uint{},
+		CreatedAt:   sa.CreatedAt,
+	}
+	for _, p := range sa.Policies {
+		v.PolicyIDs = append(v.PolicyIDs, p.ID)
+	}
+	for _, r := range sa.Roles {
+		v.RoleIDs = append(v.RoleIDs, r.ID)
+	}
+	for _, g := range sa.Groups {
+		v.GroupIDs = append(v.GroupIDs, g.ID)
+	}
+	return v
+}
+
+// handleCreateServiceAccount creates a service account in the caller's organization.
+//
+// The client secret is generated here and only returned in this response. Listed policies,
+// roles and groups additionally require the attachment actions, see checkServiceAccountAttachAccess.
+func (a *API) handleCreateServiceAccount(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var body handleServiceAccountInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if err := a.checkServiceAccountAttachAccess(c, &db.ServiceAccount{}, body); err != nil {
+		return err
+	}
+
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to generate client secret")
+	}
+
+	sa := db.ServiceAccount{
+		Name:             strings.TrimSpace(body.Name),
+		Description:      body.Description,
+		ClientID:         "sa-" + uuid.New().String(),
+		ClientSecretHash: auth.HashToken(secret),
+		IsActive:         true,
+		OrganizationID:   principal.PrincipalOrgID(),
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if err := tx.Create(&sa).Error; err != nil {
+			return err
+		}
+		return a.attachToServiceAccount(tx, &sa, body)
+	})
+	if err != nil {
+		return serviceAccountError(err, "failed to create service account")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"service_account": newServiceAccountView(sa),
+		"client_secret":   secret,
+	})
+}
+
+// handleListServiceAccounts lists the service accounts of the caller's organization.
+func (a *API) handleListServiceAccounts(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	var accounts []db.ServiceAccount
+	if err := a.iamDB.Preload("Policies").Preload("Roles").Preload("Groups").
+		Where("organization_id = ?", principal.PrincipalOrgID()).
+		Order("id").Find(&accounts).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to list service accounts")
+	}
+
+	views := make([]serviceAccountView, 0, len(accounts))
+	for _, sa := range accounts {
+		views = append(views, newServiceAccountView(sa))
+	}
+	return c.JSON(views)
+}
+
+// handleGetServiceAccount returns a service account of the caller's organization.
+func (a *API) handleGetServiceAccount(c fiber.Ctx) error {
+	sa, err := a.loadServiceAccount(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newServiceAccountView(*sa))
+}
+
+// handleUpdateServiceAccount updates the description, active state or attachments of a service account.
+//
+// Deactivating a service account revokes its outstanding access tokens. Changed attachments
+// additionally require the attachment actions, see checkServiceAccountAttachAccess.
+func (a *API) handleUpdateServiceAccount(c fiber.Ctx) error {
+	sa, err := a.loadServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	var body handleServiceAccountInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if err := a.checkServiceAccountAttachAccess(c, sa, body); err != nil {
+		return err
+	}
+
+	updates := map[string]any{}
+	if body.Name != "" {
+		updates["name"] = strings.TrimSpace(body.Name)
+	}
+	if body.Description != "" {
+		updates["description"] = body.Description
+	}
+	if body.IsActive != nil {
+		updates["is_active"] = *body.IsActive
+		if !*body.IsActive {
+			updates["tokens_valid_after"] = db.TokensValidAfterNow()
+		}
+	}
+
+	err = db.PolicyTransaction(a.iamDB, func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(sa).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return a.attachToServiceAccount(tx, sa, body)
+	})
+	if err != nil {
+		return serviceAccountError(err, "failed to update service account")
+	}
+
+	if sa, err = a.loadServiceAccount(c); err != nil {
+		return err
+	}
+	return c.JSON(newServiceAccountView(*sa))
+}
+
+// handleRotateServiceAccountSecret replaces the client secret of a service account.
+//
+// Access tokens issued with the old secret are revoked. The new secret is only
+// returned in this response.
+func (a *API) handleRotateServiceAccountSecret(c fiber.Ctx) error {
+	sa, err := a.loadServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to generate client secret")
+	}
+
+	if err := a.iamDB.Model(sa).Updates(map[string]any{
+		"client_secret_hash": auth.HashToken(secret),
+		"tokens_valid_after": db.TokensValidAfterNow(),
+	}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to rotate client secret")
+	}
+
+	return c.JSON(fiber.Map{
+		"client_id":     sa.ClientID,
+		"client_secret": secret,
+	})
+}
+
+// handleDeleteServiceAccount deletes a service account. Its tokens stop working immediately.
+func (a *API) handleDeleteServiceAccount(c fiber.Ctx) error {
+	sa, err := a.loadServiceAccount(c)
+	if err != nil {
+		return err
+	}
+
+	if err := a.iamDB.Delete(sa).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete service account")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadServiceAccount loads the service account identified by the :id route
+// parameter within the caller's organization, with its attachments preloaded.
+func (a *API) loadServiceAccount(c fiber.Ctx) (*db.ServiceAccount, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	id := fiber.Params[uint](c, "id")
+	if id == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid service account ID")
+	}
+
+	var sa db.ServiceAccount
+	if err := a.iamDB.Preload("Policies").Preload("Roles").Preload("Groups").
+		Where("id = ? AND organization_id = ?", id, principal.PrincipalOrgID()).
+		First(&sa).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "service account not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load service account")
+	}
+	return &sa, nil
+}
+
+// errForeignAttachment is returned when a policy, role or group does not belong
+// to the organization of the service account.
+var errForeignAttachment = errors.New("policies, roles and groups must belong to the same organization")
+
+// attachToServiceAccount replaces the policies, roles and groups of a service account
+// with the IDs given in body. Nil lists are left unchanged.
+func (a *API) attachToServiceAccount(tx *gorm.DB, sa *db.ServiceAccount, body handleServiceAccountInput) error {
+	if body.PolicyIDs != nil {
+		var policies []db.Policy
+		if err := findInOrg(tx, &policies, body.PolicyIDs, sa.OrganizationID); err != nil {
+			return err
+		}
+		if err := tx.Model(sa).Association("Policies").Replace(policies); err != nil {
+			return err
+		}
+		sa.Policies = policies
+	}
+	if body.RoleIDs != nil {
+		var roles []db.Role
+		if err := findInOrg(tx, &roles, body.RoleIDs, sa.OrganizationID); err != nil {
+			return err
+		}
+		if err := tx.Model(sa).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		sa.Roles = roles
+	}
+	if body.GroupIDs != nil {
+		var groups []db.Group
+		if err := findInOrg(tx, &groups, body.GroupIDs, sa.OrganizationID); err != nil {
+			return err
+		}
+		if err := tx.Model(sa).Association("Groups").Replace(groups); err != nil {
+			return err
+		}
+		sa.Groups = groups
+	}
+	return nil
+}
+
+// checkServiceAccountAttachAccess requires the same actions for the attachments a create
+// or update request changes as for the corresponding dedicated routes: a caller who may
+// create service accounts must not hand out policies, roles or groups they could not
+// assign otherwise, as they hold the service account's secret.
+//
+//   - policies: service_account:attach_policy / service_account:detach_policy on org:{org_id}:service_account
+//   - roles: role:assign / role:unassign on org:{org_id}:role
+//   - groups: group:add_member / group:remove_member on org:{org_id}:group
+func (a *API) checkServiceAccountAttachAccess(c fiber.Ctx, sa *db.ServiceAccount, body handleServiceAccountInput) error {
+	var roleIDs, groupIDs []uint
+	for _, r := range sa.Roles {
+		roleIDs = append(roleIDs, r.ID)
+	}
+	for _, g := range sa.Groups {
+		groupIDs = append(groupIDs, g.ID)
+	}
+
+	if err := a.checkAttachAccess(c, policyIDs(sa.Policies), body.PolicyIDs,
+		"service_account:attach_policy", "service_account:detach_policy", "org:{org_id}:service_account"); err != nil {
+		return err
+	}
+	if err := a.checkAttachAccess(c, roleIDs, body.RoleIDs, "role:assign", "role:unassign", "org:{org_id}:role"); err != nil {
+		return err
+	}
+	return a.checkAttachAccess(c, groupIDs, body.GroupIDs, "group:add_member", "group:remove_member", "org:{org_id}:group")
+}
+
+// checkAttachAccess checks the actions needed to replace the attached IDs current with ids:
+// attach if ids adds an entry, detach if it removes one. A nil list changes nothing.
+func (a *API) checkAttachAccess(c fiber.Ctx, current, ids []uint, attach, detach, resource string) error {
+	if ids == nil {
+		return nil
+	}
+
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	attached := map[uint]bool{}
+	for _, id := range current {
+		attached[id] = true
+	}
+
+	for id := range wanted {
+		if !attached[id] {
+			if err := middleware.CheckAccess(c, attach, resource, a.cfg); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	for id := range attached {
+		if !wanted[id] {
+			return middleware.CheckAccess(c, detach, resource, a.cfg)
+		}
+	}
+	return nil
+}
+
+// findInOrg loads the records with the given IDs into dest and fails with
+// errForeignAttachment unless all of them belong to orgID.
+func findInOrg[T any](tx *gorm.DB, dest *[]T, ids []uint, orgID uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("id IN ? AND organization_id = ?", ids, orgID).Find(dest).Error; err != nil {
+		return err
+	}
+	unique := map[uint]struct{}{}
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	if len(*dest) != len(unique) {
+		return errForeignAttachment
+	}
+	return nil
+}
+
+// serviceAccountError maps errors from creating or updating a service account to HTTP errors.
+func serviceAccountError(err error, msg string) error {
+	if errors.Is(err, errForeignAttachment) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+		return fiber.NewError(fiber.StatusConflict, "service account name already exists")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, msg)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// slugify derives a URL-safe slug from a name: lowercase letters and digits,
+// with every other run of characters replaced by a single "-".
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
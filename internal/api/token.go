@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// handleRefreshTokenInput represents the expected JSON structure for refreshing tokens.
+type handleRefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token"` // required
+	DeviceID     string `json:"device_id"`     // optional, must match the device the token was issued to
+}
+
+// signToken adds the standard "jti", "iat" and "exp" claims to claims and signs them
+// with the active signing key.
+//
+// Every token carries a unique ID (jti) so it can be revoked before it expires. "iat" has
+// millisecond precision, so tokens issued just before a logout-all or credential reset
+// can be told apart from those issued right after it in the same second.
+func (a *API) signToken(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["jti"] = uuid.New().String()
+	claims["iat"] = float64(now.UnixMilli()) / 1000
+	claims["exp"] = now.Add(ttl).Unix()
+
+	return a.keys.Sign(claims)
+}
+
+// accessTokenClaims returns the claims of an access token for the given user.
+//
+// The "org" claim carries the user's organization. The twoFA flag is embedded as
+// the "2fa" claim and tells RequireAuth that the user has completed the second factor.
+func (a *API) accessTokenClaims(user db.User, twoFA bool) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":  user.ID,
+		"name": user.Username,
+		"org":  user.OrganizationID,
+	}
+	if twoFA {
+		claims["2fa"] = true
+	}
+	return claims
+}
+
+// signAccessToken creates a signed JWT access token for the given user.
+func (a *API) signAccessToken(user db.User, twoFA bool) (string, error) {
+	return a.signToken(a.accessTokenClaims(user, twoFA), a.cfg.Token.AccessTTL)
+}
+
+// deviceID returns the device identifier supplied by the client,
+// either in the request body or in the X-Device-ID header.
+func deviceID(c fiber.Ctx, fromBody string) string {
+	if fromBody != "" {
+		return fromBody
+	}
+	return c.Get("X-Device-ID")
+}
+
+// createRefreshToken generates a new refresh token and stores its hash.
+//
+// The template carries the user, family, device, 2FA state and OAuth client of the
+// token; hash, request metadata and expiry are filled in here.
+// Returns the plain token, which is only ever returned to the client.
+func (a *API) createRefreshToken(c fiber.Ctx, tmpl db.RefreshToken) (string, error) {
+	plain, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	rt := db.RefreshToken{
+		UserID:    tmpl.UserID,
+		FamilyID:  tmpl.FamilyID,
+		TokenHash: auth.HashToken(plain),
+		DeviceID:  tmpl.DeviceID,
+		UserAgent: string(c.Request().Header.UserAgent()),
+		IP:        c.IP(),
+		TwoFA:     tmpl.TwoFA,
+		ClientID:  tmpl.ClientID,
+		Scope:     tmpl.Scope,
+		ExpiresAt: time.Now().Add(a.cfg.Token.RefreshTTL),
+	}
+	if err := a.iamDB.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// tokenResponse builds the JSON body returned whenever a token pair is issued.
+//
+// The access token is kept under the "token" key for compatibility with existing clients.
+func (a *API) tokenResponse(access, refresh string) fiber.Map {
+	return fiber.Map{
+		"token":         access,
+		"token_type":    "Bearer",
+		"expires_in":    int(a.cfg.Token.AccessTTL.Seconds()),
+		"refresh_token": refresh,
+	}
+}
+
+// issueTokens signs an access token and starts a new refresh token family for the user.
+func (a *API) issueTokens(c fiber.Ctx, user db.User, device string, twoFA bool) (fiber.Map, error) {
+	access, err := a.signAccessToken(user, twoFA)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := a.createRefreshToken(c, db.RefreshToken{
+		UserID:   user.ID,
+		FamilyID: uuid.New().String(),
+		DeviceID: device,
+		TwoFA:    twoFA,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.tokenResponse(access, refresh), nil
+}
+
+// handleRefreshToken exchanges a valid refresh token for a new access token and
+// a new refresh token (rotation).
+//
+// The presented token is marked as used. If an already-used or revoked token is
+// presented again, or if it is presented from a different device, the whole token
+// family is revoked and the client must log in again.
+func (a *API) handleRefreshToken(c fiber.Ctx) error {
+	var body handleRefreshTokenInput
+	if err := c.Bind().Body(&body); err != nil || body.RefreshToken == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+
+	user, rt, refresh, err := a.rotateRefreshToken(c, body.RefreshToken, deviceID(c, body.DeviceID), "")
+	if err != nil {
+		return err
+	}
+
+	access, err := a.signAccessToken(user, rt.TwoFA)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "token creation failed")
+	}
+
+	return c.JSON(a.tokenResponse(access, refresh))
+}
+
+// rotateRefreshToken validates a refresh token, marks it as used and creates its
+// replacement in the same family.
+//
+// clientID must match the OAuth client the token was issued to ("" for tokens
+// issued by /auth/login). Returns the token owner, the used token and the new
+// plain refresh token.
+func (a *API) rotateRefreshToken(c fiber.Ctx, plain, device, clientID string) (db.User, *db.RefreshToken, string, error) {
+	rt, err := db.FindRefreshTokenByHash(a.iamDB, auth.HashToken(plain))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "invalid refresh token")
+		}
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusInternalServerError, "failed to load refresh token")
+	}
+
+	// A used or revoked token being replayed means it has leaked
+	if rt.UsedAt != nil || rt.RevokedAt != nil {
+		a.revokeRefreshFamily(rt, "reuse detected")
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "refresh token reuse detected")
+	}
+
+	if rt.ClientID != clientID {
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "invalid refresh token")
+	}
+
+	if rt.DeviceID != "" && rt.DeviceID != device {
+		a.revokeRefreshFamily(rt, "device mismatch")
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "invalid refresh token")
+	}
+
+	if time.Now().After(rt.ExpiresAt) {
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "refresh token expired")
+	}
+
+	var user db.User
+	if err := a.iamDB.First(&user, rt.UserID).Error; err != nil || !user.IsActive {
+		a.revokeRefreshFamily(rt, "user not found or inactive")
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "invalid refresh token")
+	}
+
+	// Mark as used; losing this race to a concurrent request is also reuse
+	ok, err := db.MarkRefreshTokenUsed(a.iamDB, rt.ID)
+	if err != nil {
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusInternalServerError, "failed to rotate refresh token")
+	}
+	if !ok {
+		a.revokeRefreshFamily(rt, "concurrent reuse detected")
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusUnauthorized, "refresh token reuse detected")
+	}
+
+	refresh, err := a.createRefreshToken(c, *rt)
+	if err != nil {
+		return db.User{}, nil, "", fiber.NewError(fiber.StatusInternalServerError, "token creation failed")
+	}
+
+	return user, rt, refresh, nil
+}
+
+// revokeRefreshFamily revokes every token in the family of rt and logs the reason.
+func (a *API) revokeRefreshFamily(rt *db.RefreshToken, reason string) {
+	log.Printf("revoking refresh token family %s of user %d: %s", rt.FamilyID, rt.UserID, reason)
+	if err := db.RevokeRefreshTokenFamily(a.iamDB, rt.FamilyID); err != nil {
+		log.Printf("failed to revoke refresh token family %s: %v", rt.FamilyID, err)
+	}
+}
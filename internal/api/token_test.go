@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+func TestRefreshTokenRotationAndReuseDetection(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	type step struct {
+		present    int // index of the refresh token presented, 0 is the one from login
+		device     string
+		wantStatus int
+	}
+	tests := []struct {
+		name        string
+		loginDevice string
+		expired     bool
+		steps       []step
+	}{
+		{"rotation", "", false, []step{
+			{0, "", http.StatusOK},
+			{1, "", http.StatusOK},
+			{2, "", http.StatusOK},
+		}},
+		{"reuse of a rotated token revokes the family", "", false, []step{
+			{0, "", http.StatusOK},
+			{0, "", http.StatusUnauthorized},
+			{1, "", http.StatusUnauthorized},
+		}},
+		{"reuse of the latest token after reuse detection", "", false, []step{
+			{0, "", http.StatusOK},
+			{1, "", http.StatusOK},
+			{1, "", http.StatusUnauthorized},
+			{2, "", http.StatusUnauthorized},
+		}},
+		{"device bound token", "laptop", false, []step{
+			{0, "laptop", http.StatusOK},
+			{1, "laptop", http.StatusOK},
+		}},
+		{"device mismatch revokes the family", "laptop", false, []step{
+			{0, "phone", http.StatusUnauthorized},
+			{0, "laptop", http.StatusUnauthorized},
+		}},
+		{"expired token", "", true, []step{
+			{0, "", http.StatusUnauthorized},
+		}},
+	}
+	for _, tt := range tests {
+		status, res := doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+			"username": "root", "password": "Secret123x", "organization": "acme", "device_id": tt.loginDevice,
+		}, "")
+		if status != http.StatusOK {
+			t.Fatalf("%s: login: %d %v", tt.name, status, res)
+		}
+		tokens := []string{res["refresh_token"].(string)}
+		if tt.expired {
+			a.iamDB.Model(&db.RefreshToken{}).
+				Where("token_hash = ?", auth.HashToken(tokens[0])).
+				Update("expires_at", time.Now().Add(-time.Minute))
+		}
+
+		for i, s := range tt.steps {
+			status, res := doJSON(t, app, http.MethodPost, "/auth/token/refresh", map[string]any{
+				"refresh_token": tokens[s.present], "device_id": s.device,
+			}, "")
+			if status != s.wantStatus {
+				t.Errorf("%s: step %d: got %d %v, want %d", tt.name, i, status, res, s.wantStatus)
+				break
+			}
+			if status != http.StatusOK {
+				continue
+			}
+			if status, res := doJSON(t, app, http.MethodGet, "/s/auth/profile", nil, res["token"].(string)); status != http.StatusOK {
+				t.Errorf("%s: step %d: refreshed access token: %d %v", tt.name, i, status, res)
+			}
+			tokens = append(tokens, res["refresh_token"].(string))
+		}
+	}
+}
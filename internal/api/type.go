@@ -1,20 +1,28 @@
 package api
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v3"
 	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/keys"
 	"github.com/javadmohebbi/goIAM/internal/validation"
 	"gorm.io/gorm"
 )
 
 // API provides shared dependencies to API route handlers.
 //
-// It holds the application configuration and a centralized validation utility.
+// It holds the application configuration, a centralized validation utility,
+// the key manager used to sign and verify tokens, the configured
+// authentication providers and the WebAuthn relying party, if enabled.
 type API struct {
 	cfg        *config.Config
 	validation *validation.Validation
+	keys       *keys.Manager
+	providers  []Provider
+	webAuthn   *webauthn.WebAuthn // nil unless webauthn.rp_id is configured
 
 	startTime time.Time
 
@@ -24,11 +32,29 @@ type API struct {
 }
 
 // New returns a new instance of the API struct,
-// initialized with configuration and validation logic.
-func New(c *config.Config, d *gorm.DB) *API {
-	return &API{
+// initialized with configuration, validation logic and the signing key manager.
+// It fails if an auth provider is unknown or its configuration, or the WebAuthn
+// configuration, is invalid.
+func New(c *config.Config, d *gorm.DB, k *keys.Manager) (*API, error) {
+	a := &API{
 		cfg:        c,
 		validation: validation.New(c),
+		keys:       k,
 		iamDB:      d,
 	}
+	if err := a.loadProviders(); err != nil {
+		return nil, err
+	}
+	if c.WebAuthn.RPID != "" {
+		wa, err := webauthn.New(&webauthn.Config{
+			RPID:          c.WebAuthn.RPID,
+			RPDisplayName: c.WebAuthn.RPDisplayName,
+			RPOrigins:     c.WebAuthn.RPOrigins,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: %w", err)
+		}
+		a.webAuthn = wa
+	}
+	return a, nil
 }
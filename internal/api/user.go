@@ -8,6 +8,7 @@ import (
 	"github.com/javadmohebbi/goIAM/internal/db"
 	"github.com/javadmohebbi/goIAM/internal/utils"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // handleCreateUser allows an authenticated user to create another user within their organization.
@@ -58,7 +59,15 @@ func (a *API) handleCreateUser(c fiber.Ctx) error {
 		PhoneVerified: false,
 	}
 
-	if err := a.iamDB.Create(&user).Error; err != nil {
+	// GORM skips zero values of fields with a default on create,
+	// so the inactive state is written explicitly
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("is_active", false).Error
+	})
+	if err != nil {
 		var errMsg string
 		errMsg = err.Error()
 		if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
@@ -79,8 +88,8 @@ func (a *API) handleCreateUser(c fiber.Ctx) error {
 		)
 	}
 
-	// send email
-	_ = sendResetPasswordEmail(user, a.cfg)
+	// send the activation link, the user sets the password on activation
+	a.sendActivationEmailAsync(user, true)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"user_name": user.Username,
@@ -88,35 +97,3 @@ func (a *API) handleCreateUser(c fiber.Ctx) error {
 		"created":   true,
 	})
 }
-
-// // sendUserCreationEmail generates an activation token, populates an email template
-// // with the provided user information and configuration, and sends the account activation email.
-// //
-// // Parameters:
-// //   - u: the user who has just been created and needs to activate their account
-// //   - cfg: application configuration including SMTP settings
-// //
-// // Behavior:
-// //   - Uses the user's FirstName if available, otherwise falls back to Username
-// //   - Generates a UUID token (should be stored for later validation — TODO)
-// //   - Replaces placeholders in the HTML template and sends the email
-// func sendUserCreationEmail(u db.User, cfg *config.Config) error {
-// 	// Choose the name to personalize the email
-// 	_name := u.Username
-// 	if u.FirstName != "" {
-// 		_name = u.FirstName
-// 	}
-// 	// Generate a unique activation token (should be stored with expiration — TODO)
-// 	token := uuid.New().String()
-// 	// Prepare template placeholders
-// 	placeholders := map[string]string{
-// 		"Name":    _name,
-// 		"AppName": cfg.AppName,
-// 		"Year":    fmt.Sprintf("%d", time.Now().Year()),
-// 		"Token":   token,
-// 	}
-
-// 	// Send the activation email using HTML template
-// 	return smtpclient.SendEmailFromHTMLTemplate(cfg, "Activate Your Account",
-// 		[]string{u.Email}, "templates/reset-password.html", placeholders)
-// }
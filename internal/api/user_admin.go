@@ -0,0 +1,363 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// userView is the JSON representation of a user for administrators,
+// without password hash, TOTP secret or backup codes.
+type userView struct {
+	ID            uint       `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	PhoneNumber   string     `json:"phone_number"`
+	PhoneVerified bool       `json:"phone_verified"`
+	FirstName     string     `json:"first_name"`
+	MiddleName    string     `json:"middle_name"`
+	LastName      string     `json:"last_name"`
+	Address       string     `json:"address"`
+	IsActive      bool       `json:"is_active"`
+	Requires2FA   bool       `json:"requires_2fa"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// newUserView converts a user into its administrative JSON representation.
+func newUserView(u db.User) userView {
+	v := userView{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		PhoneNumber:   u.PhoneNumber,
+		PhoneVerified: u.PhoneVerified,
+		FirstName:     u.FirstName,
+		MiddleName:    u.MiddleName,
+		LastName:      u.LastName,
+		Address:       u.Address,
+		IsActive:      u.IsActive,
+		Requires2FA:   u.Requires2FA,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+	if u.DeletedAt.Valid {
+		v.DeletedAt = &u.DeletedAt.Time
+	}
+	return v
+}
+
+// handleUpdateUserInput represents the fields an administrator can change on a user.
+// Nil fields are left unchanged.
+type handleUpdateUserInput struct {
+	Username    *string `json:"username"`
+	Email       *string `json:"email"` // resets email_verified when changed
+	PhoneNumber *string `json:"phone_number"`
+	FirstName   *string `json:"first_name"`
+	MiddleName  *string `json:"middle_name"`
+	LastName    *string `json:"last_name"`
+	Address     *string `json:"address"`
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so searches match them literally.
+// The escape character is "!" because MySQL treats a backslash in a string literal as
+// an escape itself.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// handleListUsers lists the users of the caller's organization, paginated.
+//
+// Query parameters:
+//   - q: case-insensitive search in username, email, first and last name
+//   - active, email_verified, 2fa: "true" or "false" to filter by state
+//   - deleted: "true" to list soft-deleted users instead (e.g. to restore them)
+func (a *API) handleListUsers(c fiber.Ctx) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	query := a.iamDB.Model(&db.User{})
+	if deleted, err := boolQuery(c, "deleted"); err != nil {
+		return err
+	} else if deleted != nil && *deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	query = query.Where("organization_id = ?", principal.PrincipalOrgID())
+
+	for param, column := range map[string]string{
+		"active":         "is_active",
+		"email_verified": "email_verified",
+		"2fa":            "requires2_fa",
+	} {
+		value, err := boolQuery(c, param)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			query = query.Where(column+" = ?", *value)
+		}
+	}
+
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		like := "%" + likeEscaper.Replace(q) + "%"
+		query = query.Where(
+			"LOWER(username) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!' OR "+
+				"LOWER(first_name) LIKE ? ESCAPE '!' OR LOWER(last_name) LIKE ? ESCAPE '!'",
+			like, like, like, like)
+	}
+
+	page, err := paginate(c, query, newUserView)
+	if err != nil {
+		return listError(err, "failed to list users")
+	}
+	return c.JSON(page)
+}
+
+// handleGetUser returns a user of the caller's organization.
+func (a *API) handleGetUser(c fiber.Ctx) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+	return c.JSON(newUserView(*user))
+}
+
+// handleUpdateUser updates the profile of a user of the caller's organization.
+func (a *API) handleUpdateUser(c fiber.Ctx) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+
+	var body handleUpdateUserInput
+	if err := c.Bind().Body(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+
+	updates := map[string]any{}
+	if body.Username != nil {
+		if strings.TrimSpace(*body.Username) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "username must not be empty")
+		}
+		updates["username"] = strings.TrimSpace(*body.Username)
+	}
+	if body.Email != nil && *body.Email != user.Email {
+		if !a.validation.ValidateEmail(*body.Email) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid email format")
+		}
+		updates["email"] = *body.Email
+		updates["email_verified"] = false
+	}
+	if body.PhoneNumber != nil && *body.PhoneNumber != user.PhoneNumber {
+		if *body.PhoneNumber != "" && !a.validation.ValidatePhone(*body.PhoneNumber) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid phone number format")
+		}
+		updates["phone_number"] = *body.PhoneNumber
+		updates["phone_verified"] = false
+	}
+	if body.FirstName != nil {
+		updates["first_name"] = *body.FirstName
+	}
+	if body.MiddleName != nil {
+		updates["middle_name"] = *body.MiddleName
+	}
+	if body.LastName != nil {
+		updates["last_name"] = *body.LastName
+	}
+	if body.Address != nil {
+		updates["address"] = *body.Address
+	}
+
+	if len(updates) > 0 {
+		if err := user.UpdateProfile(a.iamDB, updates); err != nil {
+			if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+				return fiber.NewError(fiber.StatusConflict, "username or email already exists")
+			}
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to update user")
+		}
+	}
+
+	if user, err = a.loadUser(c, false); err != nil {
+		return err
+	}
+	return c.JSON(newUserView(*user))
+}
+
+// handleActivateUser enables a user account.
+func (a *API) handleActivateUser(c fiber.Ctx) error {
+	return a.setUserActive(c, true)
+}
+
+// handleDeactivateUser disables a user account and revokes all of its tokens.
+func (a *API) handleDeactivateUser(c fiber.Ctx) error {
+	return a.setUserActive(c, false)
+}
+
+// setUserActive implements handleActivateUser and handleDeactivateUser.
+func (a *API) setUserActive(c fiber.Ctx, active bool) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+	if !active && isCaller(c, user) {
+		return fiber.NewError(fiber.StatusBadRequest, "you cannot deactivate yourself")
+	}
+
+	if err := db.SetUserActive(a.iamDB, user.ID, active); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to update user")
+	}
+	user.IsActive = active
+	return c.JSON(newUserView(*user))
+}
+
+// handleForcePasswordReset invalidates the password of a user, revokes all of the
+// user's tokens and emails password reset instructions. The user cannot log in with
+// the old password anymore.
+func (a *API) handleForcePasswordReset(c fiber.Ctx) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+
+	// Replace the password with a random one nobody knows
+	random, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reset password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reset password")
+	}
+
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := user.UpdatePasswordHash(tx, string(hash)); err != nil {
+			return err
+		}
+		return db.RevokeAllUserTokens(tx, user.ID)
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reset password")
+	}
+
+	if err := a.sendResetPasswordEmail(*user); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "password was reset but the email could not be sent")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleReset2FA disables 2FA for a locked-out user, deletes the backup codes and
+// WebAuthn credentials and revokes all of the user's tokens.
+func (a *API) handleReset2FA(c fiber.Ctx) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+
+	if err := user.Reset2FA(a.iamDB); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to reset 2FA")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleDeleteUser soft-deletes a user. The user's tokens are revoked and the
+// account can be restored with handleRestoreUser.
+func (a *API) handleDeleteUser(c fiber.Ctx) error {
+	user, err := a.loadUser(c, false)
+	if err != nil {
+		return err
+	}
+	if isCaller(c, user) {
+		return fiber.NewError(fiber.StatusBadRequest, "you cannot delete yourself")
+	}
+
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := db.RevokeAllUserTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete user")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleRestoreUser restores a soft-deleted user. Memberships, roles and policies are kept.
+func (a *API) handleRestoreUser(c fiber.Ctx) error {
+	user, err := a.loadUser(c, true)
+	if err != nil {
+		return err
+	}
+	if !user.DeletedAt.Valid {
+		return fiber.NewError(fiber.StatusConflict, "user is not deleted")
+	}
+
+	if err := db.RestoreUser(a.iamDB, user.ID); err != nil {
+		if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+			return fiber.NewError(fiber.StatusConflict, "username or email already exists")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to restore user")
+	}
+
+	if user, err = a.loadUser(c, false); err != nil {
+		return err
+	}
+	return c.JSON(newUserView(*user))
+}
+
+// loadUser loads the user identified by the :id route parameter within the caller's
+// organization. With deleted, soft-deleted users are found as well.
+func (a *API) loadUser(c fiber.Ctx, deleted bool) (*db.User, error) {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	id := fiber.Params[uint](c, "id")
+	if id == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid user ID")
+	}
+
+	q := a.iamDB
+	if deleted {
+		q = q.Unscoped()
+	}
+	var user db.User
+	if err := q.Where("id = ? AND organization_id = ?", id, principal.PrincipalOrgID()).
+		First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "user not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load user")
+	}
+	return &user, nil
+}
+
+// isCaller reports whether user is the authenticated user.
+func isCaller(c fiber.Ctx, user *db.User) bool {
+	caller, ok := c.Locals("user").(db.User)
+	return ok && caller.ID == user.ID
+}
+
+// boolQuery parses an optional boolean query parameter. It returns nil if the parameter is absent.
+func boolQuery(c fiber.Ctx, name string) (*bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid value for "+name)
+	}
+	return &v, nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+func TestListUsersSearchMatchesWildcardsLiterally(t *testing.T) {
+	a, app := newTestAPI(t, "")
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+
+	var org db.Organization
+	a.iamDB.Where("slug = ?", "acme").First(&org)
+	for i, name := range []string{"a_b", "axb", "100%", "1000", "x!y"} {
+		user := db.User{Username: name, Email: fmt.Sprintf("user%d@example.test", i), PasswordHash: "x", OrganizationID: org.ID}
+		if err := a.iamDB.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"a_b", []string{"a_b"}},
+		{"%", []string{"100%"}},
+		{"0%", []string{"100%"}},
+		{"_", []string{"a_b"}},
+		{"x!y", []string{"x!y"}},
+		{"AX", []string{"axb"}},
+	}
+	for _, tt := range tests {
+		status, res := doJSON(t, app, http.MethodGet, "/s/user?q="+url.QueryEscape(tt.q), nil, admin)
+		if status != http.StatusOK {
+			t.Fatalf("q=%s: %d %v", tt.q, status, res)
+		}
+		var got []string
+		for _, item := range res["items"].([]any) {
+			got = append(got, item.(map[string]any)["username"].(string))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("q=%s: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/auth"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// webAuthnSessionTTL is how long a client has to complete a WebAuthn ceremony.
+const webAuthnSessionTTL = 5 * time.Minute
+
+// Purposes of WebAuthn sessions; a session only finishes the ceremony it was begun for.
+const (
+	webAuthnRegister = "register"
+	webAuthnLogin    = "login"
+	webAuthnTwoFA    = "2fa"
+)
+
+// webAuthnFinishInput represents the expected JSON structure for finishing a WebAuthn ceremony.
+type webAuthnFinishInput struct {
+	Session    string          `json:"session"`    // required, returned by the begin request
+	Credential json.RawMessage `json:"credential"` // required, the PublicKeyCredential from the browser
+	Name       string          `json:"name"`       // optional friendly name, registration only
+	DeviceID   string          `json:"device_id"`  // optional, binds a returned refresh token to this device
+}
+
+// webAuthnCredentialView is the JSON representation of a registered credential.
+type webAuthnCredentialView struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"` // synced passkey rather than a device-bound key
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
+
+// newWebAuthnCredentialView converts a credential into its JSON representation.
+func newWebAuthnCredentialView(cred db.WebAuthnCredential) webAuthnCredentialView {
+	v := webAuthnCredentialView{
+		ID:             cred.ID,
+		Name:           cred.Name,
+		Transports:     []string{},
+		BackupEligible: cred.BackupEligible,
+		CreatedAt:      cred.CreatedAt,
+		LastUsedAt:     cred.LastUsedAt,
+	}
+	if cred.Transports != "" {
+		v.Transports = strings.Split(cred.Transports, ",")
+	}
+	return v
+}
+
+// webAuthnUser adapts a user and their credentials to webauthn.User.
+type webAuthnUser struct {
+	user  db.User
+	creds []db.WebAuthnCredential
+}
+
+// webAuthnUserHandle returns the user handle of a user: the user ID as 8 big-endian
+// bytes. It identifies the user in passkey logins and carries no personal data.
+func webAuthnUserHandle(userID uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// WebAuthnID returns the user handle.
+func (u *webAuthnUser) WebAuthnID() []byte { return webAuthnUserHandle(u.user.ID) }
+
+// WebAuthnName returns the username.
+func (u *webAuthnUser) WebAuthnName() string { return u.user.Username }
+
+// WebAuthnDisplayName returns the full name of the user, or the username if it is not set.
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	if name := strings.TrimSpace(u.user.FirstName + " " + u.user.LastName); name != "" {
+		return name
+	}
+	return u.user.Username
+}
+
+// WebAuthnCredentials returns the registered credentials in the form of the webauthn package.
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.creds))
+	for _, c := range u.creds {
+		id, err := base64.RawURLEncoding.DecodeString(c.CredentialID)
+		if err != nil {
+			continue
+		}
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		creds = append(creds, webauthn.Credential{
+			ID:              id,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return creds
+}
+
+// descriptors returns the credential descriptors used to exclude or allow the user's credentials.
+func (u *webAuthnUser) descriptors() []protocol.CredentialDescriptor {
+	var list []protocol.CredentialDescriptor
+	for _, c := range u.WebAuthnCredentials() {
+		list = append(list, c.Descriptor())
+	}
+	return list
+}
+
+// loadWebAuthnUser loads the registered credentials of user.
+func (a *API) loadWebAuthnUser(user db.User) (*webAuthnUser, error) {
+	u := &webAuthnUser{user: user}
+	if err := a.iamDB.Where("user_id = ?", user.ID).Order("id").Find(&u.creds).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "failed to load credentials")
+	}
+	return u, nil
+}
+
+// requireWebAuthn returns 404 if WebAuthn is not configured.
+func (a *API) requireWebAuthn() error {
+	if a.webAuthn == nil {
+		return fiber.NewError(fiber.StatusNotFound, "WebAuthn is not enabled")
+	}
+	return nil
+}
+
+// beginWebAuthnSession stores the session data of a ceremony begun for purpose and
+// returns the opaque token the client passes to the finish request.
+func (a *API) beginWebAuthnSession(purpose string, userID uint, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := a.iamDB.Create(&db.WebAuthnSession{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(webAuthnSessionTTL),
+	}).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// finishWebAuthnSession redeems the session token of a ceremony begun for purpose by userID.
+func (a *API) finishWebAuthnSession(token, purpose string, userID uint) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+	ws, err := db.ConsumeWebAuthnSession(a.iamDB, auth.HashToken(token), purpose, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, fiber.NewError(fiber.StatusBadRequest, "invalid or expired WebAuthn session")
+	}
+	if err != nil {
+		return session, fiber.NewError(fiber.StatusInternalServerError, "failed to load WebAuthn session")
+	}
+	if err := json.Unmarshal([]byte(ws.Data), &session); err != nil {
+		return session, fiber.NewError(fiber.StatusInternalServerError, "failed to load WebAuthn session")
+	}
+	return session, nil
+}
+
+// bindWebAuthnFinish parses the body of a finish request.
+func bindWebAuthnFinish(c fiber.Ctx) (webAuthnFinishInput, error) {
+	var body webAuthnFinishInput
+	if err := c.Bind().Body(&body); err != nil {
+		return body, fiber.NewError(fiber.StatusBadRequest, "invalid input")
+	}
+	if body.Session == "" || len(body.Credential) == 0 {
+		return body, fiber.NewError(fiber.StatusBadRequest, "session and credential are required")
+	}
+	return body, nil
+}
+
+// recordAssertion stores the sign count and last use of the credential that produced
+// an assertion. Assertions from cloned authenticators are rejected.
+func (a *API) recordAssertion(c fiber.Ctx, user db.User, cred *webauthn.Credential) error {
+	if cred.Authenticator.CloneWarning {
+		a.storeLoginActivity(c, user, "webauthn_clone_warning")
+		return fiber.NewError(fiber.StatusUnauthorized, "security key may be cloned")
+	}
+	now := time.Now()
+	if err := a.iamDB.Model(&db.WebAuthnCredential{}).
+		Where("credential_id = ? AND user_id = ?", base64.RawURLEncoding.EncodeToString(cred.ID), user.ID).
+		Updates(map[string]any{
+			"sign_count":   cred.Authenticator.SignCount,
+			"backup_state": cred.Flags.BackupState,
+			"last_used_at": now,
+		}).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to update credential")
+	}
+	return nil
+}
+
+// handleWebAuthnRegisterBegin starts registering a security key or passkey for the
+// authenticated user. The response holds the session token and the publicKey options
+// for navigator.credentials.create().
+func (a *API) handleWebAuthnRegisterBegin(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	u, err := a.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+	// Discoverable credentials are preferred so keys also work for passkey login
+	creation, session, err := a.webAuthn.BeginRegistration(u,
+		webauthn.WithExclusions(u.descriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin registration")
+	}
+
+	token, err := a.beginWebAuthnSession(webAuthnRegister, user.ID, session)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin registration")
+	}
+	return c.JSON(fiber.Map{"session": token, "publicKey": creation.Response})
+}
+
+// handleWebAuthnRegisterFinish verifies the attestation of a new credential and
+// stores it. Registering a credential enables 2FA for the user, like verifying TOTP;
+// if 2FA was not enabled before, new tokens with the "2fa" claim are returned too,
+// since the caller's token no longer passes RequireAuth.
+func (a *API) handleWebAuthnRegisterFinish(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	body, err := bindWebAuthnFinish(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := a.finishWebAuthnSession(body.Session, webAuthnRegister, user.ID)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body.Credential)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid credential")
+	}
+	u, err := a.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+	cred, err := a.webAuthn.CreateCredential(u, session, parsed)
+	if err != nil {
+		log.Printf("webauthn: registration for user %d failed: %v", user.ID, err)
+		return fiber.NewError(fiber.StatusBadRequest, "credential verification failed")
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "Security key"
+		if cred.Flags.BackupEligible {
+			name = "Passkey"
+		}
+	}
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	record := db.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(cred.ID),
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		Name:            name,
+	}
+	enabling2FA := !user.Requires2FA
+	err = a.iamDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("requires2_fa", true).Error
+	})
+	if err != nil {
+		if strings.Contains(strings.ToUpper(err.Error()), "UNIQUE") {
+			return fiber.NewError(fiber.StatusConflict, "credential is already registered")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to save credential")
+	}
+
+	resp := fiber.Map{"credential": newWebAuthnCredentialView(record)}
+	if enabling2FA {
+		tokens, err := a.issueTokens(c, user, deviceID(c, body.DeviceID), true)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to create token")
+		}
+		resp = tokens
+		resp["credential"] = newWebAuthnCredentialView(record)
+		resp["message"] = "security key registered and 2FA enabled"
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// handleListWebAuthnCredentials lists the credentials of the authenticated user.
+func (a *API) handleListWebAuthnCredentials(c fiber.Ctx) error {
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	u, err := a.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+	views := make([]webAuthnCredentialView, 0, len(u.creds))
+	for _, cred := range u.creds {
+		views = append(views, newWebAuthnCredentialView(cred))
+	}
+	return c.JSON(views)
+}
+
+// handleDeleteWebAuthnCredential revokes a credential of the authenticated user.
+// Revoking the last credential of a user without TOTP disables 2FA.
+func (a *API) handleDeleteWebAuthnCredential(c fiber.Ctx) error {
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	id := fiber.Params[uint](c, "id")
+	if id == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid credential ID")
+	}
+
+	err := a.iamDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Where("id = ? AND user_id = ?", id, user.ID).Delete(&db.WebAuthnCredential{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var remaining int64
+		if err := tx.Model(&db.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 && user.TOTPSecret == "" {
+			return tx.Model(&user).Update("requires2_fa", false).Error
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "credential not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to delete credential")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleWebAuthn2FABegin starts a WebAuthn assertion as the second factor, using the
+// token returned by a login requiring 2FA. The user's credentials are allowed.
+func (a *API) handleWebAuthn2FABegin(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	u, err := a.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+	if len(u.creds) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no security keys registered")
+	}
+	assertion, session, err := a.webAuthn.BeginLogin(u)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin assertion")
+	}
+
+	token, err := a.beginWebAuthnSession(webAuthnTwoFA, user.ID, session)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin assertion")
+	}
+	return c.JSON(fiber.Map{"session": token, "publicKey": assertion.Response})
+}
+
+// handleWebAuthn2FAFinish verifies the assertion and issues an access token with the
+// "2fa" claim and a refresh token, like /s/auth/2fa/verify.
+func (a *API) handleWebAuthn2FAFinish(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+	user, ok := c.Locals("user").(db.User)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	body, err := bindWebAuthnFinish(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := a.finishWebAuthnSession(body.Session, webAuthnTwoFA, user.ID)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body.Credential)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid credential")
+	}
+	u, err := a.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+	cred, err := a.webAuthn.ValidateLogin(u, session, parsed)
+	if err != nil {
+		log.Printf("webauthn: assertion of user %d failed: %v", user.ID, err)
+		a.storeLoginActivity(c, user, "invalid_webauthn")
+		return fiber.NewError(fiber.StatusForbidden, "security key verification failed")
+	}
+	if err := a.recordAssertion(c, user, cred); err != nil {
+		return err
+	}
+
+	tokens, err := a.issueTokens(c, user, deviceID(c, body.DeviceID), true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create token")
+	}
+	a.storeLoginActivity(c, user, "success")
+	return c.JSON(tokens)
+}
+
+// handlePasskeyLoginBegin starts a usernameless passkey login. The browser offers the
+// discoverable credentials it holds for the relying party.
+func (a *API) handlePasskeyLoginBegin(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+
+	assertion, session, err := a.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin login")
+	}
+
+	token, err := a.beginWebAuthnSession(webAuthnLogin, 0, session)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to begin login")
+	}
+	return c.JSON(fiber.Map{"session": token, "publicKey": assertion.Response})
+}
+
+// handlePasskeyLoginFinish verifies a passkey assertion and logs in the user it belongs to.
+//
+// The user is identified by the user handle of the credential, so no username is needed.
+// Passkeys require user verification (PIN or biometrics) and are possessed by the user,
+// so the issued access token carries the "2fa" claim.
+func (a *API) handlePasskeyLoginFinish(c fiber.Ctx) error {
+	if err := a.requireWebAuthn(); err != nil {
+		return err
+	}
+	body, err := bindWebAuthnFinish(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := a.finishWebAuthnSession(body.Session, webAuthnLogin, 0)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body.Credential)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid credential")
+	}
+
+	var found *webAuthnUser
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != 8 {
+			return nil, errors.New("unknown user handle")
+		}
+		var user db.User
+		if err := scopeToTenant(c, a.iamDB).
+			First(&user, uint(binary.BigEndian.Uint64(userHandle))).Error; err != nil {
+			return nil, err
+		}
+		u, err := a.loadWebAuthnUser(user)
+		if err != nil {
+			return nil, err
+		}
+		found = u
+		return u, nil
+	}
+	_, cred, err := a.webAuthn.ValidatePasskeyLogin(lookup, session, parsed)
+	if err != nil {
+		log.Printf("webauthn: passkey login failed: %v", err)
+		if found != nil {
+			a.storeLoginActivity(c, found.user, "invalid_passkey")
+		}
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid credentials")
+	}
+
+	user := found.user
+	if err := a.recordAssertion(c, user, cred); err != nil {
+		return err
+	}
+	if err := a.checkLoginAllowed(c, user); err != nil {
+		return err
+	}
+
+	tokens, err := a.issueTokens(c, user, deviceID(c, body.DeviceID), true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "token creation failed")
+	}
+	a.storeLoginActivity(c, user, "success")
+	return c.JSON(tokens)
+}
@@ -0,0 +1,447 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/db"
+)
+
+const (
+	webAuthnTestConfig = "webauthn:\n  rp_id: localhost\n  rp_origins: [\"http://localhost\"]\n"
+	webAuthnTestOrigin = "http://localhost"
+)
+
+// Authenticator data flags set by softAuthenticator: user present, user verified and,
+// at registration, attested credential data included.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a software security key holding one discoverable ES256
+// credential, answering the ceremonies of the WebAuthn endpoints like a browser would.
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	counter    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, id: id}
+}
+
+// authData returns authenticator data for the relying party "localhost" with the given
+// flags, followed by attested, and increments the signature counter.
+func (k *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	k.counter++
+	rpIDHash := sha256.Sum256([]byte("localhost"))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, k.counter)
+	return append(data, attested...)
+}
+
+// clientData returns the clientDataJSON of a ceremony answering the begin response.
+func clientData(t *testing.T, ceremony string, begin map[string]any) []byte {
+	t.Helper()
+
+	options, _ := begin["publicKey"].(map[string]any)
+	challenge, _ := options["challenge"].(string)
+	if challenge == "" {
+		t.Fatalf("no challenge in %v", begin)
+	}
+	data, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": webAuthnTestOrigin})
+	return data
+}
+
+// register registers the credential for the user of token, through the register
+// begin and finish endpoints, and returns the finish response.
+func (k *softAuthenticator) register(t *testing.T, app *fiber.App, token string) (int, map[string]any) {
+	t.Helper()
+
+	status, begin := doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/begin", nil, token)
+	if status != http.StatusOK {
+		t.Fatalf("register begin: %d %v", status, begin)
+	}
+	return doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/finish", map[string]any{
+		"session":    begin["session"],
+		"credential": k.attestation(t, begin),
+	}, token)
+}
+
+// attestation answers the begin response of a registration with the new credential.
+func (k *softAuthenticator) attestation(t *testing.T, begin map[string]any) map[string]any {
+	t.Helper()
+
+	user, _ := begin["publicKey"].(map[string]any)["user"].(map[string]any)
+	handle, err := base64.RawURLEncoding.DecodeString(user["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.userHandle = handle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: k.key.X.FillBytes(make([]byte, 32)),
+		YCoord: k.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(k.id)))
+	attested = append(append(attested, k.id...), publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": k.authData(flagUserPresent|flagUserVerified|flagAttestedData, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	return map[string]any{
+		"id":    b64(k.id),
+		"rawId": b64(k.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(clientData(t, "webauthn.create", begin)),
+			"attestationObject": b64(attestation),
+			"transports":        []string{"usb"},
+		},
+	}
+}
+
+// assertion answers the begin response of a login with a signed assertion.
+func (k *softAuthenticator) assertion(t *testing.T, begin map[string]any) map[string]any {
+	t.Helper()
+
+	authData := k.authData(flagUserPresent|flagUserVerified, nil)
+	client := clientData(t, "webauthn.get", begin)
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, k.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	return map[string]any{
+		"id":    b64(k.id),
+		"rawId": b64(k.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(client),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(k.userHandle),
+		},
+	}
+}
+
+// passkeyLogin logs in with the credential through the usernameless passkey endpoints.
+func (k *softAuthenticator) passkeyLogin(t *testing.T, app *fiber.App) (int, map[string]any) {
+	t.Helper()
+
+	status, begin := doJSON(t, app, http.MethodPost, "/auth/webauthn/login/begin", nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("passkey login begin: %d %v", status, begin)
+	}
+	return doJSON(t, app, http.MethodPost, "/auth/webauthn/login/finish", map[string]any{
+		"session":    begin["session"],
+		"credential": k.assertion(t, begin),
+	}, "")
+}
+
+func TestReset2FARemovesPasskeys(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+
+	key := newSoftAuthenticator(t)
+	if status, res := key.register(t, app, alice); status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+	if status, res := key.passkeyLogin(t, app); status != http.StatusOK {
+		t.Fatalf("passkey login before the reset: %d %v", status, res)
+	}
+
+	var user db.User
+	if err := a.iamDB.Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status, res := doJSON(t, app, http.MethodDelete, fmt.Sprintf("/s/user/%d/2fa", user.ID), nil, admin); status != http.StatusNoContent {
+		t.Fatalf("reset 2FA: %d %v", status, res)
+	}
+
+	// The lost key no longer logs in
+	if status, res := key.passkeyLogin(t, app); status != http.StatusUnauthorized {
+		t.Errorf("passkey login after the reset: got %d %v, want 401", status, res)
+	}
+}
+
+func TestDisableTOTPKeeps2FAWithSecurityKeys(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+
+	key := newSoftAuthenticator(t)
+	status, res := key.register(t, app, alice)
+	if status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+	alice, _ = res["token"].(string)
+
+	if status, res := doJSON(t, app, http.MethodPost, "/s/auth/2fa/disable", map[string]any{}, alice); status != http.StatusOK {
+		t.Fatalf("disable 2FA: %d %v", status, res)
+	}
+	var user db.User
+	if err := a.iamDB.Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.Requires2FA {
+		t.Error("2FA was disabled while a security key is registered")
+	}
+
+	// Login with the password alone still asks for the second factor
+	status, res = doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+		"username": "alice", "password": "Secret123x", "organization": "acme",
+	}, "")
+	if status != http.StatusAccepted {
+		t.Errorf("password login: got %d %v, want the 2FA challenge", status, res)
+	}
+}
+
+func TestWebAuthnRegister(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+	bob := loginAsLimitedUser(t, a, app, admin, "bob", "user:read", "user:update")
+	carol := loginAsLimitedUser(t, a, app, admin, "carol", "user:read")
+
+	first := newSoftAuthenticator(t)
+	finish := func(key *softAuthenticator, begin map[string]any, token string) (int, map[string]any) {
+		return doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/finish", map[string]any{
+			"session":    begin["session"],
+			"credential": key.attestation(t, begin),
+		}, token)
+	}
+
+	tests := []struct {
+		name       string
+		register   func() (int, map[string]any)
+		wantStatus int
+		wantToken  bool // tokens carrying the "2fa" claim are returned
+	}{
+		{"first key enables 2FA", func() (int, map[string]any) {
+			return first.register(t, app, alice)
+		}, http.StatusCreated, true},
+		{"second key", func() (int, map[string]any) {
+			return newSoftAuthenticator(t).register(t, app, alice)
+		}, http.StatusCreated, false},
+		{"same key again", func() (int, map[string]any) {
+			return first.register(t, app, alice)
+		}, http.StatusConflict, false},
+		{"replayed session", func() (int, map[string]any) {
+			_, begin := doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/begin", nil, alice)
+			if status, res := finish(newSoftAuthenticator(t), begin, alice); status != http.StatusCreated {
+				t.Fatalf("first finish: %d %v", status, res)
+			}
+			return finish(newSoftAuthenticator(t), begin, alice)
+		}, http.StatusBadRequest, false},
+		{"session of another user", func() (int, map[string]any) {
+			_, begin := doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/begin", nil, bob)
+			return finish(newSoftAuthenticator(t), begin, alice)
+		}, http.StatusBadRequest, false},
+		{"without user:update", func() (int, map[string]any) {
+			return doJSON(t, app, http.MethodPost, "/s/auth/webauthn/register/begin", nil, carol)
+		}, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		status, res := tt.register()
+		if status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+		token, _ := res["token"].(string)
+		if (token != "") != tt.wantToken {
+			t.Errorf("%s: token returned: %v, want %v", tt.name, token != "", tt.wantToken)
+		}
+		// The caller's token no longer passes once 2FA is enabled
+		if token != "" {
+			alice = token
+		}
+	}
+
+	var user db.User
+	if err := a.iamDB.Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	var registered int64
+	a.iamDB.Model(&db.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&registered)
+	if !user.Requires2FA || registered != 3 {
+		t.Errorf("2FA %v with %d keys, want enabled with 3", user.Requires2FA, registered)
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+
+	key := newSoftAuthenticator(t)
+	if status, res := key.register(t, app, alice); status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+
+	tests := []struct {
+		name       string
+		login      func() (int, map[string]any)
+		wantStatus int
+	}{
+		{"passkey", func() (int, map[string]any) {
+			return key.passkeyLogin(t, app)
+		}, http.StatusOK},
+		{"password and security key", func() (int, map[string]any) {
+			status, res := doJSON(t, app, http.MethodPost, "/auth/login", map[string]any{
+				"username": "alice", "password": "Secret123x", "organization": "acme",
+			}, "")
+			if status != http.StatusAccepted {
+				t.Fatalf("password login: %d %v", status, res)
+			}
+			challenge := res["token"].(string)
+			_, begin := doJSON(t, app, http.MethodPost, "/s/auth/2fa/webauthn/begin", nil, challenge)
+			return doJSON(t, app, http.MethodPost, "/s/auth/2fa/webauthn/finish", map[string]any{
+				"session": begin["session"], "credential": key.assertion(t, begin),
+			}, challenge)
+		}, http.StatusOK},
+		{"unregistered key", func() (int, map[string]any) {
+			other := newSoftAuthenticator(t)
+			other.userHandle = key.userHandle
+			return other.passkeyLogin(t, app)
+		}, http.StatusUnauthorized},
+		{"replayed session", func() (int, map[string]any) {
+			_, begin := doJSON(t, app, http.MethodPost, "/auth/webauthn/login/begin", nil, "")
+			body := map[string]any{"session": begin["session"], "credential": key.assertion(t, begin)}
+			if status, res := doJSON(t, app, http.MethodPost, "/auth/webauthn/login/finish", body, ""); status != http.StatusOK {
+				t.Fatalf("first finish: %d %v", status, res)
+			}
+			body["credential"] = key.assertion(t, begin)
+			return doJSON(t, app, http.MethodPost, "/auth/webauthn/login/finish", body, "")
+		}, http.StatusBadRequest},
+		{"cloned key", func() (int, map[string]any) {
+			clone := *key
+			clone.counter = 0
+			return clone.passkeyLogin(t, app)
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		status, res := tt.login()
+		if status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if status, res := doJSON(t, app, http.MethodGet, "/s/auth/profile", nil, res["token"].(string)); status != http.StatusOK {
+			t.Errorf("%s: access token: %d %v", tt.name, status, res)
+		}
+	}
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	a, app := newTestAPI(t, webAuthnTestConfig)
+	admin := registerAndLogin(t, app, "root", "root@acme.test", "acme")
+	alice := loginAsLimitedUser(t, a, app, admin, "alice", "user:read", "user:update")
+	bob := loginAsLimitedUser(t, a, app, admin, "bob", "user:read", "user:update")
+
+	keys := []*softAuthenticator{newSoftAuthenticator(t), newSoftAuthenticator(t)}
+	for _, key := range keys {
+		status, res := key.register(t, app, alice)
+		if status != http.StatusCreated {
+			t.Fatalf("register: %d %v", status, res)
+		}
+		if token, _ := res["token"].(string); token != "" {
+			alice = token
+		}
+	}
+	if status, res := newSoftAuthenticator(t).register(t, app, bob); status != http.StatusCreated {
+		t.Fatalf("register: %d %v", status, res)
+	}
+
+	credentialID := func(key *softAuthenticator) string {
+		var cred db.WebAuthnCredential
+		if err := a.iamDB.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(key.id)).First(&cred).Error; err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(cred.ID)
+	}
+	var bobs db.WebAuthnCredential
+	if err := a.iamDB.Joins("JOIN users ON users.id = web_authn_credentials.user_id").
+		Where("users.username = ?", "bob").First(&bobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	first, second := credentialID(keys[0]), credentialID(keys[1])
+
+	tests := []struct {
+		name         string
+		id           string
+		wantStatus   int
+		wantRequires bool // whether alice still requires 2FA afterwards
+	}{
+		{"invalid ID", "abc", http.StatusBadRequest, true},
+		{"key of another user", fmt.Sprint(bobs.ID), http.StatusNotFound, true},
+		{"first key", first, http.StatusNoContent, true},
+		{"deleted key", first, http.StatusNotFound, true},
+		{"last key disables 2FA", second, http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		status, res := doJSON(t, app, http.MethodDelete, "/s/auth/webauthn/credentials/"+tt.id, nil, alice)
+		if status != tt.wantStatus {
+			t.Errorf("%s: got %d %v, want %d", tt.name, status, res, tt.wantStatus)
+			continue
+		}
+		var user db.User
+		if err := a.iamDB.Where("username = ?", "alice").First(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		if user.Requires2FA != tt.wantRequires {
+			t.Errorf("%s: requires 2FA %v, want %v", tt.name, user.Requires2FA, tt.wantRequires)
+		}
+	}
+
+	// Deleted keys no longer log in
+	for i, key := range keys {
+		if status, res := key.passkeyLogin(t, app); status != http.StatusUnauthorized {
+			t.Errorf("passkey login with deleted key %d: got %d %v, want 401", i, status, res)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package auth provides helpers for generating and hashing opaque tokens
+// such as refresh tokens, which are handed to clients but only stored hashed.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+)
+
+// GenerateOpaqueToken returns a URL-safe random token with 256 bits of entropy.
+//
+// The token carries no information by itself; the server looks it up by its hash.
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 digest of an opaque token.
+//
+// Opaque tokens are high-entropy, so a fast hash is sufficient and allows
+// direct lookup by hash (unlike bcrypt, which is salted).
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericCode returns a random code of n decimal digits, e.g. a one-time
+// login code to be typed in by the user. Such codes have little entropy and must
+// be protected by attempt limits and a short expiry.
+func GenerateNumericCode(n int) (string, error) {
+	buf := make([]byte, n)
+	for i := range buf {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = byte('0' + d.Int64())
+	}
+	return string(buf), nil
+}
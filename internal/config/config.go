@@ -2,8 +2,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,6 +20,13 @@ import (
 //   - DatabaseDSN: the database connection string (DSN)
 //   - AuthProviders: a list of authentication providers ("local", "ldap", etc.)
 //   - JWTSecret: the secret key used for signing JWT tokens
+//   - Token: lifetimes of issued access and refresh tokens
+//   - Signing: algorithm, storage and rotation of JWT signing keys
+//   - OIDC: settings for acting as an OpenID Connect provider
+//   - Policy: settings of the policy evaluation engine
+//   - Login: requirements a user must meet to log in
+//   - Tenancy: how requests are mapped to organizations
+//   - WebAuthn: relying party settings for security keys and passkeys
 type Config struct {
 	Port          int                  `yaml:"port"`
 	Debug         bool                 `yaml:"debug"`
@@ -28,6 +38,64 @@ type Config struct {
 	AppName       string               `yaml:"appName"`    // Application name used in CLI and logs
 	ServerName    string               `yaml:"serverName"` // Server name for headers or UI
 	SMTP          SMTPConfig           `yaml:"smtp"`
+	Token         TokenConfig          `yaml:"token"`
+	Signing       SigningConfig        `yaml:"signing"`
+	OIDC          OIDCConfig           `yaml:"oidc"`
+	Policy        PolicyConfig         `yaml:"policy"`
+	Login         LoginConfig          `yaml:"login"`
+	Tenancy       TenancyConfig        `yaml:"tenancy"`
+	WebAuthn      WebAuthnConfig       `yaml:"webauthn"`
+}
+
+// TenancyConfig controls how requests are mapped to organizations (tenants).
+type TenancyConfig struct {
+	// base domain whose subdomains are organization slugs, e.g. "iam.example.com"
+	// maps acme.iam.example.com to the organization "acme"; empty disables subdomains
+	BaseDomain string `yaml:"base_domain"`
+}
+
+// WebAuthnConfig holds the relying party settings for WebAuthn security keys and passkeys.
+// WebAuthn is disabled unless RPID is set.
+type WebAuthnConfig struct {
+	RPID          string   `yaml:"rp_id"`           // domain credentials are scoped to, e.g. "iam.example.com"
+	RPDisplayName string   `yaml:"rp_display_name"` // shown by authenticators (defaults to appName)
+	RPOrigins     []string `yaml:"rp_origins"`      // origins allowed to run ceremonies (defaults to https://<rp_id>)
+}
+
+// PolicyConfig holds settings of the policy evaluation engine.
+type PolicyConfig struct {
+	// how long compiled policies and principal attachments are cached; local changes
+	// invalidate the cache immediately, the TTL bounds staleness across instances
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// verbs of the services of applications authorizing through /s/authz/check,
+	// e.g. invoice: [read, list]; policy documents may only use these and goIAM's own actions
+	Actions map[string][]string `yaml:"actions"`
+}
+
+// OIDCConfig holds settings for the built-in OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer     string        `yaml:"issuer"`       // public base URL used as "iss" (defaults to the request's base URL)
+	LoginURL   string        `yaml:"login_url"`    // optional custom login page; receives the authorize query string
+	CodeTTL    time.Duration `yaml:"code_ttl"`     // lifetime of authorization codes
+	IDTokenTTL time.Duration `yaml:"id_token_ttl"` // lifetime of id_tokens
+}
+
+// TokenConfig controls the lifetime of tokens issued after a successful login.
+type TokenConfig struct {
+	AccessTTL  time.Duration `yaml:"access_ttl"`  // lifetime of JWT access tokens (e.g., "15m")
+	RefreshTTL time.Duration `yaml:"refresh_ttl"` // lifetime of refresh tokens (e.g., "720h")
+
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"` // lifetime of emailed password reset tokens (e.g., "1h")
+	ActivationTTL    time.Duration `yaml:"activation_ttl"`     // lifetime of emailed activation and verification tokens (e.g., "72h")
+	InvitationTTL    time.Duration `yaml:"invitation_ttl"`     // lifetime of emailed organization invitations (e.g., "168h")
+	EmailLoginTTL    time.Duration `yaml:"email_login_ttl"`    // lifetime of emailed passwordless login codes and links (e.g., "10m")
+}
+
+// LoginConfig holds the requirements a user must meet to log in.
+// Inactive users are always rejected.
+type LoginConfig struct {
+	RequireVerifiedEmail bool `yaml:"require_verified_email"` // reject users who have not verified their email
 }
 
 // SMTPConfig holds configuration for outbound SMTP email.
@@ -56,26 +124,120 @@ type AuthProviderConfig struct {
 	Config map[string]interface{} `yaml:"config"` // raw provider-specific configuration
 }
 
-// LDAPConfig defines configuration fields for an LDAP provider.
+// SigningConfig controls how JWTs are signed and how signing keys are rotated.
+//
+// Algorithm "HS256" keeps the legacy behaviour of signing with JWTSecret;
+// asymmetric algorithms publish their public keys at /.well-known/jwks.json.
+type SigningConfig struct {
+	Algorithm        string        `yaml:"algorithm"`         // "RS256", "ES256", "EdDSA" or "HS256"
+	Storage          string        `yaml:"storage"`           // "db" or "disk"
+	KeyDir           string        `yaml:"key_dir"`           // directory for PEM files when storage is "disk"
+	RotationInterval time.Duration `yaml:"rotation_interval"` // how often a new signing key is generated
+	Retention        time.Duration `yaml:"retention"`         // how long retired keys are still published
+}
+
+// LocalConfig defines configuration fields for the local provider.
+type LocalConfig struct {
+	DisableRegistration bool `yaml:"disableRegistration"` // reject self-service registration
+}
+
+// LDAPConfig defines configuration fields for an LDAP or Active Directory provider.
+//
+// Users are found with a search using the service account, then authenticated by
+// binding with their own DN and password. On success, they are provisioned into
+// Organization and their mapped groups and roles are synchronized.
 type LDAPConfig struct {
-	Server string `yaml:"server"`
-	BaseDN string `yaml:"baseDn"`
+	Server             string        `yaml:"server"`             // ldap://host:389 or ldaps://host:636
+	BaseDN             string        `yaml:"baseDn"`             // base of the user search
+	StartTLS           bool          `yaml:"startTls"`           // upgrade ldap:// connections with StartTLS
+	CACertFile         string        `yaml:"caCertFile"`         // PEM file with the CA of the server certificate
+	InsecureSkipVerify bool          `yaml:"insecureSkipVerify"` // do not verify the server certificate (testing only)
+	BindDN             string        `yaml:"bindDn"`             // service account used for searches; anonymous if empty
+	BindPassword       string        `yaml:"bindPassword"`       // password of the service account
+	Timeout            time.Duration `yaml:"timeout"`            // connect and request timeout, default 10s
+	Organization       string        `yaml:"organization"`       // slug of the organization users are provisioned into
+
+	UserFilter         string `yaml:"userFilter"`         // default "(uid={username})"; {username} is escaped
+	UsernameAttribute  string `yaml:"usernameAttribute"`  // default "uid"
+	EmailAttribute     string `yaml:"emailAttribute"`     // default "mail"
+	FirstNameAttribute string `yaml:"firstNameAttribute"` // default "givenName"
+	LastNameAttribute  string `yaml:"lastNameAttribute"`  // default "sn"
+
+	// Group memberships are read from GroupAttribute of the user entry (default "memberOf")
+	// or, if GroupFilter is set, searched below GroupBaseDN (default BaseDN);
+	// {dn} and {username} in GroupFilter are replaced by the escaped user DN and username
+	GroupAttribute string `yaml:"groupAttribute"`
+	GroupBaseDN    string `yaml:"groupBaseDn"`
+	GroupFilter    string `yaml:"groupFilter"`
+
+	GroupMappings []LDAPGroupMapping `yaml:"groupMappings"`
+}
+
+// LDAPGroupMapping grants goIAM groups and roles to members of an LDAP group.
+//
+// Memberships are synchronized on every login: mapped groups and roles are added to
+// members and removed from users who left the LDAP group. Groups and roles that are
+// not mapped are left unchanged.
+type LDAPGroupMapping struct {
+	GroupDN string   `yaml:"groupDn"` // DN of the LDAP group, compared case-insensitively
+	Groups  []string `yaml:"groups"`  // slugs of goIAM groups in the organization
+	Roles   []string `yaml:"roles"`   // slugs of goIAM roles in the organization
+}
+
+// UpstreamOIDCConfig defines configuration fields for logging in at an upstream
+// OpenID Connect provider ("oidc"). The "auth0" and "entra_id" providers are presets
+// that derive Issuer from Auth0Config and EntraIDConfig and accept the
+// other fields in the same block.
+//
+// Users are provisioned into Organization on first login, or linked to an existing
+// user of the organization with the same, verified email address.
+type UpstreamOIDCConfig struct {
+	Issuer       string   `yaml:"issuer"`       // issuer URL; metadata is read from its discovery document
+	ClientID     string   `yaml:"clientId"`     // client registered at the issuer
+	ClientSecret string   `yaml:"clientSecret"` // sent to the token endpoint (client_secret_post)
+	RedirectURL  string   `yaml:"redirectUrl"`  // https://<iam>/auth/federation/<name>/callback, registered at the issuer
+	Scopes       []string `yaml:"scopes"`       // default openid, email and profile
+	Organization string   `yaml:"organization"` // slug of the organization users are provisioned into
+
+	UsernameClaim string `yaml:"usernameClaim"` // default "preferred_username", falls back to the email
+	EmailClaim    string `yaml:"emailClaim"`    // default "email"
+	GroupsClaim   string `yaml:"groupsClaim"`   // default "groups"; a list of group names or IDs
+
+	// TrustEmail treats the email claim as verified even without "email_verified": true.
+	// Only enable it for issuers that verify addresses themselves.
+	TrustEmail bool `yaml:"trustEmail"`
+
+	// LinkOtherProviders also links upstream accounts by email to users managed by another
+	// provider, e.g. "ldap". By default only local users and users of this provider are linked.
+	LinkOtherProviders bool `yaml:"linkOtherProviders"`
+
+	// GroupMappings are only synchronized onto users created by this provider,
+	// never onto linked local users or users of other providers
+	GroupMappings []ClaimGroupMapping `yaml:"groupMappings"`
+}
+
+// ClaimGroupMapping grants goIAM groups and roles to users whose groups claim contains Group.
+// Memberships are synchronized on every login like LDAPGroupMapping.
+type ClaimGroupMapping struct {
+	Group  string   `yaml:"group"`  // value in the groups claim, e.g. an Entra ID group object ID
+	Groups []string `yaml:"groups"` // slugs of goIAM groups in the organization
+	Roles  []string `yaml:"roles"`  // slugs of goIAM roles in the organization
 }
 
 // Auth0Config defines configuration fields for an Auth0 provider.
 type Auth0Config struct {
-	Domain       string `yaml:"domain"`
+	Domain       string `yaml:"domain"` // Auth0 tenant domain; the issuer is https://<domain>/
 	ClientID     string `yaml:"clientId"`
 	ClientSecret string `yaml:"clientSecret"`
-	Audience     string `yaml:"audience"`
+	Audience     string `yaml:"audience"` // optional API identifier sent with the authorization request
 }
 
 // EntraIDConfig defines configuration fields for Microsoft Entra ID.
 type EntraIDConfig struct {
-	TenantID      string   `yaml:"tenantId"`
+	TenantID      string   `yaml:"tenantId"` // directory (tenant) ID; the issuer is <authorityHost>/<tenantId>/v2.0
 	ClientID      string   `yaml:"clientId"`
 	ClientSecret  string   `yaml:"clientSecret"`
-	AuthorityHost string   `yaml:"authorityHost"`
+	AuthorityHost string   `yaml:"authorityHost"` // default https://login.microsoftonline.com
 	Scopes        []string `yaml:"scopes"`
 }
 
@@ -121,7 +283,9 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.Validation.PhoneRegex = `^\+?[0-9]{7,15}$`
 	}
 	if cfg.Validation.PasswordRegex == "" {
-		cfg.Validation.PasswordRegex = `^(?=.*[A-Za-z])(?=.*\d)[A-Za-z\d@$!%*#?&]{6,}$`
+		// At least one letter and one digit; Go's RE2 syntax has no lookaheads,
+		// so both orders are spelled out. The length is checked by password_min_length.
+		cfg.Validation.PasswordRegex = `^[A-Za-z\d@$!%*#?&]*([A-Za-z][A-Za-z\d@$!%*#?&]*\d|\d[A-Za-z\d@$!%*#?&]*[A-Za-z])[A-Za-z\d@$!%*#?&]*$`
 	}
 	if cfg.Validation.WebsiteRegex == "" {
 		cfg.Validation.WebsiteRegex = `^https?://[\w\-\.]+\.\w+`
@@ -129,6 +293,84 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Validation.PasswordMinLength == 0 {
 		cfg.Validation.PasswordMinLength = 6
 	}
+	for name, pattern := range map[string]string{
+		"email_regex":    cfg.Validation.EmailRegex,
+		"phone_regex":    cfg.Validation.PhoneRegex,
+		"password_regex": cfg.Validation.PasswordRegex,
+		"website_regex":  cfg.Validation.WebsiteRegex,
+	} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("validation.%s: %w", name, err)
+		}
+	}
+
+	// Without configured providers, users log in with local accounts
+	if len(cfg.AuthProviders) == 0 {
+		cfg.AuthProviders = []AuthProviderConfig{{Name: "local"}}
+	}
+
+	// Apply default token lifetimes if not set
+	if cfg.Token.AccessTTL == 0 {
+		cfg.Token.AccessTTL = 15 * time.Minute
+	}
+	if cfg.Token.RefreshTTL == 0 {
+		cfg.Token.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if cfg.Token.PasswordResetTTL == 0 {
+		cfg.Token.PasswordResetTTL = time.Hour
+	}
+	if cfg.Token.ActivationTTL == 0 {
+		cfg.Token.ActivationTTL = 72 * time.Hour
+	}
+	if cfg.Token.InvitationTTL == 0 {
+		cfg.Token.InvitationTTL = 7 * 24 * time.Hour
+	}
+	if cfg.Token.EmailLoginTTL == 0 {
+		cfg.Token.EmailLoginTTL = 10 * time.Minute
+	}
+
+	// Apply default signing config if not set
+	if cfg.Signing.Algorithm == "" {
+		cfg.Signing.Algorithm = "RS256"
+	}
+	if cfg.Signing.Storage == "" {
+		cfg.Signing.Storage = "db"
+	}
+	if cfg.Signing.KeyDir == "" {
+		cfg.Signing.KeyDir = "./keys"
+	}
+	if cfg.Signing.RotationInterval == 0 {
+		cfg.Signing.RotationInterval = 30 * 24 * time.Hour
+	}
+	if cfg.Signing.Retention == 0 {
+		cfg.Signing.Retention = 24 * time.Hour
+	}
+
+	// Apply default OIDC lifetimes if not set
+	if cfg.OIDC.CodeTTL == 0 {
+		cfg.OIDC.CodeTTL = time.Minute
+	}
+	if cfg.OIDC.IDTokenTTL == 0 {
+		cfg.OIDC.IDTokenTTL = time.Hour
+	}
+
+	// Apply WebAuthn relying party defaults if enabled
+	if cfg.WebAuthn.RPID != "" {
+		if cfg.WebAuthn.RPDisplayName == "" {
+			cfg.WebAuthn.RPDisplayName = cfg.AppName
+		}
+		if cfg.WebAuthn.RPDisplayName == "" {
+			cfg.WebAuthn.RPDisplayName = "goIAM"
+		}
+		if len(cfg.WebAuthn.RPOrigins) == 0 {
+			cfg.WebAuthn.RPOrigins = []string{"https://" + cfg.WebAuthn.RPID}
+		}
+	}
+
+	// Apply default policy cache TTL if not set
+	if cfg.Policy.CacheTTL == 0 {
+		cfg.Policy.CacheTTL = time.Minute
+	}
 
 	if portStr := os.Getenv("IAM_PORT"); portStr != "" {
 		// Override YAML port with environment variable IAM_PORT
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthorizationCode is a short-lived, single-use code issued by /oauth2/authorize
+// and exchanged for tokens at /oauth2/token.
+//
+// Fields:
+//   - CodeHash: SHA-256 hash of the code (the code itself is never stored)
+//   - ClientID, RedirectURI: must match the token request
+//   - UserID: the user who authorized the client
+//   - Scope, Nonce: copied into the issued tokens
+//   - CodeChallenge, CodeChallengeMethod: PKCE parameters (RFC 7636)
+//   - TwoFA: whether the user completed the second factor
+//   - AuthTime: when the user authenticated
+//   - FamilyID: refresh token family issued for this code, revoked if the code is replayed
+type AuthorizationCode struct {
+	gorm.Model
+	CodeHash            string `gorm:"uniqueIndex;not null"`
+	ClientID            string `gorm:"index;not null"`
+	UserID              uint
+	RedirectURI         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	TwoFA               bool
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+	FamilyID            string
+}
+
+// FindAuthorizationCodeByHash retrieves an authorization code by the hash of its value.
+func FindAuthorizationCodeByHash(db *gorm.DB, hash string) (*AuthorizationCode, error) {
+	var code AuthorizationCode
+	if err := db.Where("code_hash = ?", hash).First(&code).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// MarkAuthorizationCodeUsed atomically marks an unused code as used.
+//
+// Returns false if the code had already been redeemed.
+func MarkAuthorizationCodeUsed(db *gorm.DB, id uint) (bool, error) {
+	res := db.Model(&AuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -22,7 +22,8 @@ var DB *gorm.DB
 //
 // Supported engines include: "sqlite", "postgres", "mysql", "sqlserver", "clickhouse".
 // It uses the GORM library to establish the connection and automatically migrates
-// the defined models (Organization, User, Group, Role, Policy, BackupCode).
+// the defined models (Organization, User, Group, Role, Policy, BackupCode, RefreshToken,
+// RevokedToken, SigningKey, OAuthClient, AuthorizationCode, ServiceAccount).
 //
 // Parameters:
 //   - engine: name of the database engine (e.g., "sqlite", "postgres")
@@ -54,6 +55,11 @@ func Init(engine, dsn string) *gorm.DB {
 		log.Fatalf("failed to connect to %s: %v | %s", engine, err, dsn)
 	}
 
+	// Invalidate cached policies whenever policies or their attachments change
+	if err := registerPolicyCacheInvalidation(DB); err != nil {
+		log.Fatalf("failed to register policy cache callbacks: %v", err)
+	}
+
 	// Automatically migrate database schemas for the core models
 	if err := DB.AutoMigrate(
 		&Organization{},
@@ -64,11 +70,29 @@ func Init(engine, dsn string) *gorm.DB {
 		&PolicyStatement{},
 		&PolicyAction{},
 		&PolicyResource{},
+		&PolicyCondition{},
 		&BackupCode{},
 		&LoginActivity{},
+		&RefreshToken{},
+		&RevokedToken{},
+		&SigningKey{},
+		&OAuthClient{},
+		&AuthorizationCode{},
+		&ServiceAccount{},
+		&PasswordResetToken{},
+		&EmailVerificationToken{},
+		&Invitation{},
+		&FederationState{},
+		&FederatedIdentity{},
+		&WebAuthnCredential{},
+		&WebAuthnSession{},
+		&EmailLoginToken{},
 	); err != nil {
 		log.Fatalf("auto migration failed: %v", err)
 	}
+	if err := migrateIndexes(DB); err != nil {
+		log.Fatalf("index migration failed: %v", err)
+	}
 
 	// will use DB in the db package only and return value in other packages
 	return DB
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailLoginToken stores a hashed, single-use passwordless login credential emailed to
+// a user: a short numeric code or a magic link.
+//
+// Fields:
+//   - UserID: foreign key to the user the token was issued to
+//   - Mode: "code" or "link"
+//   - CodeHash: bcrypt hash of the numeric code (code mode)
+//   - LinkHash: SHA-256 hash of the opaque link token (link mode)
+//   - Attempts: failed code entries; the code is invalidated at the attempt limit
+//   - DeviceID: optional device the refresh token is bound to
+//   - ExpiresAt: absolute expiry of the token
+//   - UsedAt: set when the token is redeemed, exhausted or superseded by a new one
+type EmailLoginToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	Mode      string `gorm:"not null"`
+	CodeHash  string
+	LinkHash  string `gorm:"index"`
+	Attempts  int
+	DeviceID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// ConsumeEmailLoginLink atomically redeems an unused, unexpired magic link.
+//
+// Returns gorm.ErrRecordNotFound if no such link exists, it has expired or it
+// was already used, including by a concurrent request.
+func ConsumeEmailLoginLink(db *gorm.DB, hash string) (*EmailLoginToken, error) {
+	var elt EmailLoginToken
+	if err := db.Where("link_hash = ? AND mode = ? AND used_at IS NULL AND expires_at > ?", hash, "link", time.Now()).
+		First(&elt).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&EmailLoginToken{}).
+		Where("id = ? AND used_at IS NULL", elt.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &elt, nil
+}
+
+// IssueEmailLoginToken stores elt as the only outstanding login code or link of its user,
+// unless the user was issued one less than interval ago.
+//
+// The last issue time of the user is claimed with a conditional update, so of concurrent
+// requests only one issues a token. Returns false if the user was issued one too recently.
+func IssueEmailLoginToken(db *gorm.DB, elt *EmailLoginToken, interval time.Duration) (bool, error) {
+	issued := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&User{}).
+			Where("id = ? AND (email_login_sent_at IS NULL OR email_login_sent_at <= ?)", elt.UserID, now.Add(-interval)).
+			Update("email_login_sent_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return nil
+		}
+
+		if err := InvalidateEmailLoginTokens(tx, elt.UserID); err != nil {
+			return err
+		}
+		if err := tx.Create(elt).Error; err != nil {
+			return err
+		}
+		issued = true
+		return nil
+	})
+	return issued, err
+}
+
+// InvalidateEmailLoginTokens marks every outstanding login code and link of a user as used.
+func InvalidateEmailLoginTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&EmailLoginToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerificationToken stores a hashed, single-use token emailed to a user to verify
+// their email address.
+//
+// Fields:
+//   - UserID: foreign key to the user the token was issued to
+//   - TokenHash: SHA-256 hash of the opaque token (the token itself is never stored)
+//   - Email: the address the token was sent to; it only verifies this address
+//   - Activation: redeeming the token also activates the account and sets its password
+//   - ExpiresAt: absolute expiry of the token
+//   - UsedAt: set when the token is redeemed (or superseded by a newer token)
+type EmailVerificationToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"index"`
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	Email      string
+	Activation bool
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+}
+
+// ConsumeEmailVerificationToken atomically redeems an unused, unexpired token.
+//
+// Returns gorm.ErrRecordNotFound if no such token exists, it has expired or it
+// was already used, including by a concurrent request.
+func ConsumeEmailVerificationToken(db *gorm.DB, hash string) (*EmailVerificationToken, error) {
+	var evt EmailVerificationToken
+	if err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, time.Now()).
+		First(&evt).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", evt.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &evt, nil
+}
+
+// InvalidateEmailVerificationTokens marks every outstanding verification token of a user as used.
+func InvalidateEmailVerificationTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+// PendingActivation reports whether a user has an unused activation token, expired or not,
+// i.e. the account was created by an administrator and has never been activated.
+func PendingActivation(db *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&EmailVerificationToken{}).
+		Where("user_id = ? AND activation = ? AND used_at IS NULL", userID, true).
+		Count(&count).Error
+	return count > 0, err
+}
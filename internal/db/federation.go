@@ -0,0 +1,67 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FederationState tracks a login at an upstream identity provider between the redirect
+// to the provider and its callback.
+//
+// Fields:
+//   - StateHash: SHA-256 hash of the state parameter (the state itself is never stored)
+//   - Provider: name of the auth provider the login was started with
+//   - Nonce: expected "nonce" claim of the id_token
+//   - CodeVerifier: PKCE verifier sent with the authorization code
+//   - DeviceID: optional device the refresh token is bound to
+//   - ExpiresAt: absolute expiry of the login attempt
+//   - UsedAt: set when the callback redeems the state
+type FederationState struct {
+	gorm.Model
+	StateHash    string `gorm:"uniqueIndex;not null"`
+	Provider     string `gorm:"not null"`
+	Nonce        string
+	CodeVerifier string
+	DeviceID     string
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+}
+
+// FederatedIdentity links a user to an account at an upstream identity provider.
+//
+// Fields:
+//   - UserID: foreign key to the linked user
+//   - Provider: name of the auth provider, e.g. "entra_id"
+//   - Subject: "sub" claim of the upstream account, unique per provider
+//   - Email: email of the upstream account when it was linked
+type FederatedIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	Provider string `gorm:"uniqueIndex:idx_provider_subject;not null"`
+	Subject  string `gorm:"uniqueIndex:idx_provider_subject;not null"`
+	Email    string
+}
+
+// ConsumeFederationState atomically redeems an unused, unexpired state of a provider.
+//
+// Returns gorm.ErrRecordNotFound if no such state exists, it has expired or it
+// was already used, including by a concurrent request.
+func ConsumeFederationState(db *gorm.DB, hash, provider string) (*FederationState, error) {
+	var fs FederationState
+	if err := db.Where("state_hash = ? AND provider = ? AND used_at IS NULL AND expires_at > ?", hash, provider, time.Now()).
+		First(&fs).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&FederationState{}).
+		Where("id = ? AND used_at IS NULL", fs.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &fs, nil
+}
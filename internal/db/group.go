@@ -16,7 +16,7 @@ type Group struct {
 	Name           string       `gorm:"not null;uniqueIndex:idx_org_group_name"` // Unique group name within the organization
 	Slug           string       `gorm:"uniqueIndex:idx_org_group_slug"`          // URL-safe identifier for routing or CLI use
 	Description    string       // Optional description for the group
-	OrganizationID uint         // Foreign key reference to the owning organization
+	OrganizationID uint         `gorm:"uniqueIndex:idx_org_group_name;uniqueIndex:idx_org_group_slug"` // Foreign key reference to the owning organization
 	Organization   Organization // GORM association to the organization
 
 	Users    []User   `gorm:"many2many:user_groups;"`    // Many-to-many relationship with users
@@ -2,70 +2,211 @@
 // including Group, Role, and Policy relationships used by the authentication and authorization system.
 package db
 
-// EvaluatePolicy determines whether a user is allowed to perform the specified action on the given resource.
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Decision is the outcome of evaluating a principal's policies for one action on one resource.
 //
-// It aggregates all policies assigned to the user directly, via groups, and via roles,
-// then evaluates their policy statements by checking matching actions, resources, and effects.
+// Fields:
+//   - Allowed: true if an "Allow" statement matched and no "Deny" statement did
+//   - Policy: the policy containing the deciding statement (nil if no statement matched)
+//   - Statement: the deciding statement, i.e. the matching "Deny" or the first matching "Allow"
+type Decision struct {
+	Allowed   bool
+	Policy    *Policy
+	Statement *PolicyStatement
+}
+
+// ExplainedStatement reports how a single statement matched a request.
+type ExplainedStatement struct {
+	StatementID     uint     `json:"statement_id"`
+	Effect          string   `json:"effect"`
+	Actions         []string `json:"actions"`
+	Resources       []string `json:"resources"`
+	Conditions      []string `json:"conditions"`
+	ActionMatch     bool     `json:"action_match"`
+	ResourceMatch   bool     `json:"resource_match"`
+	ConditionsMatch bool     `json:"conditions_match"`
+	Matched         bool     `json:"matched"`
+}
+
+// ExplainedPolicy reports a policy gathered for a principal, how it is attached,
+// and how each of its statements matched.
+type ExplainedPolicy struct {
+	PolicyID   uint                 `json:"policy_id"`
+	PolicyName string               `json:"policy_name"`
+	Sources    []string             `json:"sources"` // e.g. "direct", "group:admins", "role:auditor"
+	Statements []ExplainedStatement `json:"statements"`
+}
+
+// Explanation is the detailed trace of a policy evaluation produced by Explain.
+//
+// Fields:
+//   - Decision: the same decision Authorize returns
+//   - Policies: every policy gathered from direct, group and role attachments
+//   - ExplicitDeny: true if a matching "Deny" statement overrode any "Allow"
+type Explanation struct {
+	Decision     Decision
+	Policies     []ExplainedPolicy
+	ExplicitDeny bool
+}
+
+// EvaluatePolicy determines whether a principal (user or service account) is allowed
+// to perform the specified action on the given resource.
 //
+// Statement conditions are evaluated against ctx, which may be nil.
 // Returns true if an "Allow" policy applies and is not overridden by a matching "Deny".
-func EvaluatePolicy(user User, action string, resource string) bool {
-	// Gather all relevant policy IDs
-	policyIDs := map[uint]struct{}{}
+func EvaluatePolicy(principal Principal, action string, resource string, ctx RequestContext) bool {
+	return Authorize(principal, action, resource, ctx).Allowed
+}
+
+// Authorize evaluates the policies of a principal and returns the decision together
+// with the statement that produced it.
+func Authorize(principal Principal, action string, resource string, ctx RequestContext) Decision {
+	return evaluate(principal, action, resource, ctx, nil)
+}
+
+// Explain evaluates the policies of a principal like Authorize, but records every
+// gathered policy and how each statement matched, to debug denied requests.
+func Explain(principal Principal, action string, resource string, ctx RequestContext) Explanation {
+	var exp Explanation
+	exp.Decision = evaluate(principal, action, resource, ctx, &exp)
+	exp.ExplicitDeny = exp.Decision.Statement != nil && !exp.Decision.Allowed
+	return exp
+}
 
-	// User's direct policies
-	for _, p := range user.Policies {
-		policyIDs[p.ID] = struct{}{}
+// evaluate implements Authorize and Explain.
+//
+// It aggregates all policies assigned to the principal directly, via groups, and via roles,
+// then evaluates their policy statements by checking matching actions, resources, and effects.
+// Actions and resources are matched with MatchPattern, resolving policy variables such as
+// {user_id} in stored resources against the principal. Conditions are evaluated against
+// ctx extended with the principal's attributes. Policies are evaluated in ID order, so the reported statement is deterministic.
+// With a non-nil exp, evaluation does not stop at the first Deny and every statement is recorded.
+func evaluate(principal Principal, action string, resource string, ctx RequestContext, exp *Explanation) Decision {
+	// Gather all relevant policy IDs (direct, group and role policies)
+	attachments := map[uint][]PolicyAttachment{}
+	for _, a := range principal.PolicyAttachments() {
+		attachments[a.Policy.ID] = append(attachments[a.Policy.ID], a)
 	}
-	// Group policies
-	for _, g := range user.Groups {
-		for _, p := range g.Policies {
-			policyIDs[p.ID] = struct{}{}
-		}
+
+	// Policy variables in stored resources are resolved against the principal
+	vars := PolicyVariables(principal)
+
+	// Principal attributes cannot be overridden by the supplied context
+	condCtx := RequestContext{}
+	for k, v := range ctx {
+		condCtx[k] = v
 	}
-	// Role policies
-	for _, r := range user.Roles {
-		for _, p := range r.Policies {
-			policyIDs[p.ID] = struct{}{}
-		}
+	for k, v := range principal.ContextAttributes() {
+		condCtx[k] = v
 	}
 
 	// Track effective decision
-	allowed := false
+	var decision Decision
+	denied := false
 
-	for pid := range policyIDs {
-		var policy Policy
-		// Preload Actions and Resources for each statement
-		if err := DB.Preload("Statements.Actions").Preload("Statements.Resources").First(&policy, pid).Error; err != nil {
+	for _, pid := range slices.Sorted(maps.Keys(attachments)) {
+		// Compiled policies (statements with actions, resources and conditions) are cached
+		compiled, err := engine.policy(pid)
+		if err != nil {
 			continue
 		}
+		policy := compiled.policy
+
+		var explained *ExplainedPolicy
+		if exp != nil {
+			exp.Policies = append(exp.Policies, newExplainedPolicy(*policy, attachments[pid]))
+			explained = &exp.Policies[len(exp.Policies)-1]
+		}
+
+		for _, cs := range compiled.statements {
+			stmt := cs.stmt
 
-		for _, stmt := range policy.Statements {
 			actionMatch := false
-			for _, a := range stmt.Actions {
-				if a.Action == action || a.Action == "*" {
+			for _, a := range cs.actions {
+				if a.match(action, nil) {
 					actionMatch = true
 					break
 				}
 			}
 
 			resourceMatch := false
-			for _, r := range stmt.Resources {
-				if (r.Resource == resource || r.Resource == "*") && r.OrganizationID == user.OrganizationID {
+			for _, r := range cs.resources {
+				if r.orgID == principal.PrincipalOrgID() && r.pattern.match(resource, vars) {
 					resourceMatch = true
 					break
 				}
 			}
 
-			if actionMatch && resourceMatch {
+			// Conditions are only evaluated for statements that match otherwise
+			conditionsMatch := actionMatch && resourceMatch && conditionsHold(stmt.Conditions, condCtx)
+
+			if explained != nil {
+				explained.Statements = append(explained.Statements, newExplainedStatement(stmt, actionMatch, resourceMatch, conditionsMatch))
+			}
+
+			if conditionsMatch && !denied {
 				if stmt.Effect == "Deny" {
-					return false // Deny overrides everything
+					// Deny overrides everything
+					decision = Decision{Allowed: false, Policy: policy, Statement: stmt}
+					denied = true
+					if exp == nil {
+						return decision
+					}
 				}
-				if stmt.Effect == "Allow" {
-					allowed = true
+				if stmt.Effect == "Allow" && !decision.Allowed {
+					decision = Decision{Allowed: true, Policy: policy, Statement: stmt}
 				}
 			}
 		}
 	}
 
-	return allowed
+	return decision
+}
+
+// newExplainedPolicy describes a policy and the attachments it was gathered from.
+func newExplainedPolicy(policy Policy, attachments []PolicyAttachment) ExplainedPolicy {
+	ep := ExplainedPolicy{
+		PolicyID:   policy.ID,
+		PolicyName: policy.Name,
+		Statements: []ExplainedStatement{},
+	}
+	for _, a := range attachments {
+		source := a.Source
+		if a.Source != AttachedDirectly {
+			source += ":" + a.SourceName
+		}
+		ep.Sources = append(ep.Sources, source)
+	}
+	return ep
+}
+
+// newExplainedStatement describes how a statement matched.
+// conditionsMatch is only meaningful if the statement matched on action and resource.
+func newExplainedStatement(stmt *PolicyStatement, actionMatch, resourceMatch, conditionsMatch bool) ExplainedStatement {
+	es := ExplainedStatement{
+		StatementID:     stmt.ID,
+		Effect:          stmt.Effect,
+		Actions:         []string{},
+		Resources:       []string{},
+		Conditions:      []string{},
+		ActionMatch:     actionMatch,
+		ResourceMatch:   resourceMatch,
+		ConditionsMatch: conditionsMatch,
+		Matched:         conditionsMatch,
+	}
+	for _, a := range stmt.Actions {
+		es.Actions = append(es.Actions, a.Action)
+	}
+	for _, r := range stmt.Resources {
+		es.Resources = append(es.Resources, r.Resource)
+	}
+	for _, c := range stmt.Conditions {
+		es.Conditions = append(es.Conditions, fmt.Sprintf("%s %s %v", c.Operator, c.Key, c.Values))
+	}
+	return es
 }
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation is an emailed, single-use invitation to join an organization.
+//
+// Fields:
+//   - OrganizationID: the organization the invitee joins
+//   - Email: the address the invitation was sent to; it becomes the new user's email
+//   - TokenHash: SHA-256 hash of the opaque invitation token (the token itself is never stored)
+//   - InvitedByID: the user who sent the invitation
+//   - Roles, Groups: assigned to the user when the invitation is accepted
+//   - ExpiresAt: absolute expiry of the invitation
+//   - AcceptedAt, AcceptedUserID: set when the invitation is accepted
+//
+// Revoked invitations are soft-deleted.
+type Invitation struct {
+	gorm.Model
+	OrganizationID uint         `gorm:"index"`
+	Organization   Organization // GORM association
+	Email          string       `gorm:"not null"`
+	TokenHash      string       `gorm:"uniqueIndex;not null"`
+	InvitedByID    uint
+	Roles          []Role  `gorm:"many2many:invitation_roles;"`
+	Groups         []Group `gorm:"many2many:invitation_groups;"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	AcceptedUserID *uint
+}
+
+// ConsumeInvitation atomically redeems a pending, unexpired invitation and loads
+// its organization, roles and groups.
+//
+// Returns gorm.ErrRecordNotFound if no such invitation exists, it has expired,
+// was revoked or was already accepted, including by a concurrent request.
+func ConsumeInvitation(db *gorm.DB, hash string) (*Invitation, error) {
+	var inv Invitation
+	if err := db.Preload("Organization").Preload("Roles").Preload("Groups").
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", hash, time.Now()).
+		First(&inv).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL", inv.ID).
+		Update("accepted_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &inv, nil
+}
@@ -15,6 +15,9 @@ type LoginActivity struct {
 	// Username is the user's unique identifier at the time of login.
 	Username string
 
+	// OrganizationID is the organization the login was attempted in.
+	OrganizationID uint `gorm:"index"`
+
 	// IP is the IP address from which the login was performed.
 	IP string
 
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// organizationIndexes lists the unique indexes that were widened to include the
+// organization ID, so names and slugs are unique per organization rather than globally.
+//
+// AutoMigrate only creates missing indexes and never changes existing ones, so
+// databases created before the change still have the single-column index.
+var organizationIndexes = []struct {
+	model any
+	name  string
+}{
+	{&User{}, "idx_org_username"},
+	{&User{}, "idx_org_email"},
+	{&Group{}, "idx_org_group_name"},
+	{&Group{}, "idx_org_group_slug"},
+	{&Role{}, "idx_org_role_name"},
+	{&Role{}, "idx_org_role_slug"},
+	{&Policy{}, "idx_org_policy_name"},
+	{&Policy{}, "idx_org_policy_slug"},
+}
+
+// migrateIndexes drops and recreates every index in organizationIndexes whose
+// columns differ from the model definition.
+func migrateIndexes(db *gorm.DB) error {
+	// ClickHouse neither reports nor enforces unique indexes
+	if db.Dialector.Name() == "clickhouse" {
+		return nil
+	}
+
+	m := db.Session(&gorm.Session{Logger: quietLogger{db.Logger.LogMode(logger.Silent)}}).Migrator()
+	for _, idx := range organizationIndexes {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(idx.model); err != nil {
+			return err
+		}
+		want := stmt.Schema.LookIndex(idx.name)
+		if want == nil {
+			return fmt.Errorf("index %s is not defined on %s", idx.name, stmt.Schema.Name)
+		}
+
+		indexes, err := m.GetIndexes(idx.model)
+		if err != nil {
+			return fmt.Errorf("read indexes of %s: %w", stmt.Table, err)
+		}
+		for _, existing := range indexes {
+			if existing.Name() != idx.name || len(existing.Columns()) == len(want.Fields) {
+				continue
+			}
+			if err := m.DropIndex(idx.model, idx.name); err != nil {
+				return fmt.Errorf("drop index %s: %w", idx.name, err)
+			}
+			if err := m.CreateIndex(idx.model, idx.name); err != nil {
+				return fmt.Errorf("recreate index %s: %w", idx.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// quietLogger is a silent logger that stays silent in debug mode, as the SQLite
+// migrator reads indexes with Debug() and would log the queries on every start.
+type quietLogger struct {
+	logger.Interface
+}
+
+// LogMode ignores the requested level.
+func (l quietLogger) LogMode(logger.LogLevel) logger.Interface { return l }
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestInitWidensGlobalUniqueIndexes(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "iam.db")
+
+	// Recreate the indexes the way databases from before the change have them:
+	// unique on the first column alone
+	old := openQuiet(t, dsn)
+	for _, idx := range organizationIndexes {
+		stmt := &gorm.Statement{DB: old}
+		if err := stmt.Parse(idx.model); err != nil {
+			t.Fatal(err)
+		}
+		column := stmt.Schema.LookIndex(idx.name).Fields[0].DBName
+		if err := old.Migrator().DropIndex(idx.model, idx.name); err != nil {
+			t.Fatal(err)
+		}
+		if err := old.Exec("CREATE UNIQUE INDEX " + idx.name + " ON " + stmt.Table + " (" + column + ")").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeDB(t, old)
+
+	migrated := openQuiet(t, dsn)
+	defer closeDB(t, migrated)
+	for _, idx := range organizationIndexes {
+		stmt := &gorm.Statement{DB: migrated}
+		if err := stmt.Parse(idx.model); err != nil {
+			t.Fatal(err)
+		}
+		indexes, err := migrated.Migrator().GetIndexes(idx.model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, existing := range indexes {
+			if existing.Name() == idx.name {
+				found = true
+				if got, want := len(existing.Columns()), len(stmt.Schema.LookIndex(idx.name).Fields); got != want {
+					t.Errorf("%s has %d columns %v, want %d", idx.name, got, existing.Columns(), want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s is missing", idx.name)
+		}
+	}
+
+	// Usernames, emails and slugs can now repeat across organizations
+	for _, org := range []uint{1, 2} {
+		if err := migrated.Create(&Group{Name: "Ops", Slug: "ops", OrganizationID: org}).Error; err != nil {
+			t.Fatalf("group in organization %d: %v", org, err)
+		}
+		user := User{Username: "alice", Email: "alice@example.test", PasswordHash: "x", OrganizationID: org}
+		if err := migrated.Create(&user).Error; err != nil {
+			t.Fatalf("user in organization %d: %v", org, err)
+		}
+	}
+}
+
+// openQuiet initializes a SQLite database at dsn without query logging.
+func openQuiet(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db := Init("sqlite", dsn)
+	db.Logger = quietLogger{logger.Default.LogMode(logger.Silent)}
+	return db
+}
+
+func closeDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// OAuthClient is an application registered to obtain tokens from goIAM's
+// OpenID Connect provider. Each client belongs to one organization, and only
+// users of that organization can sign in to it.
+//
+// Fields:
+//   - ClientID: public identifier of the client
+//   - ClientSecretHash: SHA-256 hash of the client secret (empty for public clients)
+//   - Name: display name of the application
+//   - RedirectURIs: space-separated list of allowed redirect URIs (exact match)
+//   - Scopes: space-separated list of scopes the client may request
+//   - Public: public clients (SPAs, native apps) cannot keep a secret and rely on PKCE only
+type OAuthClient struct {
+	gorm.Model
+	ClientID         string `gorm:"uniqueIndex;not null"`
+	ClientSecretHash string
+	Name             string `gorm:"not null"`
+	RedirectURIs     string `gorm:"type:text"`
+	Scopes           string
+	Public           bool `gorm:"default:false"`
+	OrganizationID   uint `gorm:"index"`
+	Organization     Organization
+}
+
+// RedirectURIList returns the allowed redirect URIs as a slice.
+func (c OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the registered redirect URIs.
+func (c OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIList(), uri)
+}
+
+// AllowsScope reports whether the client may request the given scope.
+// A client without configured scopes may request any scope.
+func (c OAuthClient) AllowsScope(scope string) bool {
+	allowed := strings.Fields(c.Scopes)
+	return len(allowed) == 0 || slices.Contains(allowed, scope)
+}
+
+// GetOAuthClientByClientID retrieves a client by its public client ID.
+func GetOAuthClientByClientID(db *gorm.DB, clientID string) (*OAuthClient, error) {
+	var client OAuthClient
+	if err := db.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
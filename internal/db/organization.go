@@ -6,11 +6,20 @@ import "gorm.io/gorm"
 // It provides logical isolation for users, groups, roles, and policies.
 //
 // Slug is a short, URL-safe identifier used for subdomain-based routing
-// and stable human-readable identifiers in the API.
+// and stable human-readable identifiers in the API. A verified CustomDomain
+// routes to the organization as well.
 type Organization struct {
 	gorm.Model
 	Name        string `gorm:"uniqueIndex;not null"` // Unique organization name
 	Slug        string `gorm:"uniqueIndex;not null"` // Short, URL-safe identifier for subdomain and API routing
 	Description string // Optional description of the organization
-	Users       []User // Users in the organization
+
+	// Optional custom domain (e.g. "iam.acme.com") mapped to the organization once verified
+	CustomDomain            string `gorm:"index"`
+	CustomDomainVerified    bool   // Set once the DNS TXT record of the domain was checked
+	DomainVerificationToken string // Expected value of the _goiam-challenge TXT record
+
+	PasswordlessLogin bool // Users may log in with a code or link sent to their verified email
+
+	Users []User // Users in the organization
 }
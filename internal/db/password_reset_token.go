@@ -0,0 +1,52 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken stores a hashed, single-use token emailed to a user to reset their password.
+//
+// Fields:
+//   - UserID: foreign key to the user the token was issued to
+//   - TokenHash: SHA-256 hash of the opaque token (the token itself is never stored)
+//   - ExpiresAt: absolute expiry of the token
+//   - UsedAt: set when the token is redeemed (or superseded by a successful reset)
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// ConsumePasswordResetToken atomically redeems an unused, unexpired token.
+//
+// Returns gorm.ErrRecordNotFound if no such token exists, it has expired or it
+// was already used, including by a concurrent request.
+func ConsumePasswordResetToken(db *gorm.DB, hash string) (*PasswordResetToken, error) {
+	var prt PasswordResetToken
+	if err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, time.Now()).
+		First(&prt).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", prt.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &prt, nil
+}
+
+// InvalidatePasswordResetTokens marks every outstanding reset token of a user as used.
+func InvalidatePasswordResetTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -16,22 +16,24 @@ type Policy struct {
 	gorm.Model
 	Name           string `gorm:"not null;uniqueIndex:idx_org_policy_name"` // Unique within org
 	Slug           string `gorm:"uniqueIndex:idx_org_policy_slug"`          // Unique slug within organization
-	OrganizationID uint
+	OrganizationID uint   `gorm:"uniqueIndex:idx_org_policy_name;uniqueIndex:idx_org_policy_slug"`
 	Organization   Organization
 	Description    string
 	Statements     []PolicyStatement `gorm:"foreignKey:PolicyID"` // List of statements under this policy
 }
 
 // PolicyStatement represents a single rule inside a policy,
-// describing an effect ("Allow" or "Deny") and its related actions and resources.
+// describing an effect ("Allow" or "Deny"), its related actions and resources,
+// and optional conditions on the request context.
 type PolicyStatement struct {
 	gorm.Model
 	PolicyID uint
 	Policy   Policy
 	Effect   string // "Allow" or "Deny"
 
-	Actions   []PolicyAction   `gorm:"foreignKey:PolicyStatementID"`
-	Resources []PolicyResource `gorm:"foreignKey:PolicyStatementID"`
+	Actions    []PolicyAction    `gorm:"foreignKey:PolicyStatementID"`
+	Resources  []PolicyResource  `gorm:"foreignKey:PolicyStatementID"`
+	Conditions []PolicyCondition `gorm:"foreignKey:PolicyStatementID"` // All must hold for the statement to apply
 }
 
 // CreatePolicy inserts a new Policy into the database.
@@ -54,6 +56,7 @@ func GetPolicyByID(id uint) (*Policy, error) {
 	var policy Policy
 	err := DB.Preload("Statements.Actions").
 		Preload("Statements.Resources").
+		Preload("Statements.Conditions").
 		First(&policy, id).Error
 	if err != nil {
 		return nil, err
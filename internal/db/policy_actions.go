@@ -0,0 +1,65 @@
+package db
+
+import (
+	"slices"
+	"sync"
+)
+
+// builtinActions are the actions goIAM checks on its own API, by service.
+var builtinActions = map[string][]string{
+	"user": {"create", "read", "update", "delete", "activate", "deactivate",
+		"reset_password", "reset_2fa", "restore"},
+	"group": {"create", "read", "update", "delete", "add_member", "remove_member",
+		"attach_policy", "detach_policy"},
+	"role": {"create", "read", "update", "delete", "assign", "unassign",
+		"attach_policy", "detach_policy"},
+	"policy":          {"create", "read", "update", "delete", "simulate"},
+	"org":             {"read", "update"},
+	"invitation":      {"create", "read", "delete"},
+	"oauth_client":    {"create", "read", "delete"},
+	"service_account": {"create", "read", "update", "delete", "attach_policy", "detach_policy"},
+	"authz":           {"check"},
+}
+
+// actionCatalogue holds every known action as "service:verb": the built-in ones
+// and those registered for applications with RegisterActions.
+var actionCatalogue = struct {
+	sync.RWMutex
+	actions []string
+}{}
+
+func init() {
+	for service, verbs := range builtinActions {
+		RegisterActions(service, verbs...)
+	}
+}
+
+// RegisterActions adds the verbs of a service to the action catalogue, so policy
+// documents can use them, e.g. RegisterActions("invoice", "read", "list") for
+// an application authorizing "invoice:read" through /s/authz/check.
+func RegisterActions(service string, verbs ...string) {
+	actionCatalogue.Lock()
+	defer actionCatalogue.Unlock()
+	for _, verb := range verbs {
+		action := service + ":" + verb
+		if !slices.Contains(actionCatalogue.actions, action) {
+			actionCatalogue.actions = append(actionCatalogue.actions, action)
+		}
+	}
+}
+
+// knownAction reports whether an action pattern matches at least one action of the
+// catalogue, so misspelled actions such as "usr:reed" are rejected while patterns
+// like "user:*" or "*:read" are accepted.
+func knownAction(pattern string) bool {
+	p := compilePattern(pattern)
+
+	actionCatalogue.RLock()
+	defer actionCatalogue.RUnlock()
+	for _, action := range actionCatalogue.actions {
+		if p.match(action, nil) {
+			return true
+		}
+	}
+	return false
+}
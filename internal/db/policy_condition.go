@@ -0,0 +1,263 @@
+package db
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PolicyCondition restricts when a policy statement applies (AWS-style condition block).
+//
+// A statement only matches if all of its conditions hold. A condition holds if the
+// request context value for Key matches any of the Values; the negated operators
+// (NotIpAddress, StringNotEquals) hold if it matches none of them. A condition whose
+// key is missing from the context does not hold, except for the negated operators,
+// so that Deny statements such as "NotIpAddress source_ip 10.0.0.0/8" fail closed.
+// A missing "mfa" key counts as "false", so "Bool mfa false" Deny statements also
+// apply to contexts that do not mention MFA at all.
+//
+// Fields:
+//   - Operator: one of the Cond* operators
+//   - Key: the request context key, e.g. "source_ip", "mfa" or "user:email"
+//   - Values: operator-specific values, stored as a JSON array
+type PolicyCondition struct {
+	gorm.Model
+	PolicyStatementID uint
+	Operator          string   `gorm:"not null"`
+	Key               string   `gorm:"not null"`
+	Values            []string `gorm:"serializer:json"`
+}
+
+// Condition operators.
+const (
+	CondIPAddress        = "IpAddress"        // source IP is in one of the CIDRs (or equals one of the IPs)
+	CondNotIPAddress     = "NotIpAddress"     // source IP is in none of the CIDRs
+	CondTimeOfDayBetween = "TimeOfDayBetween" // time of day is within "HH:MM-HH:MM[ Zone]", may wrap midnight
+	CondDateBetween      = "DateBetween"      // time is within "START/END" (dates or RFC 3339 timestamps, inclusive)
+	CondBool             = "Bool"             // boolean value equals, e.g. "mfa" is "true"
+	CondStringEquals     = "StringEquals"     // value equals one of the values
+	CondStringNotEquals  = "StringNotEquals"  // value equals none of the values
+	CondStringPrefix     = "StringPrefix"     // value starts with one of the values
+)
+
+// Well-known request context keys. Principal attributes are added under the
+// "user:" prefix (e.g. "user:email") by the principal's ContextAttributes.
+const (
+	CtxSourceIP    = "source_ip"    // client IP address
+	CtxCurrentTime = "current_time" // RFC 3339 timestamp, defaults to the evaluation time
+	CtxMFA         = "mfa"          // "true" if the "2fa" claim of the token is set; "false" if missing
+)
+
+// RequestContext holds the attributes of a request that statement conditions are evaluated against.
+type RequestContext map[string]string
+
+// Validate checks that the operator is known and that every value can be parsed.
+func (c PolicyCondition) Validate() error {
+	if c.Key == "" {
+		return fmt.Errorf("condition %s: key is required", c.Operator)
+	}
+	if len(c.Values) == 0 {
+		return fmt.Errorf("condition %s %s: at least one value is required", c.Operator, c.Key)
+	}
+	for _, v := range c.Values {
+		var err error
+		switch c.Operator {
+		case CondIPAddress, CondNotIPAddress:
+			_, err = parseCIDR(v)
+		case CondTimeOfDayBetween:
+			_, _, _, err = parseTimeOfDayWindow(v)
+		case CondDateBetween:
+			_, _, err = parseDateWindow(v)
+		case CondBool:
+			_, err = strconv.ParseBool(v)
+		case CondStringEquals, CondStringNotEquals, CondStringPrefix:
+		default:
+			return fmt.Errorf("unknown condition operator %q", c.Operator)
+		}
+		if err != nil {
+			return fmt.Errorf("condition %s %s: invalid value %q: %w", c.Operator, c.Key, v, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate reports whether the condition holds for the request context.
+// Invalid values never match.
+func (c PolicyCondition) Evaluate(ctx RequestContext) bool {
+	actual, ok := ctx[c.Key]
+	if !ok && c.Key == CtxCurrentTime {
+		actual, ok = time.Now().Format(time.RFC3339), true
+	}
+	if !ok && c.Key == CtxMFA {
+		actual, ok = "false", true
+	}
+	if !ok {
+		return c.Operator == CondNotIPAddress || c.Operator == CondStringNotEquals
+	}
+
+	switch c.Operator {
+	case CondNotIPAddress:
+		return !anyValue(c.Values, func(v string) bool { return ipInCIDR(actual, v) })
+	case CondStringNotEquals:
+		return !anyValue(c.Values, func(v string) bool { return actual == v })
+	}
+
+	return anyValue(c.Values, func(v string) bool {
+		switch c.Operator {
+		case CondIPAddress:
+			return ipInCIDR(actual, v)
+		case CondTimeOfDayBetween:
+			return inTimeOfDayWindow(actual, v)
+		case CondDateBetween:
+			return inDateWindow(actual, v)
+		case CondBool:
+			a, err1 := strconv.ParseBool(actual)
+			b, err2 := strconv.ParseBool(v)
+			return err1 == nil && err2 == nil && a == b
+		case CondStringEquals:
+			return actual == v
+		case CondStringPrefix:
+			return strings.HasPrefix(actual, v)
+		default:
+			return false
+		}
+	})
+}
+
+// conditionsHold reports whether all conditions hold for the request context.
+func conditionsHold(conditions []PolicyCondition, ctx RequestContext) bool {
+	for _, c := range conditions {
+		if !c.Evaluate(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyValue reports whether match is true for any of the values.
+func anyValue(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDR parses a CIDR, or a single IP address as a host network.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("not an IP address or CIDR")
+		}
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	return network, err
+}
+
+// ipInCIDR reports whether ip is within the CIDR (or equals the IP) cidr.
+func ipInCIDR(ip, cidr string) bool {
+	addr := net.ParseIP(ip)
+	network, err := parseCIDR(cidr)
+	return addr != nil && err == nil && network.Contains(addr)
+}
+
+// parseTimeOfDayWindow parses "HH:MM-HH:MM" with an optional IANA time zone
+// ("09:00-17:00 Europe/Berlin"). Times are in minutes after midnight; UTC is the default zone.
+func parseTimeOfDayWindow(s string) (start, end int, loc *time.Location, err error) {
+	window, zone, _ := strings.Cut(strings.TrimSpace(s), " ")
+	loc = time.UTC
+	if zone != "" {
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, nil, fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	f, err := time.Parse("15:04", from)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	t, err := time.Parse("15:04", to)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return f.Hour()*60 + f.Minute(), t.Hour()*60 + t.Minute(), loc, nil
+}
+
+// inTimeOfDayWindow reports whether the RFC 3339 timestamp now falls within the window.
+// The start is inclusive and the end exclusive; windows such as "22:00-06:00" wrap midnight.
+func inTimeOfDayWindow(now, window string) bool {
+	t, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		return false
+	}
+	start, end, loc, err := parseTimeOfDayWindow(window)
+	if err != nil {
+		return false
+	}
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseDateWindow parses "START/END", each being a date (YYYY-MM-DD, UTC) or an RFC 3339
+// timestamp. Either side may be empty for an open window. A date as END includes the whole day.
+func parseDateWindow(s string) (start, end time.Time, err error) {
+	from, to, ok := strings.Cut(s, "/")
+	if !ok {
+		return start, end, fmt.Errorf("expected START/END")
+	}
+	if from != "" {
+		if start, err = parseDateOrTime(from, false); err != nil {
+			return start, end, err
+		}
+	}
+	if to != "" {
+		if end, err = parseDateOrTime(to, true); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// parseDateOrTime parses a date or an RFC 3339 timestamp. With endOfDay,
+// a date is extended to the last instant of that day.
+func parseDateOrTime(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// inDateWindow reports whether the RFC 3339 timestamp now falls within the window.
+func inDateWindow(now, window string) bool {
+	t, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		return false
+	}
+	start, end, err := parseDateWindow(window)
+	if err != nil {
+		return false
+	}
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+}
@@ -0,0 +1,25 @@
+package db
+
+import "testing"
+
+func TestConditionMissingKeyFailsClosedForDeny(t *testing.T) {
+	tests := []struct {
+		name string
+		cond PolicyCondition
+		ctx  RequestContext
+		want bool
+	}{
+		{"mfa missing counts as false", PolicyCondition{Operator: CondBool, Key: CtxMFA, Values: []string{"false"}}, RequestContext{}, true},
+		{"mfa missing does not satisfy true", PolicyCondition{Operator: CondBool, Key: CtxMFA, Values: []string{"true"}}, RequestContext{}, false},
+		{"mfa false", PolicyCondition{Operator: CondBool, Key: CtxMFA, Values: []string{"false"}}, RequestContext{CtxMFA: "false"}, true},
+		{"mfa true", PolicyCondition{Operator: CondBool, Key: CtxMFA, Values: []string{"false"}}, RequestContext{CtxMFA: "true"}, false},
+		{"other bool key missing", PolicyCondition{Operator: CondBool, Key: "user:email_verified", Values: []string{"false"}}, RequestContext{}, false},
+		{"source_ip missing, NotIpAddress holds", PolicyCondition{Operator: CondNotIPAddress, Key: CtxSourceIP, Values: []string{"10.0.0.0/8"}}, RequestContext{}, true},
+		{"source_ip missing, IpAddress fails", PolicyCondition{Operator: CondIPAddress, Key: CtxSourceIP, Values: []string{"10.0.0.0/8"}}, RequestContext{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cond.Evaluate(tt.ctx); got != tt.want {
+			t.Errorf("%s: Evaluate = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
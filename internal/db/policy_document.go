@@ -0,0 +1,211 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PolicyDocument is the JSON representation of the statements of a policy,
+// modeled after AWS IAM policy documents:
+//
+//	{
+//	  "Statement": [{
+//	    "Effect": "Allow",
+//	    "Action": ["invoice:read", "invoice:list"],
+//	    "Resource": "org:{org_id}:invoice:*",
+//	    "Condition": {"IpAddress": {"source_ip": ["10.0.0.0/8"]}}
+//	  }]
+//	}
+//
+// Documents are translated to and from the normalized PolicyStatement, PolicyAction,
+// PolicyResource and PolicyCondition rows.
+type PolicyDocument struct {
+	Statement []StatementDocument `json:"Statement"`
+}
+
+// StatementDocument is a single statement of a PolicyDocument.
+// Condition maps an operator to context keys and their values.
+type StatementDocument struct {
+	Effect    string                           `json:"Effect"`
+	Action    StringList                       `json:"Action"`
+	Resource  StringList                       `json:"Resource"`
+	Condition map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+// StringList is a list of strings that can also be written as a single JSON string.
+type StringList []string
+
+// UnmarshalJSON accepts a JSON string or an array of strings.
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*l = StringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// actionSegment is the allowed syntax of an action segment, e.g. "user", "read" or "get*".
+var actionSegment = regexp.MustCompile(`^[A-Za-z0-9_\-*?]+$`)
+
+// NewPolicyDocument builds the document of a policy with preloaded statements,
+// actions, resources and conditions.
+func NewPolicyDocument(policy Policy) PolicyDocument {
+	doc := PolicyDocument{Statement: []StatementDocument{}}
+	for _, stmt := range policy.Statements {
+		sd := StatementDocument{Effect: stmt.Effect, Action: StringList{}, Resource: StringList{}}
+		for _, a := range stmt.Actions {
+			sd.Action = append(sd.Action, a.Action)
+		}
+		for _, r := range stmt.Resources {
+			sd.Resource = append(sd.Resource, r.Resource)
+		}
+		for _, c := range stmt.Conditions {
+			if sd.Condition == nil {
+				sd.Condition = map[string]map[string]StringList{}
+			}
+			if sd.Condition[c.Operator] == nil {
+				sd.Condition[c.Operator] = map[string]StringList{}
+			}
+			sd.Condition[c.Operator][c.Key] = append(sd.Condition[c.Operator][c.Key], c.Values...)
+		}
+		doc.Statement = append(doc.Statement, sd)
+	}
+	return doc
+}
+
+// Validate checks that the document has at least one statement, that every statement
+// has a known effect and at least one action and resource, that actions and resources
+// are valid patterns, and that every condition can be evaluated.
+func (d PolicyDocument) Validate() error {
+	if len(d.Statement) == 0 {
+		return fmt.Errorf("policy document must contain at least one statement")
+	}
+	for i, sd := range d.Statement {
+		if sd.Effect != "Allow" && sd.Effect != "Deny" {
+			return fmt.Errorf("statement %d: Effect must be \"Allow\" or \"Deny\"", i)
+		}
+		if len(sd.Action) == 0 {
+			return fmt.Errorf("statement %d: at least one Action is required", i)
+		}
+		if len(sd.Resource) == 0 {
+			return fmt.Errorf("statement %d: at least one Resource is required", i)
+		}
+		for _, a := range sd.Action {
+			if err := validateAction(a); err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+		for _, r := range sd.Resource {
+			if err := validateResource(r); err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+		for _, c := range sd.conditions() {
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Statements translates the document into normalized statements whose resources
+// are scoped to orgID. The document should be validated first.
+func (d PolicyDocument) Statements(orgID uint) []PolicyStatement {
+	stmts := make([]PolicyStatement, 0, len(d.Statement))
+	for _, sd := range d.Statement {
+		stmt := PolicyStatement{Effect: sd.Effect, Conditions: sd.conditions()}
+		for _, a := range sd.Action {
+			stmt.Actions = append(stmt.Actions, PolicyAction{Action: a})
+		}
+		for _, r := range sd.Resource {
+			stmt.Resources = append(stmt.Resources, PolicyResource{Resource: r, OrganizationID: orgID})
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// conditions flattens the condition block into PolicyConditions, ordered by operator and key.
+func (sd StatementDocument) conditions() []PolicyCondition {
+	var conditions []PolicyCondition
+	for _, op := range slices.Sorted(maps.Keys(sd.Condition)) {
+		for _, key := range slices.Sorted(maps.Keys(sd.Condition[op])) {
+			conditions = append(conditions, PolicyCondition{Operator: op, Key: key, Values: sd.Condition[op][key]})
+		}
+	}
+	return conditions
+}
+
+// ReplacePolicyStatements deletes the statements of a policy, with their actions,
+// resources and conditions, and creates stmts in their place. Run it in a transaction
+// so the policy is never observed without statements.
+func ReplacePolicyStatements(tx *gorm.DB, policy *Policy, stmts []PolicyStatement) error {
+	old := tx.Model(&PolicyStatement{}).Select("id").Where("policy_id = ?", policy.ID)
+	for _, model := range []any{&PolicyAction{}, &PolicyResource{}, &PolicyCondition{}} {
+		if err := tx.Unscoped().Where("policy_statement_id IN (?)", old).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where("policy_id = ?", policy.ID).Delete(&PolicyStatement{}).Error; err != nil {
+		return err
+	}
+
+	for i := range stmts {
+		stmts[i].PolicyID = policy.ID
+	}
+	if len(stmts) > 0 {
+		if err := tx.Omit("Policy").Create(&stmts).Error; err != nil {
+			return err
+		}
+	}
+	policy.Statements = stmts
+	return nil
+}
+
+// validateAction checks that an action is "*" or colon-separated segments of
+// letters, digits, "_", "-" and wildcards, e.g. "user:read" or "invoice:*", and
+// that it matches at least one action of the catalogue (see RegisterActions).
+func validateAction(action string) error {
+	for _, seg := range strings.Split(action, ":") {
+		if !actionSegment.MatchString(seg) {
+			return fmt.Errorf("invalid action %q", action)
+		}
+	}
+	if !knownAction(action) {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return nil
+}
+
+// validateResource checks that a resource pattern has no empty segments, that every
+// segment is a valid glob, and that it only uses known policy variables.
+func validateResource(resource string) error {
+	for _, seg := range strings.Split(resource, ":") {
+		if seg == "" {
+			return fmt.Errorf("invalid resource %q: empty segment", resource)
+		}
+		for _, v := range []string{VarOrgID, VarUserID, VarUsername} {
+			seg = strings.ReplaceAll(seg, v, "x")
+		}
+		if strings.ContainsAny(seg, "{}") {
+			return fmt.Errorf("invalid resource %q: unknown policy variable", resource)
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid resource %q: %w", resource, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import "testing"
+
+func TestValidateActionChecksCatalogue(t *testing.T) {
+	RegisterActions("invoice", "read", "list")
+
+	tests := []struct {
+		action string
+		valid  bool
+	}{
+		{"*", true},
+		{"user:read", true},
+		{"user:*", true},
+		{"user:re*", true},
+		{"*:read", true},
+		{"service_account:attach_policy", true},
+		{"invoice:list", true},
+		{"invoice:*", true},
+		{"usr:reed", false},
+		{"user:reed", false},
+		{"usr:*", false},
+		{"invoice:delete", false},
+		{"user", false},
+		{"user:read:extra", false},
+		{"user:", false},
+	}
+	for _, tt := range tests {
+		err := validateAction(tt.action)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateAction(%q) = %v, want valid %t", tt.action, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// policyCacheTables lists the tables whose changes invalidate the policy cache:
+// policy documents, groups and roles, and every attachment or membership join table.
+var policyCacheTables = map[string]struct{}{
+	"policies":                 {},
+	"policy_statements":        {},
+	"policy_actions":           {},
+	"policy_resources":         {},
+	"policy_conditions":        {},
+	"groups":                   {},
+	"roles":                    {},
+	"user_groups":              {},
+	"user_roles":               {},
+	"user_policies":            {},
+	"group_policies":           {},
+	"role_policies":            {},
+	"service_account_groups":   {},
+	"service_account_roles":    {},
+	"service_account_policies": {},
+}
+
+// compiledStatement is a policy statement with its action and resource patterns pre-parsed.
+type compiledStatement struct {
+	stmt      *PolicyStatement
+	actions   []globPattern
+	resources []compiledResource
+}
+
+// compiledResource is a resource pattern and the organization it is scoped to.
+type compiledResource struct {
+	pattern globPattern
+	orgID   uint
+}
+
+// compiledPolicy is a policy with all statements compiled for evaluation.
+type compiledPolicy struct {
+	policy     *Policy
+	statements []compiledStatement
+}
+
+// cachedEntry wraps a cached value with the cache version and time it was loaded at.
+type cachedEntry[T any] struct {
+	value    T
+	version  uint64
+	loadedAt time.Time
+}
+
+// maxCachedAttachments bounds the number of principals whose attachments are cached.
+const maxCachedAttachments = 10000
+
+// policyEngine caches compiled policies and the policy attachments of principals.
+//
+// Every committed write to a table in policyCacheTables made through GORM bumps the
+// version, which invalidates all entries. Entries also expire after ttl, so changes
+// made by other goIAM instances sharing the database are picked up.
+type policyEngine struct {
+	version atomic.Uint64
+	ttl     atomic.Int64 // time.Duration; 0 disables expiry
+
+	mu          sync.RWMutex
+	policies    map[uint]cachedEntry[*compiledPolicy]
+	attachments map[string]cachedEntry[[]PolicyAttachment]
+}
+
+// engine is the process-wide policy engine used by EvaluatePolicy.
+var engine = &policyEngine{
+	policies:    map[uint]cachedEntry[*compiledPolicy]{},
+	attachments: map[string]cachedEntry[[]PolicyAttachment]{},
+}
+
+func init() {
+	engine.ttl.Store(int64(time.Minute))
+}
+
+// SetPolicyCacheTTL sets how long compiled policies and policy attachments are cached.
+// A TTL of 0 keeps entries until a local change invalidates them.
+func SetPolicyCacheTTL(ttl time.Duration) {
+	engine.ttl.Store(int64(ttl))
+}
+
+// InvalidatePolicyCache drops every cached policy and attachment.
+//
+// It is called automatically for writes made through GORM outside an explicit
+// transaction; use PolicyTransaction for transactions, and call it after
+// changing policy tables by other means.
+func InvalidatePolicyCache() {
+	engine.version.Add(1)
+	engine.mu.Lock()
+	clear(engine.policies)
+	clear(engine.attachments)
+	engine.mu.Unlock()
+}
+
+// PolicyTransaction runs fc in a transaction like gorm.DB.Transaction and invalidates
+// the policy cache once the transaction has committed or rolled back.
+//
+// The callbacks invalidate the cache as soon as a statement runs, which inside a
+// transaction is before its changes are visible to other connections: a policy
+// evaluation in between would cache the old rows under the new version. Use it for
+// every transaction that changes a table in policyCacheTables.
+func PolicyTransaction(db *gorm.DB, fc func(tx *gorm.DB) error) error {
+	err := db.Transaction(fc)
+	InvalidatePolicyCache()
+	return err
+}
+
+// registerPolicyCacheInvalidation installs GORM callbacks that invalidate the
+// policy cache whenever a policy, group, role, attachment or membership changes.
+//
+// The callbacks run after GORM commits its default per-statement transaction;
+// explicit transactions are handled by PolicyTransaction. Raw statements cannot
+// be attributed to a table and always invalidate.
+func registerPolicyCacheInvalidation(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if _, ok := policyCacheTables[tx.Statement.Table]; ok {
+			InvalidatePolicyCache()
+		}
+	}
+
+	const committed = "gorm:commit_or_rollback_transaction"
+	cb := db.Callback()
+	if err := cb.Create().After(committed).Register("iam:invalidate_policy_cache", invalidate); err != nil {
+		return err
+	}
+	if err := cb.Update().After(committed).Register("iam:invalidate_policy_cache", invalidate); err != nil {
+		return err
+	}
+	if err := cb.Delete().After(committed).Register("iam:invalidate_policy_cache", invalidate); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("iam:invalidate_policy_cache", func(tx *gorm.DB) {
+		if tx.Error == nil {
+			InvalidatePolicyCache()
+		}
+	})
+}
+
+// fresh reports whether a cache entry is still valid.
+func (e *policyEngine) fresh(version uint64, loadedAt time.Time) bool {
+	if version != e.version.Load() {
+		return false
+	}
+	ttl := time.Duration(e.ttl.Load())
+	return ttl == 0 || time.Since(loadedAt) < ttl
+}
+
+// policy returns the compiled policy with the given ID, loading it on a cache miss.
+func (e *policyEngine) policy(id uint) (*compiledPolicy, error) {
+	e.mu.RLock()
+	entry, ok := e.policies[id]
+	e.mu.RUnlock()
+	if ok && e.fresh(entry.version, entry.loadedAt) {
+		return entry.value, nil
+	}
+
+	version := e.version.Load()
+	var policy Policy
+	if err := DB.Preload("Statements.Actions").Preload("Statements.Resources").Preload("Statements.Conditions").
+		First(&policy, id).Error; err != nil {
+		return nil, err
+	}
+	compiled := compilePolicy(&policy)
+
+	e.mu.Lock()
+	e.policies[id] = cachedEntry[*compiledPolicy]{value: compiled, version: version, loadedAt: time.Now()}
+	e.mu.Unlock()
+	return compiled, nil
+}
+
+// storeAttachments caches the attachments of a principal. When the cache is full,
+// stale entries are pruned first, and if that is not enough the cache is emptied.
+func (e *policyEngine) storeAttachments(key string, entry cachedEntry[[]PolicyAttachment]) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.attachments[key]; !ok && len(e.attachments) >= maxCachedAttachments {
+		for k, cached := range e.attachments {
+			if !e.fresh(cached.version, cached.loadedAt) {
+				delete(e.attachments, k)
+			}
+		}
+		if len(e.attachments) >= maxCachedAttachments {
+			clear(e.attachments)
+		}
+	}
+	e.attachments[key] = entry
+}
+
+// compilePolicy pre-parses the action and resource patterns of every statement.
+func compilePolicy(policy *Policy) *compiledPolicy {
+	cp := &compiledPolicy{policy: policy}
+	for i := range policy.Statements {
+		stmt := &policy.Statements[i]
+		cs := compiledStatement{stmt: stmt}
+		for _, a := range stmt.Actions {
+			cs.actions = append(cs.actions, compilePattern(a.Action))
+		}
+		for _, r := range stmt.Resources {
+			cs.resources = append(cs.resources, compiledResource{pattern: compilePattern(r.Resource), orgID: r.OrganizationID})
+		}
+		cp.statements = append(cp.statements, cs)
+	}
+	return cp
+}
+
+// LoadPrincipalPolicies returns the principal with its directly attached policies,
+// groups and roles (each with their policies) populated, ready for EvaluatePolicy.
+//
+// Attachments are served from the policy cache and only loaded from the database
+// on a miss. Principals other than User and ServiceAccount are returned unchanged.
+func LoadPrincipalPolicies(db *gorm.DB, principal Principal) (Principal, error) {
+	key := fmt.Sprintf("%s:%d", principal.PrincipalType(), principal.PrincipalID())
+
+	engine.mu.RLock()
+	entry, ok := engine.attachments[key]
+	engine.mu.RUnlock()
+
+	attachments := entry.value
+	if !ok || !engine.fresh(entry.version, entry.loadedAt) {
+		version := engine.version.Load()
+		loaded, err := LoadPrincipal(db, principal.PrincipalType(), principal.PrincipalID(), principal.PrincipalOrgID())
+		if err != nil {
+			return nil, err
+		}
+		attachments = loaded.PolicyAttachments()
+
+		engine.storeAttachments(key, cachedEntry[[]PolicyAttachment]{value: attachments, version: version, loadedAt: time.Now()})
+	}
+
+	policies, groups, roles := splitAttachments(attachments)
+	switch p := principal.(type) {
+	case User:
+		p.Policies, p.Groups, p.Roles = policies, groups, roles
+		return p, nil
+	case ServiceAccount:
+		p.Policies, p.Groups, p.Roles = policies, groups, roles
+		return p, nil
+	default:
+		return principal, nil
+	}
+}
+
+// splitAttachments rebuilds the direct policies, groups and roles of a principal
+// from its attachments (the inverse of collectPolicies).
+func splitAttachments(attachments []PolicyAttachment) ([]Policy, []Group, []Role) {
+	var policies []Policy
+	var groups []Group
+	var roles []Role
+	groupIndex := map[uint]int{}
+	roleIndex := map[uint]int{}
+
+	for _, a := range attachments {
+		switch a.Source {
+		case AttachedDirectly:
+			policies = append(policies, a.Policy)
+		case AttachedViaGroup:
+			i, ok := groupIndex[a.SourceID]
+			if !ok {
+				i = len(groups)
+				groupIndex[a.SourceID] = i
+				groups = append(groups, Group{Model: gorm.Model{ID: a.SourceID}, Name: a.SourceName})
+			}
+			groups[i].Policies = append(groups[i].Policies, a.Policy)
+		case AttachedViaRole:
+			i, ok := roleIndex[a.SourceID]
+			if !ok {
+				i = len(roles)
+				roleIndex[a.SourceID] = i
+				roles = append(roles, Role{Model: gorm.Model{ID: a.SourceID}, Name: a.SourceName})
+			}
+			roles[i].Policies = append(roles[i].Policies, a.Policy)
+		}
+	}
+	return policies, groups, roles
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy variables that can be used in stored resource patterns. They are
+// resolved against the principal being authorized.
+const (
+	VarOrgID    = "{org_id}"
+	VarUserID   = "{user_id}"
+	VarUsername = "{username}"
+)
+
+// PolicyVariables returns the values of the policy variables for a principal.
+// For service accounts, {user_id} and {username} resolve to the service account ID and name.
+func PolicyVariables(principal Principal) map[string]string {
+	return map[string]string{
+		VarOrgID:    fmt.Sprint(principal.PrincipalOrgID()),
+		VarUserID:   fmt.Sprint(principal.PrincipalID()),
+		VarUsername: principal.PrincipalName(),
+	}
+}
+
+// MatchPattern reports whether an action or resource matches a policy pattern.
+//
+// Patterns are matched segment by segment, segments being separated by ":":
+//   - "*" on its own matches everything
+//   - inside a segment, "*" matches any characters and "?" a single character,
+//     but never a ":" (e.g. "user:*" matches "user:read", "org:42:user:a*" matches "org:42:user:alice")
+//   - a trailing "*" segment matches one or more remaining segments
+//     (e.g. "org:42:*" matches "org:42:user:7" and "org:42:user:7:password")
+//
+// Variables in vars (see PolicyVariables) are substituted per segment before matching;
+// their values are escaped, so a username can never act as a wildcard.
+func MatchPattern(pattern, value string, vars map[string]string) bool {
+	return compilePattern(pattern).match(value, vars)
+}
+
+// globPattern is a pattern pre-split into segments, so it can be matched
+// repeatedly without re-parsing (see MatchPattern for the syntax).
+type globPattern struct {
+	any      bool     // the pattern is "*"
+	segs     []string // pattern segments, variables not yet substituted
+	literal  []bool   // segment contains neither wildcards nor variables
+	trailing bool     // the last segment is "*"
+}
+
+// compilePattern splits a pattern into segments and classifies them.
+func compilePattern(pattern string) globPattern {
+	if pattern == "*" {
+		return globPattern{any: true}
+	}
+	p := globPattern{segs: strings.Split(pattern, ":")}
+	p.literal = make([]bool, len(p.segs))
+	for i, seg := range p.segs {
+		p.literal[i] = !strings.ContainsAny(seg, `*?[\{`)
+	}
+	p.trailing = p.segs[len(p.segs)-1] == "*"
+	return p
+}
+
+// match reports whether value matches the compiled pattern.
+func (p globPattern) match(value string, vars map[string]string) bool {
+	if p.any {
+		return true
+	}
+
+	valueSegs := strings.Split(value, ":")
+
+	for i, seg := range p.segs {
+		if p.trailing && i == len(p.segs)-1 {
+			return len(valueSegs) > i
+		}
+		if i >= len(valueSegs) {
+			return false
+		}
+		if p.literal[i] {
+			if seg != valueSegs[i] {
+				return false
+			}
+			continue
+		}
+		if ok, err := path.Match(substituteVariables(seg, vars), valueSegs[i]); err != nil || !ok {
+			return false
+		}
+	}
+
+	return len(p.segs) == len(valueSegs)
+}
+
+// substituteVariables replaces policy variables in a pattern segment with their
+// escaped values.
+func substituteVariables(seg string, vars map[string]string) string {
+	if !strings.Contains(seg, "{") {
+		return seg
+	}
+	for name, value := range vars {
+		seg = strings.ReplaceAll(seg, name, escapeGlob(value))
+	}
+	return seg
+}
+
+// escapeGlob escapes the characters path.Match treats as special.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(s)
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken stores a hashed, single-use refresh token issued to a user on a device.
+//
+// Every successful login starts a new token family. Each time a refresh token is used,
+// it is marked as used and replaced by a new token in the same family. Presenting a
+// token that was already used (or revoked) is treated as token theft, and the whole
+// family is revoked.
+//
+// Fields:
+//   - UserID: foreign key to the user the token was issued to
+//   - FamilyID: identifier shared by every token rotated from the same login
+//   - TokenHash: SHA-256 hash of the opaque token (the token itself is never stored)
+//   - DeviceID: client-supplied device identifier the token is bound to (optional)
+//   - TwoFA: whether the originating login satisfied 2FA
+//   - ClientID, Scope: OAuth client and scope for tokens issued via /oauth2/token
+//   - ExpiresAt: absolute expiry of this token
+//   - UsedAt: set when the token is rotated
+//   - RevokedAt: set when the token (or its family) is revoked
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	FamilyID  string `gorm:"index;not null"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	DeviceID  string
+	UserAgent string
+	IP        string
+	TwoFA     bool
+	ClientID  string `gorm:"index"`
+	Scope     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// FindRefreshTokenByHash retrieves a refresh token by the hash of its value.
+func FindRefreshTokenByHash(db *gorm.DB, hash string) (*RefreshToken, error) {
+	var rt RefreshToken
+	if err := db.Where("token_hash = ?", hash).First(&rt).Error; err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// MarkRefreshTokenUsed atomically marks an unused token as used.
+//
+// Returns false if the token had already been used by a concurrent request,
+// which callers must treat as reuse.
+func MarkRefreshTokenUsed(db *gorm.DB, id uint) (bool, error) {
+	res := db.Model(&RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every active token that belongs to the given family.
+func RevokeRefreshTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserRefreshTokens revokes every active refresh token issued to the given user.
+func RevokeUserRefreshTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedToken records the ID (jti) of an access token that was revoked before its expiry.
+//
+// Entries are only needed until the token would have expired anyway, after which they
+// can be purged with PurgeExpiredRevokedTokens.
+type RevokedToken struct {
+	gorm.Model
+	JTI       string `gorm:"uniqueIndex;not null"` // JWT ID of the revoked token
+	UserID    uint   `gorm:"index"`                // owner of the token
+	ExpiresAt time.Time
+}
+
+// RevokeToken adds a token ID to the revocation list until the given expiry.
+func RevokeToken(db *gorm.DB, jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	return db.Where(RevokedToken{JTI: jti}).
+		FirstOrCreate(&RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}).Error
+}
+
+// IsTokenRevoked reports whether the given token ID is on the revocation list.
+func IsTokenRevoked(db *gorm.DB, jti string) (bool, error) {
+	var count int64
+	err := db.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// PurgeExpiredRevokedTokens permanently removes revocation entries for tokens that have expired.
+func PurgeExpiredRevokedTokens(db *gorm.DB) error {
+	return db.Unscoped().Where("expires_at < ?", time.Now()).Delete(&RevokedToken{}).Error
+}
+
+// TokensValidAfterNow returns the current time as new value of User.TokensValidAfter or
+// ServiceAccount.TokensValidAfter.
+//
+// It is kept at full precision and compared with the millisecond "iat" claim, so tokens
+// issued earlier in the same second are rejected and tokens issued right after a
+// logout-all or password reset are not.
+func TokensValidAfterNow() time.Time {
+	return time.Now()
+}
+
+// RevokeAllUserTokens invalidates every access and refresh token issued to the user so far.
+//
+// Access tokens issued before now are rejected by RequireAuth based on
+// User.TokensValidAfter; refresh tokens are revoked in the database.
+func RevokeAllUserTokens(db *gorm.DB, userID uint) error {
+	if err := db.Model(&User{}).Where("id = ?", userID).
+		Update("tokens_valid_after", TokensValidAfterNow()).Error; err != nil {
+		return err
+	}
+	return RevokeUserRefreshTokens(db, userID)
+}
@@ -19,7 +19,7 @@ type Role struct {
 	Name           string `gorm:"not null;uniqueIndex:idx_org_role_name"` // Unique within org
 	Slug           string `gorm:"uniqueIndex:idx_org_role_slug"`          // Unique slug within organization
 	Description    string // Optional role description
-	OrganizationID uint
+	OrganizationID uint   `gorm:"uniqueIndex:idx_org_role_name;uniqueIndex:idx_org_role_slug"`
 	Organization   Organization
 	Users          []User   `gorm:"many2many:user_roles;"`
 	Policies       []Policy `gorm:"many2many:role_policies;"`
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/google/uuid"
 	"github.com/javadmohebbi/goIAM/internal/db"
 	"gorm.io/gorm"
 )
@@ -67,10 +66,10 @@ func SeedDefaultPoliciesForOrg(orgID uint, dbConn *gorm.DB) error {
 					{Action: "user:read"},
 					{Action: "user:update"},
 				},
-				Resources: []db.PolicyResource{{
-					Resource:       "org:{org_id}:user:{user_id}",
-					OrganizationID: orgID,
-				}},
+				Resources: []db.PolicyResource{
+					{Resource: "org:{org_id}:user:{user_id}", OrganizationID: orgID},
+					{Resource: "org:{org_id}:user:{user_id}:*", OrganizationID: orgID},
+				},
 			}},
 		},
 	}
@@ -87,10 +86,10 @@ func SeedDefaultPoliciesForOrg(orgID uint, dbConn *gorm.DB) error {
 			return fmt.Errorf("db error: %w", err)
 		}
 
-		// If policy doesn't exist, construct a new one with a unique slug and attach statements.
+		// If policy doesn't exist, construct a new one and attach statements.
 		newPolicy := db.Policy{
 			Name:           tpl.Name,
-			Slug:           tpl.Slug + "-" + uuid.New().String()[:6],
+			Slug:           tpl.Slug,
 			Description:    tpl.Description,
 			OrganizationID: orgID,
 			Statements:     tpl.Statements,
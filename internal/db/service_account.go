@@ -0,0 +1,72 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ServiceAccount is a non-human principal (backend job, daemon, CI pipeline)
+// owned by an organization.
+//
+// Service accounts authenticate with a client ID and secret using the OAuth2
+// client_credentials grant. Like users, they receive access through directly
+// attached policies, groups and roles, so EvaluatePolicy treats both the same way.
+//
+// Fields:
+//   - Name: unique within the organization
+//   - ClientID: public identifier used as the OAuth2 client_id
+//   - ClientSecretHash: SHA-256 hash of the client secret (the secret itself is never stored)
+//   - IsActive: disabled service accounts cannot obtain or use tokens
+//   - Groups, Roles, and Policies are used for access control (many-to-many)
+//   - TokensValidAfter invalidates every access token issued before it
+type ServiceAccount struct {
+	gorm.Model
+	Name             string `gorm:"not null;uniqueIndex:idx_org_service_account_name"`
+	Description      string
+	ClientID         string `gorm:"uniqueIndex;not null"`
+	ClientSecretHash string `gorm:"not null"`
+	IsActive         bool   `gorm:"default:true"`
+	OrganizationID   uint   `gorm:"uniqueIndex:idx_org_service_account_name"`
+	Organization     Organization
+
+	Groups   []Group  `gorm:"many2many:service_account_groups;"`
+	Roles    []Role   `gorm:"many2many:service_account_roles;"`
+	Policies []Policy `gorm:"many2many:service_account_policies;"`
+
+	TokensValidAfter *time.Time
+}
+
+// GetServiceAccountByClientID retrieves a service account by its client ID.
+func GetServiceAccountByClientID(db *gorm.DB, clientID string) (*ServiceAccount, error) {
+	var sa ServiceAccount
+	if err := db.Where("client_id = ?", clientID).First(&sa).Error; err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// PrincipalType implements Principal.
+func (sa ServiceAccount) PrincipalType() string { return PrincipalServiceAccount }
+
+// PrincipalID implements Principal.
+func (sa ServiceAccount) PrincipalID() uint { return sa.ID }
+
+// PrincipalName implements Principal.
+func (sa ServiceAccount) PrincipalName() string { return sa.Name }
+
+// PrincipalOrgID implements Principal.
+func (sa ServiceAccount) PrincipalOrgID() uint { return sa.OrganizationID }
+
+// PolicyAttachments implements Principal.
+func (sa ServiceAccount) PolicyAttachments() []PolicyAttachment {
+	return collectPolicies(sa.Policies, sa.Groups, sa.Roles)
+}
+
+// ContextAttributes implements Principal.
+func (sa ServiceAccount) ContextAttributes() map[string]string {
+	return map[string]string{
+		"principal_type": PrincipalServiceAccount,
+		"user:username":  sa.Name,
+	}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey stores a private key used to sign JWTs when keys are kept in the database.
+//
+// Fields:
+//   - KID: key ID published in the JWT "kid" header and in the JWKS document (column k_id)
+//   - Algorithm: JWS algorithm of the key ("RS256", "ES256" or "EdDSA")
+//   - PrivateKeyPEM: PKCS#8 PEM-encoded private key
+//   - RetiredAt: set when the key stops being used for signing; retired keys are
+//     still published for verification until they are pruned
+type SigningKey struct {
+	gorm.Model
+	KID           string `gorm:"uniqueIndex;not null"`
+	Algorithm     string `gorm:"not null"`
+	PrivateKeyPEM string `gorm:"type:text;not null"`
+	RetiredAt     *time.Time
+}
+
+// ListSigningKeys returns all stored signing keys, newest first.
+func ListSigningKeys(db *gorm.DB) ([]SigningKey, error) {
+	var keys []SigningKey
+	err := db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RetireSigningKey marks a key as no longer used for signing.
+func RetireSigningKey(db *gorm.DB, kid string, at time.Time) error {
+	return db.Model(&SigningKey{}).
+		Where("k_id = ? AND retired_at IS NULL", kid).
+		Update("retired_at", at).Error
+}
+
+// DeleteSigningKey permanently removes a key so it is no longer published.
+func DeleteSigningKey(db *gorm.DB, kid string) error {
+	return db.Unscoped().Where("k_id = ?", kid).Delete(&SigningKey{}).Error
+}
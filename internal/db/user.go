@@ -4,6 +4,8 @@ package db
 
 import (
 	"errors"
+	"strconv"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -19,6 +21,9 @@ import (
 //   - IsActive controls if the user account is currently enabled
 //   - Groups, Roles, and Policies are used for access control (many-to-many)
 //   - TOTPSecret and BackupCodes support 2FA functionality
+//   - TokensValidAfter invalidates every access token issued before it
+//   - EmailLoginSentAt throttles passwordless login emails
+//   - AuthProvider and ExternalID link accounts provisioned by an external provider
 type User struct {
 	gorm.Model
 	Username      string `gorm:"not null;uniqueIndex:idx_org_username"` // Unique within org
@@ -33,8 +38,8 @@ type User struct {
 	LastName   string // User's last name
 	Address    string // Mailing or home address
 
-	IsActive       bool         `gorm:"default:true"` // Whether the account is enabled
-	OrganizationID uint         // Foreign key to organization
+	IsActive       bool         `gorm:"default:true"`                                           // Whether the account is enabled
+	OrganizationID uint         `gorm:"uniqueIndex:idx_org_username;uniqueIndex:idx_org_email"` // Foreign key to organization
 	Organization   Organization // GORM association
 
 	// Relationships
@@ -46,6 +51,12 @@ type User struct {
 	Requires2FA   bool         `gorm:"default:false"` // Whether 2FA is required
 	TwoFAVerified bool         `gorm:"-:all"`         // Set at runtime only (ignored by GORM)
 	BackupCodes   []BackupCode // List of backup codes for 2FA recovery
+
+	TokensValidAfter *time.Time // Tokens issued before this time are rejected (logout-all)
+	EmailLoginSentAt *time.Time // When the last login code or link was issued
+
+	AuthProvider string `gorm:"index"` // Provider managing the account, e.g. "ldap"; empty for local accounts
+	ExternalID   string // Identifier of the account at the provider, e.g. its LDAP DN
 }
 
 // BackupCode stores a one-time-use code for users who enable 2FA.
@@ -107,5 +118,66 @@ func DeleteUser(id uint) error {
 	if id == 0 {
 		return errors.New("invalid user ID")
 	}
-	return DB.Delete(&User{}, id).Error
+	return DB.Delete(&User{Model: gorm.Model{ID: id}}).Error
+}
+
+// SetUserActive enables or disables a user account.
+//
+// Disabling an account also revokes every token issued to the user and invalidates
+// outstanding email verification tokens, so the user cannot activate it again.
+func SetUserActive(db *gorm.DB, id uint, active bool) error {
+	if err := db.Model(&User{}).Where("id = ?", id).Update("is_active", active).Error; err != nil {
+		return err
+	}
+	if !active {
+		if err := InvalidateEmailVerificationTokens(db, id); err != nil {
+			return err
+		}
+		return RevokeAllUserTokens(db, id)
+	}
+	return nil
+}
+
+// RestoreUser undoes the soft delete of a user. Tokens revoked on deletion stay revoked.
+func RestoreUser(db *gorm.DB, id uint) error {
+	return db.Unscoped().Model(&User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+// AfterDelete is a GORM hook that revokes the tokens of a deleted user,
+// so a stolen token cannot outlive the account.
+func (u *User) AfterDelete(tx *gorm.DB) error {
+	if u.ID == 0 {
+		return nil
+	}
+	return RevokeUserRefreshTokens(tx.Session(&gorm.Session{NewDB: true}), u.ID)
+}
+
+// PrincipalType implements Principal.
+func (u User) PrincipalType() string { return PrincipalUser }
+
+// PrincipalID implements Principal.
+func (u User) PrincipalID() uint { return u.ID }
+
+// PrincipalName implements Principal.
+func (u User) PrincipalName() string { return u.Username }
+
+// PrincipalOrgID implements Principal.
+func (u User) PrincipalOrgID() uint { return u.OrganizationID }
+
+// PolicyAttachments implements Principal.
+func (u User) PolicyAttachments() []PolicyAttachment {
+	return collectPolicies(u.Policies, u.Groups, u.Roles)
+}
+
+// ContextAttributes implements Principal.
+func (u User) ContextAttributes() map[string]string {
+	return map[string]string{
+		"principal_type":      PrincipalUser,
+		"user:username":       u.Username,
+		"user:email":          u.Email,
+		"user:email_verified": strconv.FormatBool(u.EmailVerified),
+		"user:phone_number":   u.PhoneNumber,
+		"user:first_name":     u.FirstName,
+		"user:last_name":      u.LastName,
+	}
 }
@@ -34,23 +34,49 @@ func (u *User) Enable2FA(db *gorm.DB, hashedSecret string) error {
 	u.Requires2FA = true
 	u.TOTPSecret = hashedSecret
 	return db.Model(u).Updates(map[string]interface{}{
-		"requires_2fa": true,
+		"requires2_fa": true, // GORM column name of Requires2FA
 		"totp_secret":  hashedSecret,
 	}).Error
 }
 
-// Disable2FA disables two-factor authentication and clears the secret.
+// Disable2FA clears the TOTP secret and disables two-factor authentication.
 //
-// This should be called when a user intentionally disables 2FA.
+// This should be called when a user intentionally disables 2FA. Users with
+// registered WebAuthn credentials keep requiring 2FA, as the credentials are a
+// second factor too; 2FA is disabled when the last of them is deleted.
 func (u *User) Disable2FA(db *gorm.DB) error {
-	u.Requires2FA = false
+	var keys int64
+	if err := db.Model(&WebAuthnCredential{}).Where("user_id = ?", u.ID).Count(&keys).Error; err != nil {
+		return err
+	}
+	u.Requires2FA = keys > 0
 	u.TOTPSecret = ""
 	return db.Model(u).Updates(map[string]interface{}{
-		"requires_2fa": false,
+		"requires2_fa": u.Requires2FA,
 		"totp_secret":  "",
 	}).Error
 }
 
+// Reset2FA disables two-factor authentication, clears the secret and deletes
+// the backup codes and WebAuthn credentials, so a locked-out user can log in with
+// their password and set up 2FA again, and a lost security key no longer logs in.
+//
+// Every token issued to the user is revoked.
+func (u *User) Reset2FA(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(&WebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+		if err := u.Disable2FA(tx); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&BackupCode{}).Error; err != nil {
+			return err
+		}
+		return RevokeAllUserTokens(tx, u.ID)
+	})
+}
+
 // UserAccessSummary holds the list of roles, groups, and policy names associated with a user.
 type UserAccessSummary struct {
 	UserID   uint
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential is a security key or passkey registered by a user.
+//
+// Fields:
+//   - UserID: foreign key to the owning user
+//   - CredentialID: base64url-encoded credential ID chosen by the authenticator
+//   - PublicKey: COSE-encoded public key verifying the assertions of the credential
+//   - AttestationType, AAGUID: attestation format and authenticator model at registration
+//   - SignCount: last signature counter, used to detect cloned authenticators
+//   - Transports: comma-separated transports reported by the browser (usb, nfc, ble, internal, hybrid)
+//   - BackupEligible, BackupState: whether the credential can be and is synced, e.g. a passkey
+//   - Name: friendly name chosen by the user
+//   - LastUsedAt: time of the last successful assertion
+type WebAuthnCredential struct {
+	gorm.Model
+	UserID          uint   `gorm:"index;not null"`
+	CredentialID    string `gorm:"uniqueIndex;not null"`
+	PublicKey       []byte `gorm:"not null"`
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      string
+	BackupEligible  bool
+	BackupState     bool
+	Name            string
+	LastUsedAt      *time.Time
+}
+
+// WebAuthnSession holds the challenge of a WebAuthn ceremony between its begin and
+// finish requests.
+//
+// Fields:
+//   - TokenHash: SHA-256 hash of the opaque session token returned to the client
+//   - UserID: user the ceremony was started for; 0 for passkey logins
+//   - Purpose: "register", "login" or "2fa"
+//   - Data: JSON-encoded session data of the ceremony, including the challenge
+//   - ExpiresAt: absolute expiry of the ceremony
+//   - UsedAt: set when the finish request redeems the session
+type WebAuthnSession struct {
+	gorm.Model
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"not null"`
+	Data      string `gorm:"not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// ConsumeWebAuthnSession atomically redeems an unused, unexpired session of a user
+// started for purpose.
+//
+// Returns gorm.ErrRecordNotFound if no such session exists, it has expired or it
+// was already used, including by a concurrent request.
+func ConsumeWebAuthnSession(db *gorm.DB, hash, purpose string, userID uint) (*WebAuthnSession, error) {
+	var ws WebAuthnSession
+	if err := db.Where("token_hash = ? AND purpose = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?",
+		hash, purpose, userID, time.Now()).
+		First(&ws).Error; err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&WebAuthnSession{}).
+		Where("id = ? AND used_at IS NULL", ws.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &ws, nil
+}
@@ -0,0 +1,123 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the JSON Web Key representation (RFC 7517) of a public verification key.
+type JWK struct {
+	KTY string `json:"kty"`           // key type: "RSA", "EC" or "OKP"
+	KID string `json:"kid"`           // key ID
+	Use string `json:"use"`           // always "sig"
+	Alg string `json:"alg"`           // JWS algorithm
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	CRV string `json:"crv,omitempty"` // curve for EC and OKP keys
+	X   string `json:"x,omitempty"`   // EC x coordinate or Ed25519 public key
+	Y   string `json:"y,omitempty"`   // EC y coordinate
+}
+
+// JWKS is a JSON Web Key Set as served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// b64 encodes bytes using unpadded base64url, as required by RFC 7518.
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padded returns the big-endian bytes of n left-padded to size bytes.
+func padded(n *big.Int, size int) []byte {
+	return n.FillBytes(make([]byte, size))
+}
+
+// publicJWK converts the public half of a key to its JWK representation.
+func publicJWK(k Key) (JWK, bool) {
+	jwk := JWK{KID: k.KID, Use: "sig", Alg: k.Algorithm}
+
+	var pub crypto.PublicKey = k.Private.Public()
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		jwk.KTY = "RSA"
+		jwk.N = b64(p.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(p.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (p.Curve.Params().BitSize + 7) / 8
+		jwk.KTY = "EC"
+		jwk.CRV = p.Curve.Params().Name
+		jwk.X = b64(padded(p.X, size))
+		jwk.Y = b64(padded(p.Y, size))
+	case ed25519.PublicKey:
+		jwk.KTY = "OKP"
+		jwk.CRV = "Ed25519"
+		jwk.X = b64(p)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// PublicKey converts a JWK, e.g. fetched from an upstream identity provider, back to
+// the public key it represents.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch j.KTY {
+	case "RSA":
+		n, err := dec(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.CRV {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.CRV)
+		}
+		x, err := dec(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := dec(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if j.CRV != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q", j.CRV)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", j.KTY)
+}
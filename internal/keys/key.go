@@ -0,0 +1,118 @@
+// Package keys manages the asymmetric keys used to sign and verify JWTs.
+//
+// Keys are identified by a key ID ("kid") carried in the JWT header. The newest
+// key signs new tokens, while retired keys stay published in the JWKS document
+// until every token they signed has expired.
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Supported JWS algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256" // legacy shared-secret mode, no key rotation or JWKS
+)
+
+// Key is a private signing key together with its metadata.
+type Key struct {
+	KID       string        // key ID published in the "kid" header
+	Algorithm string        // JWS algorithm, e.g. "RS256"
+	Private   crypto.Signer // private key; Public() yields the verification key
+	CreatedAt time.Time     // when the key was generated
+	RetiredAt *time.Time    // when the key stopped signing, nil for the active key
+}
+
+// SigningMethod returns the jwt signing method matching the key's algorithm.
+func (k Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// GenerateKey creates a new private key for the given algorithm with a random key ID.
+//
+// RS256 uses a 2048-bit RSA key, ES256 a P-256 ECDSA key and EdDSA an Ed25519 key.
+func GenerateKey(alg string) (Key, error) {
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch alg {
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return Key{}, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		KID:       uuid.New().String(),
+		Algorithm: alg,
+		Private:   priv,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// algorithmFor returns the JWS algorithm that matches the type of a private key.
+func algorithmFor(priv crypto.Signer) (string, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", errors.New("only P-256 ECDSA keys are supported")
+		}
+		return AlgES256, nil
+	case ed25519.PrivateKey:
+		return AlgEdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", priv)
+	}
+}
+
+// encodePrivateKey encodes a private key as a PKCS#8 PEM block with optional headers.
+func encodePrivateKey(priv crypto.Signer, headers map[string]string) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: der}), nil
+}
+
+// decodePrivateKey parses a PKCS#8 PEM block and returns the key and its headers.
+func decodePrivateKey(data []byte) (crypto.Signer, map[string]string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, nil, errors.New("invalid PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return priv, block.Headers, nil
+}
@@ -0,0 +1,304 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"gorm.io/gorm"
+)
+
+// reloadCooldown limits how often an unknown "kid" may trigger a reload from the store.
+const reloadCooldown = 10 * time.Second
+
+// Manager signs tokens with the active key and verifies tokens against every published key.
+//
+// Keys are cached in memory and reloaded from the Store periodically, so several
+// server instances sharing a store (or a rotation done from the command line)
+// converge on the same key set.
+type Manager struct {
+	mu         sync.RWMutex
+	store      Store
+	alg        string
+	rotateIn   time.Duration
+	retention  time.Duration
+	keys       []Key // newest first; keys[0] is the active signing key
+	lastReload time.Time
+
+	hmacSecret []byte // used only in legacy HS256 mode
+
+	stop chan struct{}
+}
+
+// NewManager creates a Manager from the signing configuration.
+//
+// In "HS256" mode tokens are signed with cfg.JWTSecret and no keys are stored.
+// Otherwise keys are loaded from the configured store, and a first key is generated
+// if none exists or the active key uses a different algorithm than configured.
+func NewManager(cfg *config.Config, iamDB *gorm.DB) (*Manager, error) {
+	m := &Manager{
+		alg:        cfg.Signing.Algorithm,
+		rotateIn:   cfg.Signing.RotationInterval,
+		retention:  cfg.Signing.Retention,
+		hmacSecret: []byte(cfg.JWTSecret),
+	}
+
+	// Retired keys must outlive every token they signed
+	if m.retention < cfg.Token.AccessTTL {
+		m.retention = cfg.Token.AccessTTL
+	}
+
+	if m.alg == AlgHS256 {
+		return m, nil
+	}
+
+	switch cfg.Signing.Storage {
+	case "db":
+		m.store = NewDBStore(iamDB)
+	case "disk":
+		store, err := NewDiskStore(cfg.Signing.KeyDir)
+		if err != nil {
+			return nil, err
+		}
+		m.store = store
+	default:
+		return nil, fmt.Errorf("unsupported key storage: %s", cfg.Signing.Storage)
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	if active, ok := m.active(); !ok || active.Algorithm != m.alg {
+		if _, err := m.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Reload replaces the in-memory key set with the content of the store.
+func (m *Manager) Reload() error {
+	if m.store == nil {
+		return nil
+	}
+	keys, err := m.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// active returns the newest non-retired key.
+func (m *Manager) active() (Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.RetiredAt == nil {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// Rotate generates a new signing key, retires the previous active key and prunes
+// retired keys whose retention period has passed.
+//
+// Returns the newly created key.
+func (m *Manager) Rotate() (Key, error) {
+	if m.store == nil {
+		return Key{}, errors.New("key rotation is not available in HS256 mode")
+	}
+
+	previous, hasPrevious := m.active()
+
+	k, err := GenerateKey(m.alg)
+	if err != nil {
+		return Key{}, err
+	}
+	if err := m.store.Save(k); err != nil {
+		return Key{}, err
+	}
+	if hasPrevious {
+		if err := m.store.Retire(previous.KID, time.Now()); err != nil {
+			return Key{}, err
+		}
+	}
+
+	if err := m.Reload(); err != nil {
+		return Key{}, err
+	}
+	m.prune()
+
+	return k, nil
+}
+
+// prune deletes retired keys that no longer need to be published.
+func (m *Manager) prune() {
+	m.mu.RLock()
+	var expired []string
+	for _, k := range m.keys {
+		if k.RetiredAt != nil && time.Since(*k.RetiredAt) > m.retention {
+			expired = append(expired, k.KID)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(expired) == 0 {
+		return
+	}
+	for _, kid := range expired {
+		if err := m.store.Delete(kid); err != nil {
+			log.Printf("failed to delete signing key %s: %v", kid, err)
+		}
+	}
+	if err := m.Reload(); err != nil {
+		log.Println(err)
+	}
+}
+
+// Sign signs the claims with the active key and sets the "kid" header.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	if m.alg == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.hmacSecret)
+	}
+
+	k, ok := m.active()
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(k.SigningMethod(), claims)
+	token.Header["kid"] = k.KID
+	return token.SignedString(k.Private)
+}
+
+// ValidMethods returns the signing algorithms accepted by Keyfunc.
+//
+// It should be passed to jwt.WithValidMethods to prevent algorithm confusion.
+func (m *Manager) ValidMethods() []string {
+	if m.alg == AlgHS256 {
+		return []string{AlgHS256}
+	}
+	return []string{AlgRS256, AlgES256, AlgEdDSA}
+}
+
+// Keyfunc resolves the verification key for a token from its "kid" header.
+//
+// It is meant to be used as the jwt.Keyfunc when parsing tokens. An unknown kid
+// triggers a (rate-limited) reload, in case another instance has just rotated keys.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if m.alg == AlgHS256 {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return m.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid header")
+	}
+
+	k, ok := m.find(kid)
+	if !ok && m.canReload() {
+		if err := m.Reload(); err != nil {
+			return nil, err
+		}
+		k, ok = m.find(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+	if token.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	return k.Private.Public(), nil
+}
+
+// find returns the key with the given ID.
+func (m *Manager) find(kid string) (Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.KID == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// canReload reports whether enough time has passed since the last reload.
+func (m *Manager) canReload() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Since(m.lastReload) > reloadCooldown
+}
+
+// JWKS returns the public keys of every published key (active and retired).
+//
+// In HS256 mode the set is empty, since a shared secret must never be published.
+func (m *Manager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range m.keys {
+		if jwk, ok := publicJWK(k); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// StartRotation runs a background loop that reloads keys from the store every
+// checkEvery and rotates the active key once it is older than the rotation interval.
+//
+// Call StopRotation to end the loop.
+func (m *Manager) StartRotation(checkEvery time.Duration) {
+	if m.store == nil {
+		return
+	}
+	m.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(checkEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					log.Println(err)
+					continue
+				}
+				if k, ok := m.active(); ok && time.Since(k.CreatedAt) < m.rotateIn {
+					m.prune()
+					continue
+				}
+				k, err := m.Rotate()
+				if err != nil {
+					log.Printf("signing key rotation failed: %v", err)
+					continue
+				}
+				log.Printf("rotated signing key, new kid %s", k.KID)
+			}
+		}
+	}()
+}
+
+// StopRotation stops the background loop started by StartRotation.
+func (m *Manager) StopRotation() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
@@ -0,0 +1,216 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// Store persists signing keys.
+//
+// Implementations exist for the database (DBStore) and for a directory of PEM files (DiskStore).
+type Store interface {
+	// Load returns every stored key, newest first.
+	Load() ([]Key, error)
+	// Save persists a newly generated key.
+	Save(k Key) error
+	// Retire marks a key as no longer used for signing.
+	Retire(kid string, at time.Time) error
+	// Delete permanently removes a key.
+	Delete(kid string) error
+}
+
+// DBStore keeps signing keys in the signing_keys table.
+type DBStore struct {
+	iamDB *gorm.DB
+}
+
+// NewDBStore returns a Store backed by the given database.
+func NewDBStore(iamDB *gorm.DB) *DBStore {
+	return &DBStore{iamDB: iamDB}
+}
+
+// Load returns every key stored in the database, newest first.
+func (s *DBStore) Load() ([]Key, error) {
+	rows, err := db.ListSigningKeys(s.iamDB)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(rows))
+	for _, row := range rows {
+		priv, _, err := decodePrivateKey([]byte(row.PrivateKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", row.KID, err)
+		}
+		keys = append(keys, Key{
+			KID:       row.KID,
+			Algorithm: row.Algorithm,
+			Private:   priv,
+			CreatedAt: row.CreatedAt,
+			RetiredAt: row.RetiredAt,
+		})
+	}
+	return keys, nil
+}
+
+// Save stores a new key in the database.
+func (s *DBStore) Save(k Key) error {
+	data, err := encodePrivateKey(k.Private, nil)
+	if err != nil {
+		return err
+	}
+	row := db.SigningKey{
+		KID:           k.KID,
+		Algorithm:     k.Algorithm,
+		PrivateKeyPEM: string(data),
+		RetiredAt:     k.RetiredAt,
+	}
+	row.CreatedAt = k.CreatedAt
+	return s.iamDB.Create(&row).Error
+}
+
+// Retire marks a key as retired in the database.
+func (s *DBStore) Retire(kid string, at time.Time) error {
+	return db.RetireSigningKey(s.iamDB, kid, at)
+}
+
+// Delete removes a key from the database.
+func (s *DBStore) Delete(kid string) error {
+	return db.DeleteSigningKey(s.iamDB, kid)
+}
+
+// DiskStore keeps each signing key in its own PEM file ("<kid>.pem") inside a directory.
+//
+// Key metadata (kid, creation and retirement time) is stored as PEM headers.
+type DiskStore struct {
+	dir string
+}
+
+// PEM header names used by DiskStore.
+const (
+	headerKID     = "Kid"
+	headerCreated = "Created"
+	headerRetired = "Retired"
+)
+
+// NewDiskStore returns a Store that keeps keys in dir, creating it if necessary.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// path returns the file path for the key with the given ID.
+func (s *DiskStore) path(kid string) string {
+	return filepath.Join(s.dir, kid+".pem")
+}
+
+// Load reads every "*.pem" file in the directory, newest first.
+func (s *DiskStore) Load() ([]Key, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Key, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		k, err := s.decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		if k.KID == "" {
+			k.KID = strings.TrimSuffix(filepath.Base(f), ".pem")
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// decode parses a PEM file written by Save.
+func (s *DiskStore) decode(data []byte) (Key, error) {
+	priv, headers, err := decodePrivateKey(data)
+	if err != nil {
+		return Key{}, err
+	}
+	alg, err := algorithmFor(priv)
+	if err != nil {
+		return Key{}, err
+	}
+
+	k := Key{KID: headers[headerKID], Algorithm: alg, Private: priv}
+	if v, ok := headers[headerCreated]; ok {
+		if k.CreatedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return Key{}, err
+		}
+	}
+	if v, ok := headers[headerRetired]; ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Key{}, err
+		}
+		k.RetiredAt = &t
+	}
+	return k, nil
+}
+
+// write stores a key to its PEM file, replacing any previous content.
+func (s *DiskStore) write(k Key) error {
+	headers := map[string]string{
+		headerKID:     k.KID,
+		headerCreated: k.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if k.RetiredAt != nil {
+		headers[headerRetired] = k.RetiredAt.UTC().Format(time.RFC3339)
+	}
+	data, err := encodePrivateKey(k.Private, headers)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(k.KID), data, 0600)
+}
+
+// Save writes a new key file.
+func (s *DiskStore) Save(k Key) error {
+	return s.write(k)
+}
+
+// Retire rewrites a key file with the retirement time set.
+func (s *DiskStore) Retire(kid string, at time.Time) error {
+	data, err := os.ReadFile(s.path(kid))
+	if err != nil {
+		return err
+	}
+	k, err := s.decode(data)
+	if err != nil {
+		return err
+	}
+	if k.RetiredAt != nil {
+		return nil
+	}
+	k.KID = kid
+	k.RetiredAt = &at
+	return s.write(k)
+}
+
+// Delete removes a key file.
+func (s *DiskStore) Delete(kid string) error {
+	if err := os.Remove(s.path(kid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
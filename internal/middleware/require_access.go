@@ -1,36 +1,81 @@
 package middleware
 
 import (
-	"fmt"
+	"log"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/javadmohebbi/goIAM/internal/config"
 	"github.com/javadmohebbi/goIAM/internal/db"
 )
 
-// RequireAccess returns a Fiber middleware that enforces access control by evaluating the user's policy.
+// RequireAccess returns a Fiber middleware that enforces access control by evaluating the policies
+// of the authenticated principal (user or service account).
 //
 // Parameters:
 //   - action: the action being performed (e.g., "read", "write", "delete").
-//   - resourceTemplate: a string representing the resource with optional placeholders like {user_id}, {org_id}.
-//   - cfg: application configuration reference.
+//   - resourceTemplate: a string representing the resource with optional placeholders like {user_id}, {org_id}, {username}.
+//   - cfg: application configuration reference. In debug mode, denied requests are logged
+//     with an explanation of the evaluated policies.
 func RequireAccess(action string, resourceTemplate string, cfg *config.Config) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		user, ok := c.Locals("user").(db.User)
-		if !ok {
-			return fiber.ErrUnauthorized
+		if err := CheckAccess(c, action, resourceTemplate, cfg); err != nil {
+			return err
 		}
+		return c.Next()
+	}
+}
 
-		// Replace placeholders in resource template
-		resource := strings.ReplaceAll(resourceTemplate, "{user_id}", fmt.Sprint(user.ID))
-		resource = strings.ReplaceAll(resource, "{org_id}", fmt.Sprint(user.OrganizationID))
+// CheckAccess evaluates the policies of the authenticated principal like RequireAccess.
+// Handlers use it for actions that depend on the request body, e.g. attaching the
+// policies listed in a create request. It returns a 403 error if access is denied.
+func CheckAccess(c fiber.Ctx, action string, resourceTemplate string, cfg *config.Config) error {
+	principal, ok := c.Locals("principal").(db.Principal)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
 
-		// Evaluate access
-		if !db.EvaluatePolicy(user, action, resource) {
-			return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	// Replace placeholders ({org_id}, {user_id}, {username}) in resource template
+	resource := resourceTemplate
+	for name, value := range db.PolicyVariables(principal) {
+		resource = strings.ReplaceAll(resource, name, value)
+	}
+
+	// Evaluate access
+	ctx := RequestContext(c)
+	if !db.EvaluatePolicy(principal, action, resource, ctx) {
+		if cfg.Debug {
+			logDenied(principal, action, resource, ctx)
 		}
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return nil
+}
 
-		return c.Next()
+// RequestContext builds the condition context of an authenticated request:
+// the client IP and whether the access token carries the "2fa" claim.
+func RequestContext(c fiber.Ctx) db.RequestContext {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	mfa, _ := claims["2fa"].(bool)
+	return db.RequestContext{
+		db.CtxSourceIP: c.IP(),
+		db.CtxMFA:      strconv.FormatBool(mfa),
+	}
+}
+
+// logDenied logs why a request was denied: the gathered policies, their sources
+// and which statements matched on action and resource.
+func logDenied(principal db.Principal, action, resource string, ctx db.RequestContext) {
+	exp := db.Explain(principal, action, resource, ctx)
+	log.Printf("access denied: %s %d (%s) action=%q resource=%q explicit_deny=%t policies=%d",
+		principal.PrincipalType(), principal.PrincipalID(), principal.PrincipalName(),
+		action, resource, exp.ExplicitDeny, len(exp.Policies))
+	for _, p := range exp.Policies {
+		for _, s := range p.Statements {
+			log.Printf("  policy %q via %s: statement %d %s action_match=%t resource_match=%t conditions_match=%t",
+				p.PolicyName, strings.Join(p.Sources, ","), s.StatementID, s.Effect, s.ActionMatch, s.ResourceMatch, s.ConditionsMatch)
+		}
 	}
 }
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/javadmohebbi/goIAM/internal/config"
+	"github.com/javadmohebbi/goIAM/internal/db"
+	"gorm.io/gorm"
+)
+
+// ResolveTenant is a Fiber middleware that maps the request host to an organization
+// and stores it in c.Locals("tenant") as a db.Organization.
+//
+// A host is mapped if it is:
+//   - a direct subdomain of tenancy.base_domain, e.g. acme.iam.example.com for the
+//     organization with slug "acme"
+//   - the verified custom domain of an organization
+//
+// Other hosts (the base domain itself, localhost, IP addresses) have no tenant and
+// requests are processed as before. Unknown subdomains are rejected with 404.
+func ResolveTenant(cfg *config.Config, iamDB *gorm.DB) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		host := strings.ToLower(strings.TrimSuffix(c.Hostname(), "."))
+
+		var org db.Organization
+		var err error
+		if slug := orgSlugFromHost(host, cfg.Tenancy.BaseDomain); slug != "" {
+			err = iamDB.Where("slug = ?", slug).First(&org).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, "organization not found")
+			}
+		} else if host != "" {
+			err = iamDB.Where("custom_domain = ? AND custom_domain_verified = ?", host, true).First(&org).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Next()
+			}
+		} else {
+			return c.Next()
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to resolve organization")
+		}
+
+		c.Locals("tenant", org)
+		return c.Next()
+	}
+}
+
+// CheckTenant rejects principals of another organization than the tenant of the request,
+// so a token issued for one tenant cannot be used on another. Requests without a tenant
+// are not restricted.
+func CheckTenant(c fiber.Ctx, orgID uint) error {
+	tenant, ok := c.Locals("tenant").(db.Organization)
+	if ok && tenant.ID != orgID {
+		return fiber.NewError(fiber.StatusUnauthorized, "token was issued for another organization")
+	}
+	return nil
+}
+
+// orgSlugFromHost returns the single subdomain label of host under baseDomain,
+// e.g. "acme" for "acme.iam.example.com" and base domain "iam.example.com".
+// It returns "" if baseDomain is empty or host is not a direct subdomain of it.
+func orgSlugFromHost(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+
+	label, ok := strings.CutSuffix(host, suffix)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
@@ -1,20 +1,45 @@
 package middleware
 
 import (
-	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/javadmohebbi/goIAM/internal/config"
 	"github.com/javadmohebbi/goIAM/internal/db"
+	"github.com/javadmohebbi/goIAM/internal/keys"
 	"gorm.io/gorm"
 )
 
 // RequireAuth is a Fiber middleware that verifies the Authorization Bearer JWT token,
-// checks if the user exists, and enforces 2FA if required.
-// On success, it stores the `db.User` in c.Locals("user") for route handlers.
-func RequireAuth(cfg *config.Config, iamDB *gorm.DB) fiber.Handler {
+// checks that the token has not been revoked, checks if the user exists and is active,
+// and enforces 2FA if required.
+// On success, it stores the `db.User` in c.Locals("user") and the token claims
+// in c.Locals("claims") for route handlers. The authenticated db.Principal (user or
+// service account) is stored in c.Locals("principal"); tokens of service accounts
+// do not set c.Locals("user"). The principal carries its policies, groups and roles,
+// served from the policy cache.
+//
+// Tokens are verified with the key manager, which selects the public key by the "kid" header.
+// On a tenant host (see ResolveTenant), principals of other organizations are rejected.
+//
+// Access tokens users granted to OAuth clients (carrying a "client_id" claim) are
+// rejected with 403: a relying party must not gain the user's rights on the API.
+// Endpoints serving OAuth clients use RequireClientAuth instead.
+func RequireAuth(cfg *config.Config, iamDB *gorm.DB, km *keys.Manager) fiber.Handler {
+	return requireAuth(cfg, iamDB, km, false)
+}
+
+// RequireClientAuth is RequireAuth for endpoints meant for OAuth clients, such as
+// userinfo: it also accepts access tokens users granted to OAuth clients.
+func RequireClientAuth(cfg *config.Config, iamDB *gorm.DB, km *keys.Manager) fiber.Handler {
+	return requireAuth(cfg, iamDB, km, true)
+}
+
+// requireAuth implements RequireAuth and RequireClientAuth.
+func requireAuth(cfg *config.Config, iamDB *gorm.DB, km *keys.Manager, allowClientTokens bool) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		// Extract bearer token
 		authHeader := c.Get("Authorization")
@@ -23,48 +48,137 @@ func RequireAuth(cfg *config.Config, iamDB *gorm.DB) fiber.Handler {
 		}
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Parse and verify JWT
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(cfg.JWTSecret), nil
-		})
-		if err != nil || !token.Valid {
-			return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+		principal, claims, err := VerifyToken(iamDB, km, tokenStr)
+		if err != nil {
+			return err
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return fiber.NewError(fiber.StatusUnauthorized, "invalid claims")
+		// Tokens are only valid on the host of their own organization
+		if err := CheckTenant(c, principal.PrincipalOrgID()); err != nil {
+			return err
 		}
 
-		// Extract user ID from token
-		userID, ok := claims["sub"].(float64)
+		// Attach policies, groups and roles (cached) for RequireAccess
+		if principal, err = db.LoadPrincipalPolicies(iamDB, principal); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to load policies")
+		}
+
+		// Service accounts have no 2FA and no user-specific routes
+		user, ok := principal.(db.User)
 		if !ok {
-			return fiber.NewError(fiber.StatusUnauthorized, "invalid user ID")
+			c.Locals("principal", principal)
+			c.Locals("claims", claims)
+			return c.Next()
 		}
 
-		// Load user from DB
-		var user db.User
-		if err := iamDB.First(&user, uint(userID)).Error; err != nil {
-			return fiber.NewError(fiber.StatusUnauthorized, "user not found")
+		// Tokens issued to OAuth clients act for the user only towards those clients
+		if _, delegated := claims["client_id"]; delegated && !allowClientTokens {
+			return fiber.NewError(fiber.StatusForbidden, "tokens issued to OAuth clients cannot be used here")
 		}
 
 		// Check if 2FA is required but not verified
-		// Skip 2FA check only for /2fa/verify and /2fa/setup
+		// Skip 2FA check only for the second factor routes and /logout
 		path := c.Path()
 		// verified := claims["2fa"] == true
 		// A JWT with "2fa": true means user already passed 2FA
 		verified, _ := claims["2fa"].(bool)
 
-		if user.Requires2FA && !verified &&
-			path != "/s/auth/2fa/verify" && path != "/s/auth/2fa/setup" {
+		if user.Requires2FA && !verified && !pendingTwoFAPaths[path] {
 			return fiber.NewError(fiber.StatusForbidden, "2FA required")
 		}
 
-		// Store user object in Fiber context
+		// Store user object and token claims in Fiber context
 		c.Locals("user", user)
+		c.Locals("principal", user)
+		c.Locals("claims", claims)
 		return c.Next()
 	}
 }
+
+// pendingTwoFAPaths are the routes usable with the token of a login that still
+// requires the second factor.
+var pendingTwoFAPaths = map[string]bool{
+	"/s/auth/2fa/verify":          true,
+	"/s/auth/2fa/setup":           true,
+	"/s/auth/2fa/webauthn/begin":  true,
+	"/s/auth/2fa/webauthn/finish": true,
+	"/s/auth/logout":              true,
+}
+
+// VerifyToken validates a JWT access token and loads the principal it was issued to.
+//
+// It checks the signature and expiry, the revocation list, and that the user or
+// service account still exists, is active and has not revoked all tokens since the
+// token was issued. The 2FA state is not enforced here; it is available as the
+// "2fa" claim. Errors are *fiber.Error values suitable for returning from handlers.
+func VerifyToken(iamDB *gorm.DB, km *keys.Manager, tokenStr string) (db.Principal, jwt.MapClaims, error) {
+	// Parse and verify JWT
+	token, err := jwt.Parse(tokenStr, km.Keyfunc, jwt.WithValidMethods(km.ValidMethods()))
+	if err != nil || !token.Valid {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "invalid claims")
+	}
+
+	// Extract principal ID from token
+	userID, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "invalid user ID")
+	}
+
+	// Reject tokens that were revoked by logout
+	jti, _ := claims["jti"].(string)
+	if jti != "" {
+		revoked, err := db.IsTokenRevoked(iamDB, jti)
+		if err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusInternalServerError, "failed to check token")
+		}
+		if revoked {
+			return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "token revoked")
+		}
+	}
+
+	if claims["principal_type"] == db.PrincipalServiceAccount {
+		var sa db.ServiceAccount
+		if err := iamDB.First(&sa, uint(userID)).Error; err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "service account not found")
+		}
+		if !sa.IsActive {
+			return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "service account is inactive")
+		}
+		if issuedBefore(claims, sa.TokensValidAfter) {
+			return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "token revoked")
+		}
+		return sa, claims, nil
+	}
+
+	// Load user from DB (soft-deleted users are not found)
+	var user db.User
+	if err := iamDB.First(&user, uint(userID)).Error; err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "user not found")
+	}
+	if !user.IsActive {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "user is inactive")
+	}
+
+	// Reject tokens issued before the user's last logout-all
+	if issuedBefore(claims, user.TokensValidAfter) {
+		return nil, nil, fiber.NewError(fiber.StatusUnauthorized, "token revoked")
+	}
+
+	return user, claims, nil
+}
+
+// issuedBefore reports whether the token was issued before validAfter (the principal's
+// last logout-all or credential reset). Both have millisecond precision, so tokens issued
+// earlier in the same second are rejected while those issued right after stay valid.
+func issuedBefore(claims jwt.MapClaims, validAfter *time.Time) bool {
+	if validAfter == nil {
+		return false
+	}
+	iat, _ := claims["iat"].(float64)
+	return time.UnixMilli(int64(math.Round(iat * 1000))).Before(*validAfter)
+}